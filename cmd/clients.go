@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+	"load-balancer/internal/audit"
+	"load-balancer/internal/clientio"
+	"load-balancer/internal/repo"
+)
+
+var (
+	importClients = flag.String("import-clients", "", "import clients from a JSONL or CSV file (- for stdin) and exit")
+	exportClients = flag.String("export-clients", "", "export all clients to a JSONL or CSV file and exit")
+	clientsFormat = flag.String("clients-format", "", "format of the import/export file: jsonl or csv (default: by file extension)")
+	importMode    = flag.String("import-mode", clientio.ModeUpsert, "import mode: upsert or create")
+	dryRun        = flag.Bool("dry-run", false, "validate the import file without writing to the database")
+	importKeys    = flag.String("import-keys", "-", "file to write API keys of imported new clients to (- for stdout)")
+)
+
+// clientsCommandRequested — true, если балансировщик запущен для импорта или экспорта клиентов, а не для работы.
+func clientsCommandRequested() bool {
+	return *importClients != "" || *exportClients != ""
+}
+
+// runClientsCommand — выполняет импорт или экспорт клиентов из командной строки и возвращает код завершения.
+func runClientsCommand(ctx context.Context, dbRepo repo.Repository, logger *zap.SugaredLogger) int {
+	if *importClients != "" {
+		return runImport(ctx, dbRepo, logger)
+	}
+	return runExport(ctx, dbRepo, logger)
+}
+
+func runImport(ctx context.Context, dbRepo repo.Repository, logger *zap.SugaredLogger) int {
+	format, err := clientio.ParseFormat(fileFormat(*importClients))
+	if err != nil {
+		logger.Errorw("invalid clients format", "error", err)
+		return 2
+	}
+
+	var src io.Reader = os.Stdin
+	if *importClients != "-" {
+		file, err := os.Open(*importClients)
+		if err != nil {
+			logger.Errorw("failed to open import file", "error", err)
+			return 1
+		}
+		defer file.Close()
+		src = file
+	}
+
+	report, err := clientio.Import(ctx, dbRepo, src, clientio.ImportOptions{Format: format, Mode: *importMode, DryRun: *dryRun})
+	if err != nil {
+		logger.Errorw("failed to import clients", "error", err)
+		return 1
+	}
+	if len(report.Errors) > 0 {
+		logger.Errorw("import rejected, nothing was written", "report", report)
+		return 1
+	}
+
+	if !report.DryRun {
+		report.RecordAudit(ctx, audit.NewAuditor(dbRepo, logger), cliActor())
+	}
+
+	// Ключи новых клиентов выводятся один раз, по строке JSON на ключ, и не попадают в лог.
+	keys := report.APIKeys
+	report.APIKeys = nil
+	logger.Infow("import finished", "report", report, "issued_keys", len(keys))
+	if err := writeIssuedKeys(*importKeys, keys); err != nil {
+		logger.Errorw("failed to write issued api keys", "error", err)
+		return 1
+	}
+	return 0
+}
+
+// writeIssuedKeys — записывает выданные ключи в файл с правами только для владельца или в stdout.
+func writeIssuedKeys(path string, keys []clientio.IssuedKey) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if path == "-" {
+		return encodeKeys(os.Stdout, keys)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	err = encodeKeys(file, keys)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func encodeKeys(dst io.Writer, keys []clientio.IssuedKey) error {
+	encoder := json.NewEncoder(dst)
+	for _, key := range keys {
+		if err := encoder.Encode(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runExport(ctx context.Context, dbRepo repo.Repository, logger *zap.SugaredLogger) int {
+	format, err := clientio.ParseFormat(fileFormat(*exportClients))
+	if err != nil {
+		logger.Errorw("invalid clients format", "error", err)
+		return 2
+	}
+
+	file, err := os.Create(*exportClients)
+	if err != nil {
+		logger.Errorw("failed to create export file", "error", err)
+		return 1
+	}
+
+	count, err := clientio.Export(ctx, dbRepo, file, format)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		logger.Errorw("failed to export clients", "error", err, "exported", count)
+		return 1
+	}
+
+	logger.Infow("export finished", "file", *exportClients, "count", count, "format", format)
+	return 0
+}
+
+// fileFormat — формат файла из флага -clients-format или по расширению файла.
+func fileFormat(path string) string {
+	if *clientsFormat != "" {
+		return *clientsFormat
+	}
+	return strings.TrimPrefix(filepath.Ext(path), ".")
+}
+
+// cliActor — автор изменений, сделанных из командной строки, для журнала изменений.
+func cliActor() audit.Actor {
+	name := "cli"
+	if u, err := user.Current(); err == nil {
+		name += ":" + u.Username
+	}
+	return audit.Actor{Name: name}
+}
@@ -3,19 +3,30 @@ package main
 import (
 	"context"
 	"flag"
+	"load-balancer/internal/accesslog"
+	"load-balancer/internal/apikey"
+	"load-balancer/internal/audit"
+	"load-balancer/internal/auth"
+	"load-balancer/internal/identity"
+	"load-balancer/internal/metrics"
+	"load-balancer/internal/models"
 	"load-balancer/internal/rate_limit"
 	"load-balancer/internal/repo"
 	"load-balancer/internal/server/middleware"
 	"load-balancer/internal/service"
-	"net/url"
+	"load-balancer/internal/upstream"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 
 	"load-balancer/internal/config"
-	"load-balancer/internal/models"
 	"load-balancer/internal/server"
 	"load-balancer/pkg/balancing_algorithms"
 	"load-balancer/pkg/logger"
+
+	"go.uber.org/zap"
 )
 
 var configPath = flag.String("config", "config.yaml", "config file path")
@@ -33,52 +44,363 @@ func main() {
 	if err != nil {
 		logger.Fatalw("failed to load config file", "error", err)
 	}
+	for _, warning := range cfg.Warnings {
+		logger.Warnw("config warning", "warning", warning)
+	}
 	logger.Infow("config loaded", "config", cfg)
 
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// bgCtx — контекст фоновых задач (проверки бэкендов, синхронизация и пополнение токенов, слежение за конфигом).
+	// Отменяется при остановке только после того, как завершатся запросы в работе.
+	bgCtx, cancelBackground := context.WithCancel(context.Background())
+	defer cancelBackground()
+	var background sync.WaitGroup
+	runBackground := func(task func(ctx context.Context)) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			task(bgCtx)
+		}()
+	}
+
 	dbRepo, err := repo.NewRepository(context.Background(), cfg.PostgreSQL)
 	if err != nil {
 		logger.Fatalw("failed to connect to database", "error", err)
 	}
 	logger.Infow("connected to database")
 
-	var backends []*models.Backend
-	for _, urlStr := range cfg.Backends {
-		url, err := url.Parse(urlStr)
+	if clientsCommandRequested() {
+		code := runClientsCommand(ctx, dbRepo, logger)
+		dbRepo.Close()
+		_ = logger.Sync()
+		os.Exit(code)
+	}
+
+	promMetrics := metrics.NewPrometheus(cfg.Metrics.MaxClientLabels)
+	promMetrics.RegisterDBPool(dbRepo.Stat)
+	recorder := metrics.NewMulti(promMetrics)
+
+	// metricsCtx отменяется последним, чтобы в StatsD успели уйти метрики финальной синхронизации.
+	metricsCtx, stopMetrics := context.WithCancel(context.Background())
+	defer stopMetrics()
+	var metricsDone sync.WaitGroup
+
+	if cfg.Metrics.StatsD.Enabled {
+		statsd, err := metrics.NewStatsD(metrics.StatsDConfig{
+			Address:       cfg.Metrics.StatsD.Address,
+			Prefix:        cfg.Metrics.StatsD.Prefix,
+			Flavor:        cfg.Metrics.StatsD.Flavor,
+			Tags:          cfg.Metrics.StatsD.Tags,
+			FlushInterval: cfg.Metrics.StatsD.FlushInterval,
+			MaxPacketSize: cfg.Metrics.StatsD.MaxPacketSize,
+		}, cfg.Metrics.MaxClientLabels, logger)
 		if err != nil {
-			logger.Fatalw("failed to parse url", "url", urlStr, "error", err)
-			continue
+			logger.Fatalw("failed to create statsd metrics sink", "error", err)
+		}
+		statsd.RegisterDBPool(dbRepo.Stat)
+		metricsDone.Add(1)
+		go func() {
+			defer metricsDone.Done()
+			statsd.Run(metricsCtx)
+		}()
+		recorder = metrics.NewMulti(promMetrics, statsd)
+		logger.Infow("statsd metrics enabled", "address", cfg.Metrics.StatsD.Address)
+	}
+
+	balancerFactory := balancing_algorithms.NewBalancerFactory(logger, recorder)
+	upstreams, err := upstream.NewManager(cfg, balancerFactory)
+	if err != nil {
+		logger.Fatalw("failed to build pools and routes", "error", err)
+	}
+	balancing_algorithms.StartHealthCheck(bgCtx, upstreams.Pools, time.Second*5, logger, recorder)
+	auditor := audit.NewAuditor(dbRepo, logger)
+
+	proxyService := service.NewProxyService(upstreams, logger, recorder)
+	statusService := service.NewStatusService(upstreams, logger)
+	backendService := service.NewBackendService(upstreams, auditor, logger)
+
+	auditService := service.NewAuditService(dbRepo, logger)
+
+	var distributed *rate_limit.DistributedConfig
+	if cfg.RateLimit.Mode == config.RateLimitModeDistributed {
+		distributed = &rate_limit.DistributedConfig{LeaseSize: cfg.RateLimit.LeaseSize, LeaseTTL: cfg.RateLimit.LeaseTTL}
+		logger.Infow("distributed rate limiting enabled", "leaseSize", cfg.RateLimit.LeaseSize, "leaseTTL", cfg.RateLimit.LeaseTTL)
+	}
+	tokenBucket := rate_limit.NewTokenBucket(dbRepo, logger, recorder, distributed)
+	runBackground(func(ctx context.Context) { tokenBucket.StartBackgroundSync(ctx, dbRepo, time.Second*7) })
+	runBackground(func(ctx context.Context) { tokenBucket.StartBackgroundSync(ctx, dbRepo, time.Minute) })
+	runBackground(func(ctx context.Context) { tokenBucket.ReplenishAll(ctx, time.Second*5) })
+
+	policies := rate_limit.NewPolicies(dbRepo, logger)
+	if err := policies.Reload(ctx); err != nil {
+		logger.Errorw("failed to load rate limit policies, will retry in background", "error", err)
+	}
+	runBackground(func(ctx context.Context) { policies.StartRefresh(ctx, cfg.RateLimit.PolicyRefreshInterval) })
+	policyService := service.NewPolicyService(dbRepo, policies, auditor, logger)
+
+	var anonymousTier *rate_limit.Tier
+	if anonymous := cfg.RateLimit.Anonymous; anonymous.Enabled {
+		anonymousTier = &rate_limit.Tier{
+			Capacity:      anonymous.Capacity,
+			RatePerSecond: models.RefillRate(anonymous.Rate, anonymous.RatePeriod),
+			Algorithm:     anonymous.Algorithm,
 		}
-		backends = append(backends, &models.Backend{
-			URL:       url,
-			Available: true,
-			Mu:        sync.Mutex{},
-		})
 	}
+	quotas := rate_limit.NewQuotas(dbRepo, logger)
+	runBackground(func(ctx context.Context) { quotas.StartSync(ctx, cfg.RateLimit.QuotaSyncInterval) })
 
-	balancerFactory := balancing_algorithms.NewBalancerFactory(logger)
-	balancer := balancerFactory.Create(backends, cfg.BalanceStrategy)
-	balancing_algorithms.StartHealthCheck(backends, time.Second*5, logger)
+	limiter := rate_limit.NewDispatcher(dbRepo, tokenBucket, policies, quotas, anonymousTier, logger)
+	runBackground(func(ctx context.Context) { limiter.StartInactiveCleaner(ctx, time.Minute*10, time.Minute) })
+	runBackground(func(ctx context.Context) { limiter.StartClientRefresh(ctx, cfg.RateLimit.ClientRefreshInterval) })
 
-	proxyService := service.NewProxyService(balancer, logger)
+	plans := rate_limit.NewPlans(dbRepo, limiter, logger)
+	if err := plans.Reload(ctx); err != nil {
+		logger.Errorw("failed to load rate limit plans, will retry in background", "error", err)
+	}
+	runBackground(func(ctx context.Context) { plans.StartRefresh(ctx, cfg.RateLimit.PlanRefreshInterval) })
+	planService := service.NewPlanService(dbRepo, plans, auditor, logger)
 
-	clientService := service.NewClientService(dbRepo, logger)
+	allowLegacyKeys := *cfg.RateLimit.AllowLegacyClientIDKeys
+	keyResolver := apikey.NewResolver(dbRepo, cfg.RateLimit.APIKeyCacheTTL, allowLegacyKeys)
+	apiKeyService := service.NewAPIKeyService(dbRepo, keyResolver, auditor, logger)
+	if allowLegacyKeys {
+		logger.Warnw("DEPRECATED: legacy client_id keys are accepted in X-API-KEY; issue API keys to all clients " +
+			"and set allow_legacy_client_id_keys to false, the default will change in a future release")
+	}
 
-	tokenBucket := rate_limit.NewTokenBucket(dbRepo, logger)
-	go tokenBucket.StartBackgroundSync(context.Background(), dbRepo, time.Second*7)
-	go tokenBucket.StartBackgroundSync(context.Background(), dbRepo, time.Minute)
-	go tokenBucket.ReplenishAll(context.Background(), time.Second*5)
+	clientService := service.NewClientService(dbRepo, limiter, auditor, logger)
 
-	rateLimiter := middleware.NewRateLimitMiddleware(tokenBucket, dbRepo)
+	costRoutes := make([]rate_limit.CostRoute, 0, len(cfg.RateLimit.Cost.Routes))
+	for _, route := range cfg.RateLimit.Cost.Routes {
+		costRoutes = append(costRoutes, rate_limit.CostRoute{
+			Method:     route.Method,
+			PathPrefix: route.PathPrefix,
+			Cost:       route.Cost,
+		})
+	}
+	costTrusted, err := identity.ParseTrustedProxies(cfg.RateLimit.Cost.TrustedProxies)
+	if err != nil {
+		logger.Fatalw("invalid rate limit cost trusted proxies", "error", err)
+	}
+	costs := rate_limit.NewCostRules(rate_limit.CostConfig{
+		Routes:           costRoutes,
+		Header:           cfg.RateLimit.Cost.Header,
+		MaxHeaderCost:    cfg.RateLimit.Cost.MaxHeaderCost,
+		TrustedProxies:   costTrusted,
+		BodyBytesPerUnit: cfg.RateLimit.Cost.BodyBytesPerUnit,
+		ResponseHeader:   cfg.RateLimit.Cost.ResponseHeader,
+	})
 
-	server.RegisterRoutes(proxyService, clientService, rateLimiter)
+	identitySources := make([]identity.SourceConfig, 0, len(cfg.RateLimit.Identity.Sources))
+	for _, source := range cfg.RateLimit.Identity.Sources {
+		identitySources = append(identitySources, identity.SourceConfig{
+			Type:           source.Type,
+			Header:         source.Header,
+			Param:          source.Param,
+			Claim:          source.Claim,
+			JWKSFile:       source.JWKSFile,
+			Issuer:         source.Issuer,
+			Audience:       source.Audience,
+			Field:          source.Field,
+			IPv4Prefix:     source.IPv4Prefix,
+			IPv6Prefix:     source.IPv6Prefix,
+			TrustedProxies: source.TrustedProxies,
+		})
+	}
+	identities, err := identity.NewExtractor(identity.Config{
+		Sources:   identitySources,
+		Combine:   cfg.RateLimit.Identity.Combine,
+		Separator: cfg.RateLimit.Identity.Separator,
+	}, keyResolver)
+	if err != nil {
+		logger.Fatalw("failed to configure client identification", "error", err)
+	}
+
+	var anonymousIdentities *identity.Extractor
+	if anonymous := cfg.RateLimit.Anonymous; anonymous.Enabled {
+		anonymousIdentities, err = identity.NewExtractor(identity.Config{Sources: []identity.SourceConfig{{
+			Type:           identity.SourceIP,
+			IPv4Prefix:     anonymous.IPv4Prefix,
+			IPv6Prefix:     anonymous.IPv6Prefix,
+			TrustedProxies: anonymous.TrustedProxies,
+		}}}, nil)
+		if err != nil {
+			logger.Fatalw("failed to configure anonymous rate limit", "error", err)
+		}
+	}
+
+	rateLimiter := middleware.NewRateLimitMiddleware(limiter, identities, recorder, middleware.RateLimitOptions{
+		Headers:       cfg.RateLimit.Headers,
+		Costs:         costs,
+		ForwardHeader: cfg.RateLimit.Identity.ForwardHeader,
+		Anonymous:     anonymousIdentities,
+		FailOpen:      cfg.RateLimit.OnError == "allow",
+	}, logger)
+
+	var accessLogMiddleware *middleware.AccessLogMiddleware
+	if cfg.AccessLog.Enabled {
+		accessLog, err := accesslog.NewLogger(accesslog.Config{
+			Format:     cfg.AccessLog.Format,
+			Template:   cfg.AccessLog.Template,
+			Output:     cfg.AccessLog.Output,
+			MaxSizeMB:  cfg.AccessLog.MaxSizeMB,
+			MaxBackups: cfg.AccessLog.MaxBackups,
+			MaxAgeDays: cfg.AccessLog.MaxAgeDays,
+			Compress:   cfg.AccessLog.Compress,
+			SampleRate: cfg.AccessLog.SampleRate,
+		})
+		if err != nil {
+			logger.Fatalw("failed to create access log", "error", err)
+		}
+		defer accessLog.Close()
+		trusted, err := identity.ParseTrustedProxies(cfg.AccessLog.TrustedProxies)
+		if err != nil {
+			logger.Fatalw("invalid access log trusted proxies", "error", err)
+		}
+		accessLogMiddleware = middleware.NewAccessLogMiddleware(accessLog, trusted, logger)
+	}
 
-	srv := server.NewServer(
+	srv, err := server.NewServer(
 		logger,
 		cfg.Port,
+		cfg.TLS,
+		cfg.Admin,
 	)
+	if err != nil {
+		logger.Fatalw("failed to create server", "error", err)
+	}
+
+	adminAuth, err := newAdminAuthenticator(cfg.Admin.Auth)
+	if err != nil {
+		logger.Fatalw("failed to configure admin authentication", "error", err)
+	}
+	if !adminAuth.Enabled() {
+		logger.Warnw("admin API authentication is disabled by admin.auth.disabled", "address", cfg.Admin.Address)
+	}
+	runBackground(func(ctx context.Context) { watchConfig(ctx, cfg, upstreams, adminAuth, auditor, logger) })
+	healthService := service.NewHealthService(dbRepo, upstreams, srv.ShuttingDown, logger)
+
+	proxyRouter := server.NewProxyRouter(proxyService, rateLimiter, accessLogMiddleware)
+	adminRouter := server.NewAdminRouter(server.AdminHandlers{
+		Clients:     clientService,
+		APIKeys:     apiKeyService,
+		Policies:    policyService,
+		Plans:       planService,
+		Status:      statusService,
+		Backends:    backendService,
+		Audit:       auditService,
+		Health:      healthService,
+		MetricsPath: cfg.Metrics.Path,
+		Metrics:     promMetrics.Handler(),
+	}, middleware.NewAdminAuthMiddleware(adminAuth, logger))
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- srv.Start(proxyRouter, adminRouter)
+	}()
+
+	select {
+	case err := <-serverErr:
+		if err != nil {
+			logger.Fatalw("failed to start server", "error", err)
+		}
+		return
+	case <-ctx.Done():
+	}
+
+	// Порядок остановки: сначала инстанс перестаёт быть готовым и перестаёт принимать соединения, затем дожидается
+	// текущих запросов, останавливает фоновые задачи, сохраняет токены и расход квот в БД и закрывает пул соединений.
+	logger.Infow("shutdown started", "delay", cfg.Shutdown.Delay, "timeout", cfg.Shutdown.Timeout)
+	srv.MarkShuttingDown()
+	time.Sleep(cfg.Shutdown.Delay)
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.Shutdown.Timeout)
+	defer cancelShutdown()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Errorw("failed to finish in-flight requests before deadline", "error", err)
+	}
+
+	cancelBackground()
+	background.Wait()
+
+	tokenBucket.Sync()
+	if err := quotas.Sync(context.Background()); err != nil {
+		logger.Errorw("failed to save quota usage", "error", err)
+	}
+	dbRepo.Close()
+
+	stopMetrics()
+	metricsDone.Wait()
+	logger.Infow("shutdown completed")
+}
+
+// watchConfig — перечитывает конфигурацию по SIGHUP или при изменении файла и применяет изменения пулов, стратегий,
+// маршрутов и токенов админского API без перезапуска. Некорректная конфигурация отклоняется, и продолжает работать
+// текущая.
+func watchConfig(ctx context.Context, current *config.Config, upstreams *upstream.Manager,
+	adminAuth *auth.Authenticator, auditor *audit.Auditor, logger *zap.SugaredLogger) {
+	reloads, err := config.Watch(ctx, *configPath, logger)
+	if err != nil {
+		logger.Errorw("failed to watch config file, reload is available only on restart", "error", err)
+		return
+	}
+
+	for reason := range reloads {
+		next, err := config.LoadConfig(*configPath)
+		if err != nil {
+			logger.Errorw("config reload rejected, keeping running config", "reason", reason, "error", err)
+			continue
+		}
+		for _, warning := range next.Warnings {
+			logger.Warnw("config warning", "warning", warning)
+		}
+
+		diff, err := upstreams.Apply(next)
+		if err != nil {
+			logger.Errorw("config reload rejected, keeping running config", "reason", reason, "error", err)
+			continue
+		}
+
+		tokens, certs := adminCredentials(next.Admin.Auth)
+		if err := adminAuth.Reload(tokens, certs); err != nil {
+			logger.Errorw("admin credentials reload rejected, keeping running credentials", "reason", reason,
+				"error", err)
+		}
 
-	logger.Infow("Starting server", "port", cfg.Port)
-	if err := srv.Start(); err != nil {
-		logger.Fatalw("failed to start server", "error", err)
+		if sections := config.RestartRequired(current, next); len(sections) > 0 {
+			logger.Warnw("config sections changed that require restart to take effect", "sections", sections)
+		}
+		current = next
+
+		if diff.Empty() {
+			logger.Infow("config reloaded, no changes in pools and routes", "reason", reason)
+			continue
+		}
+		logger.Infow("config reloaded", "reason", reason, "changes", diff)
+		auditor.Record(ctx, audit.Actor{Name: audit.SystemActor}, audit.ActionConfigReload, audit.TargetConfig, *configPath,
+			nil, map[string]any{"reason": reason, "changes": diff})
+	}
+}
+
+// newAdminAuthenticator — переводит секцию admin.auth конфигурации в аутентификатор админского API.
+func newAdminAuthenticator(cfg config.AdminAuth) (*auth.Authenticator, error) {
+	if cfg.Disabled {
+		return auth.NewDisabledAuthenticator(), nil
+	}
+	return auth.NewAuthenticator(adminCredentials(cfg))
+}
+
+// adminCredentials — токены и правила для клиентских сертификатов из секции admin.auth.
+func adminCredentials(cfg config.AdminAuth) ([]auth.TokenConfig, []auth.CertConfig) {
+	tokens := make([]auth.TokenConfig, 0, len(cfg.Tokens))
+	for _, t := range cfg.Tokens {
+		tokens = append(tokens, auth.TokenConfig{Name: t.Name, Token: t.Token, TokenFile: t.TokenFile, Role: t.Role})
+	}
+	certs := make([]auth.CertConfig, 0, len(cfg.ClientCerts))
+	for _, c := range cfg.ClientCerts {
+		certs = append(certs, auth.CertConfig{Subject: c.Subject, Role: c.Role})
 	}
+	return tokens, certs
 }
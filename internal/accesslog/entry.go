@@ -0,0 +1,47 @@
+package accesslog
+
+import (
+	"context"
+	"time"
+)
+
+type contextKey struct{}
+
+// Entry — одна запись access-лога. Поля заполняются по мере прохождения запроса: middleware рейт-лимита записывает
+// клиента и решение, прокси — выбранный бэкенд и время ответа апстрима. Retries — число повторов запроса на другом
+// бэкенде; прокси пока не повторяет запросы, поэтому оно всегда 0.
+type Entry struct {
+	Time              time.Time
+	RequestID         string
+	ClientID          string
+	IdentitySource    string
+	RemoteIP          string
+	Method            string
+	Host              string
+	Path              string
+	Proto             string
+	Referer           string
+	UserAgent         string
+	Status            int
+	BytesIn           int64
+	BytesOut          int64
+	UpstreamBackend   string
+	UpstreamLatency   time.Duration
+	TotalLatency      time.Duration
+	Retries           int
+	RateLimitDecision string
+}
+
+// WithEntry — возвращает контекст, в котором хранится запись access-лога текущего запроса.
+func WithEntry(ctx context.Context, entry *Entry) context.Context {
+	return context.WithValue(ctx, contextKey{}, entry)
+}
+
+// FromContext — возвращает запись access-лога текущего запроса. Если access-лог выключен, возвращается пустая запись,
+// чтобы вызывающему коду не приходилось проверять её на nil.
+func FromContext(ctx context.Context) *Entry {
+	if entry, ok := ctx.Value(contextKey{}).(*Entry); ok {
+		return entry
+	}
+	return &Entry{}
+}
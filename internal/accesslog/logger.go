@@ -0,0 +1,198 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Поддерживаемые форматы access-лога.
+const (
+	FormatJSON     = "json"
+	FormatCombined = "combined"
+	FormatTemplate = "template"
+)
+
+const combinedTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// Config — параметры access-лога: формат, вывод, ротация файла и семплирование успешных запросов.
+type Config struct {
+	Format     string
+	Template   string
+	Output     string
+	MaxSizeMB  int
+	MaxBackups int
+	MaxAgeDays int
+	Compress   bool
+	SampleRate float64
+}
+
+type Logger struct {
+	mu         sync.Mutex
+	out        io.Writer
+	closer     io.Closer
+	format     string
+	tmpl       *template.Template
+	sampleRate float64
+}
+
+// NewLogger — создаёт access-логгер. Output "stdout" (или пустой) пишет в стандартный вывод, любое другое значение
+// считается путём к файлу, который ротируется по размеру.
+func NewLogger(cfg Config) (*Logger, error) {
+	l := &Logger{
+		format:     cfg.Format,
+		sampleRate: cfg.SampleRate,
+	}
+
+	switch cfg.Format {
+	case "", FormatJSON:
+		l.format = FormatJSON
+	case FormatCombined:
+	case FormatTemplate:
+		tmpl, err := template.New("access_log").Parse(cfg.Template)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse access log template")
+		}
+		l.tmpl = tmpl
+	default:
+		return nil, errors.Errorf("unknown access log format %q", cfg.Format)
+	}
+
+	if cfg.Output == "" || cfg.Output == "stdout" {
+		l.out = os.Stdout
+	} else {
+		file := &lumberjack.Logger{
+			Filename:   cfg.Output,
+			MaxSize:    cfg.MaxSizeMB,
+			MaxBackups: cfg.MaxBackups,
+			MaxAge:     cfg.MaxAgeDays,
+			Compress:   cfg.Compress,
+		}
+		l.out = file
+		l.closer = file
+	}
+
+	return l, nil
+}
+
+// Log — форматирует и записывает запись. Успешные ответы (статус ниже 400) пишутся с вероятностью SampleRate,
+// ошибки пишутся всегда.
+func (l *Logger) Log(entry *Entry) error {
+	if entry.Status < 400 && l.sampleRate < 1 && rand.Float64() >= l.sampleRate {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	switch l.format {
+	case FormatJSON:
+		if err := json.NewEncoder(&buf).Encode(newJSONEntry(entry)); err != nil {
+			return errors.Wrap(err, "failed to encode access log entry")
+		}
+	case FormatCombined:
+		writeCombined(&buf, entry)
+	case FormatTemplate:
+		if err := l.tmpl.Execute(&buf, entry); err != nil {
+			return errors.Wrap(err, "failed to execute access log template")
+		}
+		if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := l.out.Write(buf.Bytes())
+	return err
+}
+
+// Close — закрывает файл лога, если вывод идёт в файл.
+func (l *Logger) Close() error {
+	if l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+type jsonEntry struct {
+	Time              string  `json:"time"`
+	RequestID         string  `json:"request_id"`
+	ClientID          string  `json:"client_id,omitempty"`
+	IdentitySource    string  `json:"identity_source,omitempty"`
+	RemoteIP          string  `json:"remote_ip"`
+	Method            string  `json:"method"`
+	Host              string  `json:"host"`
+	Path              string  `json:"path"`
+	Status            int     `json:"status"`
+	BytesIn           int64   `json:"bytes_in"`
+	BytesOut          int64   `json:"bytes_out"`
+	UpstreamBackend   string  `json:"upstream_backend,omitempty"`
+	UpstreamLatencyMs float64 `json:"upstream_latency_ms"`
+	TotalLatencyMs    float64 `json:"total_latency_ms"`
+	Retries           int     `json:"retries"`
+	RateLimitDecision string  `json:"rate_limit_decision,omitempty"`
+}
+
+func newJSONEntry(e *Entry) jsonEntry {
+	return jsonEntry{
+		Time:              e.Time.Format("2006-01-02T15:04:05.000Z07:00"),
+		RequestID:         e.RequestID,
+		ClientID:          e.ClientID,
+		IdentitySource:    e.IdentitySource,
+		RemoteIP:          e.RemoteIP,
+		Method:            e.Method,
+		Host:              e.Host,
+		Path:              e.Path,
+		Status:            e.Status,
+		BytesIn:           e.BytesIn,
+		BytesOut:          e.BytesOut,
+		UpstreamBackend:   e.UpstreamBackend,
+		UpstreamLatencyMs: float64(e.UpstreamLatency.Microseconds()) / 1000,
+		TotalLatencyMs:    float64(e.TotalLatency.Microseconds()) / 1000,
+		Retries:           e.Retries,
+		RateLimitDecision: e.RateLimitDecision,
+	}
+}
+
+// writeCombined — пишет запись в формате Apache combined. В поле пользователя подставляется ID клиента.
+func writeCombined(buf *bytes.Buffer, e *Entry) {
+	buf.WriteString(dashIfEmpty(e.RemoteIP))
+	buf.WriteString(" - ")
+	buf.WriteString(dashIfEmpty(e.ClientID))
+	buf.WriteString(" [")
+	buf.WriteString(e.Time.Format(combinedTimeLayout))
+	buf.WriteString(`] "`)
+	buf.WriteString(e.Method + " " + e.Path + " " + e.Proto)
+	buf.WriteString(`" `)
+	buf.WriteString(strconv.Itoa(e.Status))
+	buf.WriteByte(' ')
+	if e.BytesOut == 0 {
+		buf.WriteByte('-')
+	} else {
+		buf.WriteString(strconv.FormatInt(e.BytesOut, 10))
+	}
+	buf.WriteString(` "`)
+	buf.WriteString(escapeQuotes(dashIfEmpty(e.Referer)))
+	buf.WriteString(`" "`)
+	buf.WriteString(escapeQuotes(dashIfEmpty(e.UserAgent)))
+	buf.WriteString("\"\n")
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func escapeQuotes(s string) string {
+	return strings.ReplaceAll(s, `"`, `\"`)
+}
@@ -0,0 +1,65 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"load-balancer/internal/models"
+)
+
+// keyPrefix — с чего начинается каждый ключ. Позволяет отличить ключ балансировщика от других секретов, например
+// при поиске утечек в репозиториях.
+const keyPrefix = "lb_"
+
+const (
+	lookupBytes = 6
+	secretBytes = 32
+)
+
+// Generate — создаёт новый ключ клиента. Возвращает сам ключ, который нужно один раз отдать клиенту, и запись для
+// хранения, в которой есть только префикс для поиска и хэш.
+func Generate(clientID string, now time.Time) (string, models.APIKey, error) {
+	lookup := make([]byte, lookupBytes)
+	secret := make([]byte, secretBytes)
+	if _, err := rand.Read(lookup); err != nil {
+		return "", models.APIKey{}, errors.Wrap(err, "failed to generate api key")
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", models.APIKey{}, errors.Wrap(err, "failed to generate api key")
+	}
+
+	prefix := hex.EncodeToString(lookup)
+	raw := keyPrefix + prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+
+	return raw, models.APIKey{
+		Prefix:    prefix,
+		ClientID:  clientID,
+		Hash:      Hash(raw),
+		CreatedAt: now,
+	}, nil
+}
+
+// Parse — извлекает из ключа префикс для поиска. Возвращает false, если строка не похожа на ключ балансировщика.
+func Parse(raw string) (string, bool) {
+	rest, ok := strings.CutPrefix(raw, keyPrefix)
+	if !ok {
+		return "", false
+	}
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !ok || len(prefix) != 2*lookupBytes || secret == "" {
+		return "", false
+	}
+	return prefix, true
+}
+
+// Hash — хэш ключа для хранения. Ключ содержит 256 бит случайных данных, поэтому медленная функция хэширования не
+// нужна: подобрать ключ по хэшу SHA-256 невозможно.
+func Hash(raw string) []byte {
+	sum := sha256.Sum256([]byte(raw))
+	return sum[:]
+}
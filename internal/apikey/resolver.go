@@ -0,0 +1,167 @@
+package apikey
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"load-balancer/internal/models"
+	"load-balancer/internal/repo"
+)
+
+var (
+	ErrInvalidKey = errors.New("malformed api key")
+	ErrUnknownKey = errors.New("unknown api key")
+	ErrKeyRevoked = errors.New("api key revoked")
+	ErrKeyExpired = errors.New("api key expired")
+)
+
+type cachedKey struct {
+	clientID    string
+	expiresAt   *time.Time
+	cachedUntil time.Time
+}
+
+// maxLegacyEntries — сколько решений по client_id без ключа хранится в кеше. В заголовке может прийти что угодно,
+// поэтому кеш ограничен: при переполнении из него убираются устаревшие записи, а если их нет, новое решение не
+// кешируется.
+const maxLegacyEntries = 10000
+
+// cachedLegacy — можно ли клиенту обращаться по client_id: да, пока ему не выдан ни один ключ.
+type cachedLegacy struct {
+	allowed     bool
+	cachedUntil time.Time
+}
+
+type Resolver struct {
+	repo        repo.Repository
+	ttl         time.Duration
+	allowLegacy bool
+
+	mu     sync.Mutex
+	cache  map[[sha256.Size]byte]cachedKey
+	legacy map[string]cachedLegacy
+}
+
+// NewResolver — создаёт поиск клиента по API-ключу. Найденные ключи кешируются на ttl, поэтому отзыв ключа на других
+// инстансах вступает в силу не позже чем через ttl. Если allowLegacy, значение, не похожее на ключ, считается
+// ID клиента, как было до появления ключей, но только если клиенту ещё не выдан ни один ключ, даже отозванный;
+// это нужно только на время перевода клиентов на ключи.
+func NewResolver(repo repo.Repository, ttl time.Duration, allowLegacy bool) *Resolver {
+	return &Resolver{
+		repo:        repo,
+		ttl:         ttl,
+		allowLegacy: allowLegacy,
+		cache:       make(map[[sha256.Size]byte]cachedKey),
+		legacy:      make(map[string]cachedLegacy),
+	}
+}
+
+// Resolve — возвращает ID клиента, которому принадлежит ключ. Для неизвестного, отозванного или истёкшего ключа
+// возвращает ErrInvalidKey, ErrUnknownKey, ErrKeyRevoked или ErrKeyExpired; остальные ошибки — ошибки БД.
+func (r *Resolver) Resolve(ctx context.Context, raw string) (string, error) {
+	return r.resolve(ctx, raw, time.Now())
+}
+
+func (r *Resolver) resolve(ctx context.Context, raw string, now time.Time) (string, error) {
+	prefix, ok := Parse(raw)
+	if !ok {
+		if r.allowLegacy {
+			return r.resolveLegacy(ctx, raw, now)
+		}
+		return "", ErrInvalidKey
+	}
+
+	hash := sha256.Sum256([]byte(raw))
+
+	r.mu.Lock()
+	cached, ok := r.cache[hash]
+	if ok && now.After(cached.cachedUntil) {
+		delete(r.cache, hash)
+		ok = false
+	}
+	r.mu.Unlock()
+
+	if ok {
+		if cached.expiresAt != nil && !now.Before(*cached.expiresAt) {
+			return "", ErrKeyExpired
+		}
+		return cached.clientID, nil
+	}
+
+	key, err := r.repo.GetAPIKey(ctx, prefix)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to look up api key")
+	}
+	if key == nil || subtle.ConstantTimeCompare(hash[:], key.Hash) != 1 {
+		return "", ErrUnknownKey
+	}
+
+	switch key.State(now) {
+	case models.APIKeyRevoked:
+		return "", ErrKeyRevoked
+	case models.APIKeyExpired:
+		return "", ErrKeyExpired
+	}
+
+	r.mu.Lock()
+	r.cache[hash] = cachedKey{clientID: key.ClientID, expiresAt: key.ExpiresAt, cachedUntil: now.Add(r.ttl)}
+	r.mu.Unlock()
+
+	return key.ClientID, nil
+}
+
+// resolveLegacy — принимает client_id вместо ключа, если клиенту не выдано ни одного ключа. Иначе client_id знает
+// каждый, кто видел клиента в логах или в админском API, и мог бы выдавать себя за него.
+func (r *Resolver) resolveLegacy(ctx context.Context, clientID string, now time.Time) (string, error) {
+	r.mu.Lock()
+	cached, ok := r.legacy[clientID]
+	if ok && now.After(cached.cachedUntil) {
+		delete(r.legacy, clientID)
+		ok = false
+	}
+	r.mu.Unlock()
+
+	if !ok {
+		keys, err := r.repo.ListAPIKeys(ctx, clientID)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to look up client api keys")
+		}
+		cached = cachedLegacy{allowed: len(keys) == 0, cachedUntil: now.Add(r.ttl)}
+
+		r.mu.Lock()
+		if len(r.legacy) >= maxLegacyEntries {
+			for id, entry := range r.legacy {
+				if now.After(entry.cachedUntil) {
+					delete(r.legacy, id)
+				}
+			}
+		}
+		if len(r.legacy) < maxLegacyEntries {
+			r.legacy[clientID] = cached
+		}
+		r.mu.Unlock()
+	}
+
+	if !cached.allowed {
+		return "", ErrInvalidKey
+	}
+	return clientID, nil
+}
+
+// InvalidateClient — убирает из кеша все ключи клиента, чтобы выдача, отзыв или ротация сразу применились на этом
+// инстансе.
+func (r *Resolver) InvalidateClient(clientID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.legacy, clientID)
+	for hash, cached := range r.cache {
+		if cached.clientID == clientID {
+			delete(r.cache, hash)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"load-balancer/internal/models"
+	"load-balancer/internal/repo"
+)
+
+// fakeRepo — хранит ключи в памяти и считает обращения к ним; остальные методы тестам не нужны.
+type fakeRepo struct {
+	repo.Repository
+	keys    map[string]*models.APIKey
+	lookups int
+}
+
+func (f *fakeRepo) GetAPIKey(_ context.Context, prefix string) (*models.APIKey, error) {
+	f.lookups++
+	key, ok := f.keys[prefix]
+	if !ok {
+		return nil, nil
+	}
+	copied := *key
+	return &copied, nil
+}
+
+func (f *fakeRepo) ListAPIKeys(_ context.Context, clientID string) ([]*models.APIKey, error) {
+	f.lookups++
+	var keys []*models.APIKey
+	for _, key := range f.keys {
+		if key.ClientID == clientID {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// issue — выдаёт клиенту ключ и возвращает его вместе с записью в fakeRepo.
+func (f *fakeRepo) issue(t *testing.T, clientID string, now time.Time) (string, *models.APIKey) {
+	t.Helper()
+	raw, key, err := Generate(clientID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.keys[key.Prefix] = &key
+	return raw, &key
+}
+
+func TestResolve(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	db := &fakeRepo{keys: make(map[string]*models.APIKey)}
+
+	active, _ := db.issue(t, "acme", now)
+	revoked, revokedKey := db.issue(t, "acme", now)
+	revokedKey.RevokedAt = &now
+	expired, expiredKey := db.issue(t, "acme", now)
+	expiredKey.ExpiresAt = &now
+	_, revokedOnly := db.issue(t, "revoked-only", now)
+	revokedOnly.RevokedAt = &now
+	unknown, _, _ := Generate("acme", now)
+
+	tests := []struct {
+		name        string
+		raw         string
+		allowLegacy bool
+		want        string
+		wantErr     error
+	}{
+		{name: "active key", raw: active, want: "acme"},
+		{name: "revoked key", raw: revoked, wantErr: ErrKeyRevoked},
+		{name: "expired key", raw: expired, wantErr: ErrKeyExpired},
+		{name: "unknown key", raw: unknown, wantErr: ErrUnknownKey},
+		{name: "client id without legacy mode", raw: "legacy", wantErr: ErrInvalidKey},
+		{name: "legacy client without keys", raw: "legacy", allowLegacy: true, want: "legacy"},
+		{name: "legacy fallback for client with keys", raw: "acme", allowLegacy: true, wantErr: ErrInvalidKey},
+		{name: "legacy fallback for client with revoked keys", raw: "revoked-only", allowLegacy: true, wantErr: ErrInvalidKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewResolver(db, time.Minute, tt.allowLegacy)
+			got, err := r.resolve(context.Background(), tt.raw, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("resolve() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolve() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveCache(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	db := &fakeRepo{keys: make(map[string]*models.APIKey)}
+	raw, key := db.issue(t, "acme", now)
+	r := NewResolver(db, time.Minute, true)
+
+	resolve := func(raw string, at time.Time) error {
+		t.Helper()
+		_, err := r.resolve(context.Background(), raw, at)
+		return err
+	}
+
+	if err := resolve(raw, now); err != nil {
+		t.Fatal(err)
+	}
+	key.RevokedAt = &now
+	if err := resolve(raw, now.Add(30*time.Second)); err != nil || db.lookups != 1 {
+		t.Fatalf("cached key: error = %v, lookups = %d; want cached result", err, db.lookups)
+	}
+	if err := resolve(raw, now.Add(61*time.Second)); !errors.Is(err, ErrKeyRevoked) {
+		t.Errorf("after ttl: error = %v, want ErrKeyRevoked", err)
+	}
+
+	if err := resolve("beta", now); err != nil {
+		t.Fatalf("legacy client without keys: %v", err)
+	}
+	db.issue(t, "beta", now)
+	if err := resolve("beta", now.Add(time.Second)); err != nil {
+		t.Fatalf("cached legacy decision: %v", err)
+	}
+	r.InvalidateClient("beta")
+	if err := resolve("beta", now.Add(time.Second)); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("legacy after key issued and InvalidateClient: error = %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestInvalidateClient(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	db := &fakeRepo{keys: make(map[string]*models.APIKey)}
+	acme, acmeKey := db.issue(t, "acme", now)
+	other, _ := db.issue(t, "other", now)
+	r := NewResolver(db, time.Hour, false)
+
+	for _, raw := range []string{acme, other} {
+		if _, err := r.resolve(context.Background(), raw, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	acmeKey.RevokedAt = &now
+	r.InvalidateClient("acme")
+
+	if _, err := r.resolve(context.Background(), acme, now); !errors.Is(err, ErrKeyRevoked) {
+		t.Errorf("invalidated key: error = %v, want ErrKeyRevoked", err)
+	}
+	lookups := db.lookups
+	if _, err := r.resolve(context.Background(), other, now); err != nil || db.lookups != lookups {
+		t.Errorf("key of another client: error = %v, lookups %d -> %d; want it to stay cached", err, lookups, db.lookups)
+	}
+}
@@ -0,0 +1,119 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"load-balancer/internal/auth"
+	"load-balancer/internal/models"
+	"load-balancer/internal/repo"
+)
+
+// Действия, которые попадают в журнал.
+const (
+	ActionClientCreate   = "client.create"
+	ActionClientUpdate   = "client.update"
+	ActionClientDelete   = "client.delete"
+	ActionClientImport   = "client.import"
+	ActionClientStatus   = "client.status"
+	ActionClientQuotas   = "client.quotas"
+	ActionAPIKeyIssue    = "api_key.issue"
+	ActionAPIKeyRotate   = "api_key.rotate"
+	ActionAPIKeyRevoke   = "api_key.revoke"
+	ActionPolicyCreate   = "policy.create"
+	ActionPolicyUpdate   = "policy.update"
+	ActionPolicyDelete   = "policy.delete"
+	ActionPlanCreate     = "plan.create"
+	ActionPlanUpdate     = "plan.update"
+	ActionPlanDelete     = "plan.delete"
+	ActionBackendAdd     = "backend.add"
+	ActionBackendRemove  = "backend.remove"
+	ActionBackendDisable = "backend.disable"
+	ActionBackendEnable  = "backend.enable"
+	ActionBackendDrain   = "backend.drain"
+	ActionConfigReload   = "config.reload"
+)
+
+// Типы объектов, над которыми выполняются действия.
+const (
+	TargetClient  = "client"
+	TargetBackend = "backend"
+	TargetConfig  = "config"
+	TargetPolicy  = "policy"
+	TargetPlan    = "plan"
+)
+
+// SystemActor — от чьего имени пишутся изменения, которые сделал сам балансировщик, например перезагрузка конфигурации.
+const SystemActor = "system"
+
+// Actor — кто и откуда выполнил действие.
+type Actor struct {
+	Name     string
+	SourceIP string
+}
+
+// FromRequest — определяет автора изменения по аутентифицированному вызывающему и адресу запроса.
+func FromRequest(r *http.Request) Actor {
+	actor := Actor{Name: "anonymous", SourceIP: r.RemoteAddr}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		actor.SourceIP = host
+	}
+	if principal := auth.FromContext(r.Context()); principal != nil {
+		actor.Name = principal.Name
+	}
+	return actor
+}
+
+type Auditor struct {
+	repo   repo.Repository
+	logger *zap.SugaredLogger
+}
+
+// NewAuditor — создаёт журнал административных изменений, который хранит записи в БД.
+func NewAuditor(repo repo.Repository, logger *zap.SugaredLogger) *Auditor {
+	return &Auditor{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Record — сохраняет запись о действии над объектом вместе с его состоянием до и после. before или after передаются
+// как nil, если объекта до или после действия не было. Само изменение к этому моменту уже сделано, поэтому ошибка
+// записи его не отменяет, а пишется в лог вместе с содержимым записи, чтобы её можно было восстановить.
+func (a *Auditor) Record(ctx context.Context, actor Actor, action, targetType, target string, before, after any) {
+	record := models.AuditRecord{
+		Actor:      actor.Name,
+		Action:     action,
+		TargetType: targetType,
+		Target:     target,
+		SourceIP:   actor.SourceIP,
+	}
+
+	var err error
+	if record.Before, err = marshal(before); err == nil {
+		record.After, err = marshal(after)
+	}
+	if err == nil {
+		err = a.repo.CreateAuditRecord(context.WithoutCancel(ctx), record)
+	}
+	if err != nil {
+		a.logger.Errorw("failed to write audit record", "error", err, "actor", record.Actor, "action", action,
+			"target_type", targetType, "target", target, "source_ip", record.SourceIP,
+			"before", string(record.Before), "after", string(record.After))
+	}
+}
+
+func marshal(v any) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal audit state")
+	}
+	return data, nil
+}
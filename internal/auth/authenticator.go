@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Способы аутентификации, которые попадают в Principal.Method.
+const (
+	MethodToken    = "token"
+	MethodCert     = "mtls"
+	MethodDisabled = "disabled"
+)
+
+var (
+	ErrNoCredentials      = errors.New("no credentials provided")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// TokenConfig — статический bearer-токен. Токен задаётся напрямую или читается из файла.
+type TokenConfig struct {
+	Name      string
+	Token     string
+	TokenFile string
+	Role      string
+}
+
+// CertConfig — правило сопоставления клиентского сертификата с ролью: по CN субъекта или по одному из SAN.
+type CertConfig struct {
+	Subject string
+	Role    string
+}
+
+type token struct {
+	name string
+	hash [sha256.Size]byte
+	role Role
+}
+
+type certRule struct {
+	subject string
+	role    Role
+}
+
+type Authenticator struct {
+	mu       sync.RWMutex
+	tokens   []token
+	certs    []certRule
+	disabled bool
+}
+
+// NewAuthenticator — создаёт аутентификатор из токенов и правил для клиентских сертификатов. Токены хранятся только
+// в виде хэшей и сравниваются за постоянное время. Без токенов и правил возвращает ошибку: админский API не
+// открывается без аутентификации.
+func NewAuthenticator(tokens []TokenConfig, certs []CertConfig) (*Authenticator, error) {
+	a := &Authenticator{}
+	if err := a.Reload(tokens, certs); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// NewDisabledAuthenticator — аутентификатор для режима admin.auth.disabled: любой запрос получает роль admin.
+// Конфигурация допускает этот режим только на loopback-адресе.
+func NewDisabledAuthenticator() *Authenticator {
+	return &Authenticator{disabled: true}
+}
+
+// Reload — заменяет токены и правила для сертификатов, например после перезагрузки конфигурации; токены из файлов
+// перечитываются. Если в новом наборе ошибка, продолжает действовать старый. Ни отключить, ни включить
+// аутентификацию так нельзя: для этого нужен перезапуск.
+func (a *Authenticator) Reload(tokens []TokenConfig, certs []CertConfig) error {
+	next := &Authenticator{}
+	for _, tc := range tokens {
+		role, ok := ParseRole(tc.Role)
+		if !ok {
+			return errors.Errorf("unknown role %q for token %q", tc.Role, tc.Name)
+		}
+
+		value := tc.Token
+		if tc.TokenFile != "" {
+			data, err := os.ReadFile(tc.TokenFile)
+			if err != nil {
+				return errors.Wrapf(err, "failed to read token file for %q", tc.Name)
+			}
+			value = strings.TrimSpace(string(data))
+		}
+		if value == "" {
+			return errors.Errorf("empty token for %q", tc.Name)
+		}
+
+		next.tokens = append(next.tokens, token{name: tc.Name, hash: sha256.Sum256([]byte(value)), role: role})
+	}
+
+	for _, cc := range certs {
+		role, ok := ParseRole(cc.Role)
+		if !ok {
+			return errors.Errorf("unknown role %q for certificate %q", cc.Role, cc.Subject)
+		}
+		next.certs = append(next.certs, certRule{subject: cc.Subject, role: role})
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.disabled {
+		if next.enabled() {
+			return errors.New("admin authentication cannot be enabled without restart")
+		}
+		return nil
+	}
+	if !next.enabled() {
+		return errors.New("admin authentication requires at least one token or client certificate")
+	}
+	a.tokens, a.certs = next.tokens, next.certs
+	return nil
+}
+
+// Enabled — false только в режиме admin.auth.disabled, когда доступ открыт всем.
+func (a *Authenticator) Enabled() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return !a.disabled
+}
+
+func (a *Authenticator) enabled() bool {
+	return len(a.tokens) > 0 || len(a.certs) > 0
+}
+
+// Authenticate — определяет вызывающего по bearer-токену или по проверенному клиентскому сертификату.
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.disabled {
+		return &Principal{Name: "anonymous", Role: RoleAdmin, Method: MethodDisabled}, nil
+	}
+
+	if header := r.Header.Get("Authorization"); header != "" {
+		value, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			return nil, ErrInvalidCredentials
+		}
+		return a.authenticateToken(value)
+	}
+
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return a.authenticateCert(r.TLS.VerifiedChains[0][0])
+	}
+
+	return nil, ErrNoCredentials
+}
+
+func (a *Authenticator) authenticateToken(value string) (*Principal, error) {
+	hash := sha256.Sum256([]byte(strings.TrimSpace(value)))
+
+	var found *token
+	for i := range a.tokens {
+		if subtle.ConstantTimeCompare(hash[:], a.tokens[i].hash[:]) == 1 {
+			found = &a.tokens[i]
+		}
+	}
+	if found == nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &Principal{Name: found.name, Role: found.role, Method: MethodToken}, nil
+}
+
+func (a *Authenticator) authenticateCert(cert *x509.Certificate) (*Principal, error) {
+	names := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+
+	for _, rule := range a.certs {
+		for _, name := range names {
+			if name != "" && name == rule.subject {
+				return &Principal{Name: name, Role: rule.role, Method: MethodCert}, nil
+			}
+		}
+	}
+	return nil, ErrInvalidCredentials
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthenticate(t *testing.T) {
+	a, err := NewAuthenticator([]TokenConfig{{Name: "ops", Token: "secret", Role: "operator"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		header   string
+		wantRole Role
+		wantErr  error
+	}{
+		{name: "valid token", header: "Bearer secret", wantRole: RoleOperator},
+		{name: "wrong token", header: "Bearer other", wantErr: ErrInvalidCredentials},
+		{name: "not a bearer token", header: "Basic secret", wantErr: ErrInvalidCredentials},
+		{name: "no credentials", wantErr: ErrNoCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/clients", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			principal, err := a.Authenticate(r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && principal.Role != tt.wantRole {
+				t.Errorf("role = %v, want %v", principal.Role, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorFailsClosed(t *testing.T) {
+	if _, err := NewAuthenticator(nil, nil); err == nil {
+		t.Fatal("NewAuthenticator() without credentials succeeded")
+	}
+
+	a, err := NewAuthenticator([]TokenConfig{{Name: "ops", Token: "secret", Role: "admin"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Reload(nil, nil); err == nil {
+		t.Error("Reload() removed all credentials")
+	}
+	if _, err := a.Authenticate(httptest.NewRequest("GET", "/", nil)); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("Authenticate() error = %v after rejected reload, want ErrNoCredentials", err)
+	}
+
+	disabled := NewDisabledAuthenticator()
+	if err := disabled.Reload([]TokenConfig{{Name: "ops", Token: "secret", Role: "admin"}}, nil); err == nil {
+		t.Error("Reload() enabled authentication without restart")
+	}
+	principal, err := disabled.Authenticate(httptest.NewRequest("GET", "/", nil))
+	if err != nil || principal.Method != MethodDisabled {
+		t.Errorf("Authenticate() = %+v, %v; want anonymous principal", principal, err)
+	}
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+)
+
+// Role — роль в админском API. Роли упорядочены: каждая следующая включает права предыдущей.
+type Role int
+
+const (
+	RoleViewer Role = iota + 1
+	RoleOperator
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleViewer:   "viewer",
+	RoleOperator: "operator",
+	RoleAdmin:    "admin",
+}
+
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Allows — true, если роли достаточно для действия, требующего роль required.
+func (r Role) Allows(required Role) bool {
+	return r >= required
+}
+
+// ParseRole — разбирает название роли из конфигурации.
+func ParseRole(name string) (Role, bool) {
+	for role, roleName := range roleNames {
+		if roleName == name {
+			return role, true
+		}
+	}
+	return 0, false
+}
+
+// Principal — аутентифицированный вызывающий админского API.
+type Principal struct {
+	Name   string
+	Role   Role
+	Method string
+}
+
+type contextKey struct{}
+
+// WithPrincipal — возвращает контекст, в котором хранится вызывающий.
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, principal)
+}
+
+// FromContext — возвращает вызывающего из контекста или nil, если запрос не проходил аутентификацию.
+func FromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(contextKey{}).(*Principal)
+	return principal
+}
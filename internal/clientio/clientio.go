@@ -0,0 +1,264 @@
+package clientio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"load-balancer/internal/apikey"
+	"load-balancer/internal/audit"
+	"load-balancer/internal/models"
+	"load-balancer/internal/repo"
+)
+
+// Режимы импорта.
+const (
+	// ModeUpsert — создаёт новых клиентов и обновляет лимиты и метки существующих.
+	ModeUpsert = "upsert"
+	// ModeCreate — только создаёт клиентов; строка с уже существующим ID считается ошибкой.
+	ModeCreate = "create"
+)
+
+// exportBatchSize — сколько клиентов читается из БД за раз при экспорте.
+const exportBatchSize = 500
+
+// InputError — ошибка в самом файле или параметрах импорта, а не в работе с БД.
+type InputError struct {
+	err error
+}
+
+func (e *InputError) Error() string { return e.err.Error() }
+
+func (e *InputError) Unwrap() error { return e.err }
+
+// ImportOptions — параметры импорта.
+type ImportOptions struct {
+	Format string
+	Mode   string
+	DryRun bool
+}
+
+// RowError — ошибка в конкретной строке файла импорта.
+type RowError struct {
+	Line     int    `json:"line"`
+	ClientID string `json:"client_id,omitempty"`
+	Error    string `json:"error"`
+}
+
+// ImportReport — результат импорта. Если в файле есть ошибки, не записывается ни одна строка, а Errors содержит
+// все найденные ошибки. При DryRun Created и Updated показывают, сколько клиентов было бы создано и обновлено.
+// APIKeys — ключи созданных клиентов; они возвращаются только здесь, в БД хранятся лишь их хэши.
+type ImportReport struct {
+	DryRun  bool        `json:"dry_run"`
+	Mode    string      `json:"mode"`
+	Total   int         `json:"total"`
+	Created int64       `json:"created"`
+	Updated int64       `json:"updated"`
+	Errors  []RowError  `json:"errors,omitempty"`
+	APIKeys []IssuedKey `json:"api_keys,omitempty"`
+
+	// Changes — записанные клиенты с их прежним состоянием, чтобы вызывающий мог сбросить кеш и записать изменения
+	// в журнал.
+	Changes []ClientChange `json:"-"`
+}
+
+// IssuedKey — API-ключ, выданный клиенту, которого создал импорт.
+type IssuedKey struct {
+	ClientID string `json:"client_id"`
+	APIKey   string `json:"api_key"`
+	Prefix   string `json:"key_prefix"`
+}
+
+// ClientChange — клиент, созданный или обновлённый импортом. Before — nil для нового клиента.
+type ClientChange struct {
+	ClientID string
+	Before   *models.RateLimitClient
+	After    models.RateLimitClient
+}
+
+// Import — читает клиентов из файла, проверяет каждую строку и, если ошибок нет и это не пробный запуск, записывает
+// всех клиентов в одной транзакции. Каждому новому клиенту выдаётся API-ключ, как при создании через API. Если файл нельзя прочитать целиком, возвращается *InputError.
+func Import(ctx context.Context, r repo.Repository, src io.Reader, opts ImportOptions) (*ImportReport, error) {
+	if opts.Mode == "" {
+		opts.Mode = ModeUpsert
+	}
+	if opts.Mode != ModeUpsert && opts.Mode != ModeCreate {
+		return nil, &InputError{errors.Errorf("unknown import mode %q", opts.Mode)}
+	}
+
+	rows, rowErrs, err := readRows(src, opts.Format)
+	if err != nil {
+		return nil, &InputError{err}
+	}
+
+	report := &ImportReport{DryRun: opts.DryRun, Mode: opts.Mode, Total: len(rows) + len(rowErrs), Errors: rowErrs}
+
+	now := time.Now()
+	seen := make(map[string]int, len(rows))
+	valid := make([]row, 0, len(rows))
+	for _, rw := range rows {
+		if err := validate(&rw.client); err != nil {
+			report.Errors = append(report.Errors, RowError{Line: rw.line, ClientID: rw.client.ClientID, Error: err.Error()})
+			continue
+		}
+		if line, ok := seen[rw.client.ClientID]; ok {
+			report.Errors = append(report.Errors, RowError{Line: rw.line, ClientID: rw.client.ClientID,
+				Error: fmt.Sprintf("duplicate client_id, first defined on line %d", line)})
+			continue
+		}
+		seen[rw.client.ClientID] = rw.line
+		rw.client.LastRefillAt = now
+		valid = append(valid, rw)
+	}
+
+	ids := make([]string, 0, len(valid))
+	for _, rw := range valid {
+		ids = append(ids, rw.client.ClientID)
+	}
+	existing, err := r.GetClientsByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	before := make(map[string]*models.RateLimitClient, len(existing))
+	for _, client := range existing {
+		before[client.ClientID] = client
+	}
+
+	for _, rw := range valid {
+		_, exists := before[rw.client.ClientID]
+		switch {
+		case exists && opts.Mode == ModeCreate:
+			report.Errors = append(report.Errors, RowError{Line: rw.line, ClientID: rw.client.ClientID, Error: "client already exists"})
+		case exists:
+			report.Updated++
+		default:
+			report.Created++
+		}
+	}
+
+	if len(report.Errors) > 0 {
+		report.Created, report.Updated = 0, 0
+		return report, nil
+	}
+	if opts.DryRun || len(valid) == 0 {
+		return report, nil
+	}
+
+	clients := make([]models.ImportClient, 0, len(valid))
+	var keys []IssuedKey
+	for _, rw := range valid {
+		ic := models.ImportClient{Client: rw.client, TokensSet: rw.tokensSet}
+		if _, exists := before[rw.client.ClientID]; !exists {
+			rawKey, key, err := apikey.Generate(rw.client.ClientID, now)
+			if err != nil {
+				return nil, err
+			}
+			ic.Key = &key
+			keys = append(keys, IssuedKey{ClientID: key.ClientID, APIKey: rawKey, Prefix: key.Prefix})
+		}
+		clients = append(clients, ic)
+	}
+	report.Created, report.Updated, err = r.ImportClients(ctx, clients, opts.Mode == ModeUpsert)
+	if err != nil {
+		return nil, err
+	}
+	report.APIKeys = keys
+	for _, ic := range clients {
+		old := before[ic.Client.ClientID]
+		report.Changes = append(report.Changes, ClientChange{ClientID: ic.Client.ClientID, Before: old, After: imported(old, ic)})
+	}
+
+	return report, nil
+}
+
+// RecordAudit — пишет в журнал изменений по записи на каждого созданного или обновлённого импортом клиента.
+func (report *ImportReport) RecordAudit(ctx context.Context, auditor *audit.Auditor, actor audit.Actor) {
+	for _, change := range report.Changes {
+		var before any
+		if change.Before != nil {
+			before = *change.Before
+		}
+		auditor.Record(ctx, actor, audit.ActionClientImport, audit.TargetClient, change.ClientID, before, change.After)
+	}
+}
+
+// imported — состояние клиента после импорта строки. Для существующего клиента повторяет правила upsert: метки,
+// алгоритм и токены, не заданные в файле, остаются прежними, а токены урезаются до новой ёмкости.
+func imported(before *models.RateLimitClient, ic models.ImportClient) models.RateLimitClient {
+	after := ic.Client
+	if before == nil {
+		if after.Algorithm == "" {
+			after.Algorithm = models.AlgorithmTokenBucket
+		}
+		return after
+	}
+
+	after.Status, after.ExpiresAt = before.Status, before.ExpiresAt
+	if after.Labels == nil {
+		after.Labels = before.Labels
+	}
+	if after.Algorithm == "" {
+		after.Algorithm = before.Algorithm
+	}
+	if !ic.TokensSet {
+		after.Tokens = min(before.Tokens, float64(after.Capacity))
+		after.LastRefillAt = before.LastRefillAt
+	}
+	return after
+}
+
+// Export — пишет всех клиентов в выбранном формате, читая их из БД пачками. Если dst умеет сбрасывать буфер (как
+// http.ResponseWriter), данные отправляются после каждой пачки, не дожидаясь конца выгрузки.
+func Export(ctx context.Context, r repo.Repository, dst io.Writer, format string) (int, error) {
+	w, err := newWriter(dst, format)
+	if err != nil {
+		return 0, err
+	}
+	flusher, _ := dst.(http.Flusher)
+
+	count := 0
+	err = r.ForEachClientBatch(ctx, exportBatchSize, func(clients []*models.RateLimitClient) error {
+		for _, client := range clients {
+			if err := w.write(client); err != nil {
+				return errors.Wrap(err, "failed to write client")
+			}
+			count++
+		}
+		if err := w.flush(); err != nil {
+			return errors.Wrap(err, "failed to flush export")
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+	if err := w.flush(); err != nil {
+		return count, errors.Wrap(err, "failed to flush export")
+	}
+	return count, nil
+}
+
+// validate — проверяет клиента по тем же правилам, что и создание клиента через API, и приводит его скорость
+// к виду rate за rate_period.
+func validate(client *models.RateLimitClient) error {
+	if err := client.NormalizeRate(); err != nil {
+		return err
+	}
+	switch {
+	case client.ClientID == "":
+		return errors.New("client_id is required")
+	case client.Capacity <= 0:
+		return errors.New("capacity must be positive")
+	case client.Tokens < 0 || client.Tokens > float64(client.Capacity):
+		return errors.New("tokens must be between 0 and capacity")
+	case client.Algorithm != "" && !models.ValidAlgorithm(client.Algorithm):
+		return errors.Errorf("unknown algorithm %q", client.Algorithm)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package clientio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"load-balancer/internal/apikey"
+	"load-balancer/internal/audit"
+	"load-balancer/internal/models"
+	"load-balancer/internal/repo"
+)
+
+// fakeRepo — хранит клиентов и записи журнала в памяти; остальные методы тестам не нужны.
+type fakeRepo struct {
+	repo.Repository
+	clients map[string]*models.RateLimitClient
+	keys    []models.APIKey
+	audit   []models.AuditRecord
+}
+
+func (f *fakeRepo) GetClientsByIDs(_ context.Context, ids []string) ([]*models.RateLimitClient, error) {
+	var clients []*models.RateLimitClient
+	for _, id := range ids {
+		if c, ok := f.clients[id]; ok {
+			copied := *c
+			clients = append(clients, &copied)
+		}
+	}
+	return clients, nil
+}
+
+func (f *fakeRepo) ImportClients(_ context.Context, clients []models.ImportClient, _ bool) (created, updated int64, err error) {
+	for _, ic := range clients {
+		if _, ok := f.clients[ic.Client.ClientID]; ok {
+			updated++
+		} else {
+			created++
+		}
+		c := ic.Client
+		f.clients[c.ClientID] = &c
+		if ic.Key != nil {
+			f.keys = append(f.keys, *ic.Key)
+		}
+	}
+	return created, updated, nil
+}
+
+func (f *fakeRepo) CreateAuditRecord(_ context.Context, record models.AuditRecord) error {
+	f.audit = append(f.audit, record)
+	return nil
+}
+
+func TestImportIssuesKeysToCreatedClients(t *testing.T) {
+	db := &fakeRepo{clients: map[string]*models.RateLimitClient{
+		"acme": {ClientID: "acme", Capacity: 10, Rate: 1, RatePeriod: models.Duration(time.Second)},
+	}}
+	src := strings.NewReader(`{"client_id": "acme", "capacity": 5, "rate": 2, "rate_period": "1s"}
+{"client_id": "new", "capacity": 3, "rate": 1, "rate_period": "1s"}
+`)
+
+	report, err := Import(context.Background(), db, src, ImportOptions{Format: FormatJSONL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.APIKeys) != 1 || len(db.keys) != 1 {
+		t.Fatalf("issued keys = %+v, stored keys = %d; want one key for the created client", report.APIKeys, len(db.keys))
+	}
+	issued, stored := report.APIKeys[0], db.keys[0]
+	if issued.ClientID != "new" || stored.ClientID != "new" || issued.Prefix != stored.Prefix ||
+		!bytes.Equal(apikey.Hash(issued.APIKey), stored.Hash) {
+		t.Errorf("issued key %+v does not match stored key %+v", issued, stored)
+	}
+
+	dryRun, err := Import(context.Background(), db, strings.NewReader(`{"client_id": "other", "capacity": 1, "rate": 1, "rate_period": "1s"}`),
+		ImportOptions{Format: FormatJSONL, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dryRun.Created != 1 || len(dryRun.APIKeys) != 0 || len(db.keys) != 1 {
+		t.Errorf("dry run issued keys: %+v", dryRun.APIKeys)
+	}
+}
+
+func TestImportRecordsAuditPerClient(t *testing.T) {
+	refilled := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	db := &fakeRepo{clients: map[string]*models.RateLimitClient{
+		"acme": {ClientID: "acme", Capacity: 10, Rate: 1, RatePeriod: models.Duration(time.Second), Tokens: 8,
+			LastRefillAt: refilled, Labels: map[string]string{"tier": "gold"}, Status: models.ClientActive,
+			Algorithm: models.AlgorithmGCRA},
+	}}
+	src := strings.NewReader(`{"client_id": "acme", "capacity": 5, "rate": 2, "rate_period": "1s"}
+{"client_id": "new", "capacity": 3, "rate": 1, "rate_period": "1s", "tokens": 3}
+`)
+
+	report, err := Import(context.Background(), db, src, ImportOptions{Format: FormatJSONL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != 1 || report.Updated != 1 || len(report.Errors) > 0 {
+		t.Fatalf("report = %+v", report)
+	}
+
+	report.RecordAudit(context.Background(), audit.NewAuditor(db, zap.NewNop().Sugar()), audit.Actor{Name: "ops"})
+	if len(db.audit) != 2 {
+		t.Fatalf("audit records = %d, want 2", len(db.audit))
+	}
+
+	updated, created := db.audit[0], db.audit[1]
+	if updated.Target != "acme" || updated.Action != audit.ActionClientImport || updated.Before == nil {
+		t.Errorf("update record = %+v", updated)
+	}
+	var before, after models.RateLimitClient
+	if err := json.Unmarshal(updated.Before, &before); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(updated.After, &after); err != nil {
+		t.Fatal(err)
+	}
+	if before.Capacity != 10 || before.Tokens != 8 {
+		t.Errorf("before = %+v, want the stored row", before)
+	}
+	if after.Capacity != 5 || after.Tokens != 5 || after.Labels["tier"] != "gold" ||
+		after.Algorithm != models.AlgorithmGCRA || !after.LastRefillAt.Equal(refilled) {
+		t.Errorf("after = %+v, want imported limits with kept labels, algorithm and tokens cut to capacity", after)
+	}
+
+	if created.Target != "new" || created.Before != nil || created.After == nil {
+		t.Errorf("create record = %+v", created)
+	}
+}
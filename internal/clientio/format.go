@@ -0,0 +1,320 @@
+package clientio
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"load-balancer/internal/models"
+)
+
+// Форматы файлов импорта и экспорта.
+const (
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+// maxJSONLLine — максимальная длина строки JSONL.
+const maxJSONLLine = 1 << 20
+
+// csvColumns — колонки CSV при экспорте. При импорте last_refill_at игнорируется, rate_per_second учитывается, только
+// если не задан rate, rate_period, tokens, labels и algorithm необязательны.
+var csvColumns = []string{"client_id", "capacity", "rate", "rate_period", "rate_per_second", "tokens", "last_refill_at", "labels",
+	"algorithm"}
+
+// row — клиент из файла импорта вместе с номером строки, на которой он записан.
+type row struct {
+	line      int
+	client    models.RateLimitClient
+	tokensSet bool
+}
+
+// record — клиент в формате JSONL. Поля совпадают с JSON-представлением клиента в API, поэтому результат экспорта
+// можно загрузить обратно.
+type record struct {
+	ClientID      string            `json:"client_id"`
+	Capacity      int64             `json:"capacity"`
+	Rate          int64             `json:"rate"`
+	RatePeriod    models.Duration   `json:"rate_period"`
+	RatePerSecond float64           `json:"rate_per_second"`
+	Tokens        *float64          `json:"tokens"`
+	Labels        map[string]string `json:"labels"`
+	Algorithm     string            `json:"algorithm"`
+}
+
+// ParseFormat — проверяет название формата; пустое название означает JSONL.
+func ParseFormat(name string) (string, error) {
+	switch strings.ToLower(name) {
+	case "", FormatJSONL, "ndjson":
+		return FormatJSONL, nil
+	case FormatCSV:
+		return FormatCSV, nil
+	default:
+		return "", errors.Errorf("unknown format %q", name)
+	}
+}
+
+// readRows — читает клиентов из файла. Ошибки разбора отдельных строк не прерывают чтение и возвращаются списком,
+// ошибка возвращается, только если файл не удалось прочитать.
+func readRows(r io.Reader, format string) ([]row, []RowError, error) {
+	if format == FormatCSV {
+		return readCSV(r)
+	}
+	return readJSONL(r)
+}
+
+func readJSONL(r io.Reader) ([]row, []RowError, error) {
+	var (
+		rows    []row
+		rowErrs []RowError
+	)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxJSONLLine)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var rec record
+		if err := json.Unmarshal([]byte(text), &rec); err != nil {
+			rowErrs = append(rowErrs, RowError{Line: line, Error: "invalid JSON: " + err.Error()})
+			continue
+		}
+		rows = append(rows, recordRow(line, rec))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to read JSONL")
+	}
+
+	return rows, rowErrs, nil
+}
+
+func readCSV(r io.Reader) ([]row, []RowError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to read CSV header")
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if !isCSVColumn(name) {
+			return nil, nil, errors.Errorf("unknown CSV column %q", name)
+		}
+		columns[name] = i
+	}
+	for _, required := range []string{"client_id", "capacity"} {
+		if _, ok := columns[required]; !ok {
+			return nil, nil, errors.Errorf("missing CSV column %q", required)
+		}
+	}
+	_, hasRate := columns["rate"]
+	_, hasRatePerSecond := columns["rate_per_second"]
+	if !hasRate && !hasRatePerSecond {
+		return nil, nil, errors.New(`missing CSV column "rate"`)
+	}
+
+	var (
+		rows    []row
+		rowErrs []RowError
+	)
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rowErrs = append(rowErrs, RowError{Line: parseErr.Line, Error: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to read CSV")
+		}
+
+		line, _ := reader.FieldPos(0)
+		if len(fields) != len(header) {
+			rowErrs = append(rowErrs, RowError{Line: line, Error: "wrong number of fields"})
+			continue
+		}
+
+		rec, err := csvRecord(fields, columns)
+		if err != nil {
+			rowErrs = append(rowErrs, RowError{Line: line, ClientID: rec.ClientID, Error: err.Error()})
+			continue
+		}
+		rows = append(rows, recordRow(line, rec))
+	}
+
+	return rows, rowErrs, nil
+}
+
+func csvRecord(fields []string, columns map[string]int) (record, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(fields[i])
+		}
+		return ""
+	}
+
+	rec := record{ClientID: field("client_id"), Algorithm: field("algorithm")}
+	var err error
+	if rec.Capacity, err = strconv.ParseInt(field("capacity"), 10, 64); err != nil {
+		return rec, errors.New("invalid capacity")
+	}
+	if raw := field("rate"); raw != "" {
+		if rec.Rate, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			return rec, errors.New("invalid rate")
+		}
+	}
+	if raw := field("rate_period"); raw != "" {
+		period, err := time.ParseDuration(raw)
+		if err != nil {
+			return rec, errors.New("invalid rate_period")
+		}
+		rec.RatePeriod = models.Duration(period)
+	}
+	if raw := field("rate_per_second"); raw != "" && rec.Rate == 0 {
+		if rec.RatePerSecond, err = strconv.ParseFloat(raw, 64); err != nil {
+			return rec, errors.New("invalid rate_per_second")
+		}
+	}
+	if raw := field("tokens"); raw != "" {
+		tokens, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return rec, errors.New("invalid tokens")
+		}
+		rec.Tokens = &tokens
+	}
+	if raw := field("labels"); raw != "" {
+		if rec.Labels, err = parseLabels(raw); err != nil {
+			return rec, err
+		}
+	}
+	return rec, nil
+}
+
+func recordRow(line int, rec record) row {
+	r := row{
+		line: line,
+		client: models.RateLimitClient{
+			ClientID:      rec.ClientID,
+			Capacity:      rec.Capacity,
+			Rate:          rec.Rate,
+			RatePeriod:    rec.RatePeriod,
+			RatePerSecond: rec.RatePerSecond,
+			Tokens:        float64(rec.Capacity),
+			Labels:        rec.Labels,
+			Algorithm:     rec.Algorithm,
+		},
+	}
+	if rec.Tokens != nil {
+		r.client.Tokens = *rec.Tokens
+		r.tokensSet = true
+	}
+	return r
+}
+
+func isCSVColumn(name string) bool {
+	for _, column := range csvColumns {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseLabels — разбирает метки из CSV в виде key=value;key=value.
+func parseLabels(raw string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(raw, ";") {
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, errors.Errorf("invalid label %q, expected key=value", pair)
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+labels[key])
+	}
+	return strings.Join(pairs, ";")
+}
+
+// writer — пишет клиентов в файл экспорта.
+type writer interface {
+	write(client *models.RateLimitClient) error
+	flush() error
+}
+
+func newWriter(w io.Writer, format string) (writer, error) {
+	if format == FormatCSV {
+		cw := &csvWriter{w: csv.NewWriter(w)}
+		if err := cw.w.Write(csvColumns); err != nil {
+			return nil, errors.Wrap(err, "failed to write CSV header")
+		}
+		return cw, nil
+	}
+	return &jsonlWriter{enc: json.NewEncoder(w)}, nil
+}
+
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func (jw *jsonlWriter) write(client *models.RateLimitClient) error {
+	return jw.enc.Encode(client)
+}
+
+func (jw *jsonlWriter) flush() error {
+	return nil
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (cw *csvWriter) write(client *models.RateLimitClient) error {
+	return cw.w.Write([]string{
+		client.ClientID,
+		strconv.FormatInt(client.Capacity, 10),
+		strconv.FormatInt(client.Rate, 10),
+		time.Duration(client.RatePeriod).String(),
+		strconv.FormatFloat(client.RatePerSecond, 'f', -1, 64),
+		strconv.FormatFloat(client.Tokens, 'f', -1, 64),
+		client.LastRefillAt.Format(time.RFC3339Nano),
+		formatLabels(client.Labels),
+		client.Algorithm,
+	})
+}
+
+func (cw *csvWriter) flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
@@ -3,15 +3,196 @@ package config
 import (
 	"fmt"
 	"gopkg.in/yaml.v3"
+	"net"
+	"net/netip"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 )
 
+// DefaultPool — имя пула, который собирается из верхнеуровневых backends и balance_strategy, если pools не заданы.
+const DefaultPool = "default"
+
+var balanceStrategies = map[string]bool{"": true, "round_robin": true, "least_connections": true, "random": true}
+
+var rateLimitHeaderStyles = map[string]bool{"ietf": true, "legacy": true, "both": true, "none": true}
+
+var rateLimitAlgorithms = map[string]bool{
+	"token_bucket": true, "sliding_window_log": true, "sliding_window_counter": true, "gcra": true, "leaky_bucket": true,
+}
+
+// Режимы рейт-лимита: local — каждый инстанс считает лимиты сам, distributed — токен-бакеты общие для всех инстансов.
+const (
+	RateLimitModeLocal       = "local"
+	RateLimitModeDistributed = "distributed"
+)
+
 type Config struct {
 	Port            *int       `yaml:"port"`
 	BalanceStrategy string     `yaml:"balance_strategy"`
 	Backends        []string   `yaml:"backends"`
+	Pools           []Pool     `yaml:"pools"`
+	Routes          []Route    `yaml:"routes"`
 	PostgreSQL      PostgreSQL `yaml:"postgres"`
+	Metrics         Metrics    `yaml:"metrics"`
+	AccessLog       AccessLog  `yaml:"access_log"`
+	Shutdown        Shutdown   `yaml:"shutdown"`
+	Admin           Admin      `yaml:"admin"`
+	RateLimit       RateLimit  `yaml:"rate_limit"`
+	TLS             TLS        `yaml:"tls"`
+
+	// Warnings — замечания к конфигурации, которые не мешают её применить, например замена неизвестной стратегии
+	// балансировки на round_robin. Их пишет в лог тот, кто загрузил конфигурацию.
+	Warnings []string `yaml:"-"`
+}
+
+// TLS — HTTPS на публичном порту. Если задан client_ca_file, клиентские сертификаты проверяются этим CA и могут
+// использоваться для идентификации клиентов.
+type TLS struct {
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file"`
+}
+
+type RateLimit struct {
+	APIKeyCacheTTL          time.Duration `yaml:"api_key_cache_ttl" default:"30s"`
+	AllowLegacyClientIDKeys *bool         `yaml:"allow_legacy_client_id_keys" default:"true"`
+	Headers                 string        `yaml:"headers" default:"ietf"`
+	PolicyRefreshInterval   time.Duration `yaml:"policy_refresh_interval" default:"10s"`
+	PlanRefreshInterval     time.Duration `yaml:"plan_refresh_interval" default:"10s"`
+	ClientRefreshInterval   time.Duration `yaml:"client_refresh_interval" default:"10s"`
+	QuotaSyncInterval       time.Duration `yaml:"quota_sync_interval" default:"5s"`
+	Cost                    RequestCost   `yaml:"cost"`
+	Mode                    string        `yaml:"mode" default:"local"`
+	LeaseSize               int64         `yaml:"lease_size" default:"5"`
+	LeaseTTL                time.Duration `yaml:"lease_ttl" default:"1s"`
+	Identity                Identity      `yaml:"identity"`
+	Anonymous               Anonymous     `yaml:"anonymous"`
+	OnError                 string        `yaml:"on_error" default:"reject"`
+}
+
+// Anonymous — лимит для запросов без данных о клиенте, общий для каждого адреса или подсети.
+type Anonymous struct {
+	Enabled        bool          `yaml:"enabled"`
+	Capacity       int64         `yaml:"capacity" default:"10"`
+	Rate           int64         `yaml:"rate" default:"60"`
+	RatePeriod     time.Duration `yaml:"rate_period" default:"1m"`
+	Algorithm      string        `yaml:"algorithm" default:"token_bucket"`
+	IPv4Prefix     int           `yaml:"ipv4_prefix" default:"32"`
+	IPv6Prefix     int           `yaml:"ipv6_prefix" default:"64"`
+	TrustedProxies []string      `yaml:"trusted_proxies"`
+}
+
+// Identity — как определяется клиент проксируемого запроса. Источники проверяются по порядку: без combine клиентом
+// становится первый найденный, с combine нужны все, а их значения склеиваются через separator.
+type Identity struct {
+	Sources       []IdentitySource `yaml:"sources"`
+	Combine       bool             `yaml:"combine"`
+	Separator     string           `yaml:"separator" default:":"`
+	ForwardHeader string           `yaml:"forward_header"`
+}
+
+type IdentitySource struct {
+	Type           string   `yaml:"type"`
+	Header         string   `yaml:"header"`
+	Param          string   `yaml:"param"`
+	Claim          string   `yaml:"claim" default:"sub"`
+	JWKSFile       string   `yaml:"jwks_file"`
+	Issuer         string   `yaml:"issuer"`
+	Audience       string   `yaml:"audience"`
+	Field          string   `yaml:"field" default:"subject"`
+	IPv4Prefix     int      `yaml:"ipv4_prefix" default:"32"`
+	IPv6Prefix     int      `yaml:"ipv6_prefix" default:"128"`
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+type RequestCost struct {
+	Routes           []CostRoute `yaml:"routes"`
+	Header           string      `yaml:"header"`
+	MaxHeaderCost    int64       `yaml:"max_header_cost" default:"1000"`
+	TrustedProxies   []string    `yaml:"trusted_proxies"`
+	BodyBytesPerUnit int64       `yaml:"body_bytes_per_unit"`
+	ResponseHeader   string      `yaml:"response_header"`
+}
+
+type CostRoute struct {
+	Method     string `yaml:"method"`
+	PathPrefix string `yaml:"path_prefix"`
+	Cost       int64  `yaml:"cost"`
+}
+
+type Admin struct {
+	Address     string    `yaml:"address" default:"127.0.0.1:9090"`
+	TLSCertFile string    `yaml:"tls_cert_file"`
+	TLSKeyFile  string    `yaml:"tls_key_file"`
+	Auth        AdminAuth `yaml:"auth"`
+}
+
+type AdminAuth struct {
+	Tokens       []AdminToken `yaml:"tokens"`
+	ClientCAFile string       `yaml:"client_ca_file"`
+	ClientCerts  []AdminCert  `yaml:"client_certs"`
+	Disabled     bool         `yaml:"disabled"`
+}
+
+type AdminToken struct {
+	Name      string `yaml:"name"`
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"token_file"`
+	Role      string `yaml:"role"`
+}
+
+type AdminCert struct {
+	Subject string `yaml:"subject"`
+	Role    string `yaml:"role"`
+}
+
+type Shutdown struct {
+	Delay   time.Duration `yaml:"delay"`
+	Timeout time.Duration `yaml:"timeout" default:"30s"`
+}
+
+type Pool struct {
+	Name            string   `yaml:"name"`
+	BalanceStrategy string   `yaml:"balance_strategy"`
+	Backends        []string `yaml:"backends"`
+}
+
+type Route struct {
+	Name       string `yaml:"name"`
+	Host       string `yaml:"host"`
+	PathPrefix string `yaml:"path_prefix"`
+	Pool       string `yaml:"pool"`
+}
+
+type AccessLog struct {
+	Enabled        bool     `yaml:"enabled"`
+	Format         string   `yaml:"format" default:"json"`
+	Template       string   `yaml:"template"`
+	Output         string   `yaml:"output" default:"stdout"`
+	MaxSizeMB      int      `yaml:"max_size_mb" default:"100"`
+	MaxBackups     int      `yaml:"max_backups"`
+	MaxAgeDays     int      `yaml:"max_age_days"`
+	Compress       bool     `yaml:"compress"`
+	SampleRate     float64  `yaml:"sample_rate" default:"1"`
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+type Metrics struct {
+	Path            string `yaml:"path" default:"/metrics"`
+	MaxClientLabels int    `yaml:"max_client_labels" default:"1000"`
+	StatsD          StatsD `yaml:"statsd"`
+}
+
+type StatsD struct {
+	Enabled       bool          `yaml:"enabled"`
+	Address       string        `yaml:"address" default:"127.0.0.1:8125"`
+	Prefix        string        `yaml:"prefix" default:"lb."`
+	Flavor        string        `yaml:"flavor" default:"dogstatsd"`
+	Tags          []string      `yaml:"tags"`
+	FlushInterval time.Duration `yaml:"flush_interval" default:"1s"`
+	MaxPacketSize int           `yaml:"max_packet_size" default:"1432"`
 }
 
 type PostgreSQL struct {
@@ -39,8 +220,8 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("Error parsing config file: %s", err)
 	}
 
-	if len(config.Backends) == 0 {
-		return nil, fmt.Errorf("No backends found in config file. Please enter at least one.")
+	if err = config.normalizeUpstreams(); err != nil {
+		return nil, err
 	}
 
 	if config.Port == nil {
@@ -52,5 +233,348 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("Invalid port number %d. Port can be between 1 and 65535", config.Port)
 	}
 
+	if config.Metrics.Path == "" {
+		config.Metrics.Path = "/metrics"
+	}
+	if config.Metrics.MaxClientLabels <= 0 {
+		config.Metrics.MaxClientLabels = 1000
+	}
+	if config.Metrics.StatsD.Address == "" {
+		config.Metrics.StatsD.Address = "127.0.0.1:8125"
+	}
+	if config.Metrics.StatsD.Prefix == "" {
+		config.Metrics.StatsD.Prefix = "lb."
+	}
+
+	if (config.TLS.CertFile == "") != (config.TLS.KeyFile == "") {
+		return nil, fmt.Errorf("TLS requires both cert_file and key_file.")
+	}
+	if config.TLS.ClientCAFile != "" && config.TLS.CertFile == "" {
+		return nil, fmt.Errorf("TLS client_ca_file requires cert_file and key_file.")
+	}
+
+	if config.Admin.Address == "" {
+		config.Admin.Address = "127.0.0.1:9090"
+	}
+	if (config.Admin.TLSCertFile == "") != (config.Admin.TLSKeyFile == "") {
+		return nil, fmt.Errorf("Admin TLS requires both tls_cert_file and tls_key_file.")
+	}
+	if config.Admin.Auth.ClientCAFile != "" && config.Admin.TLSCertFile == "" {
+		return nil, fmt.Errorf("Admin client certificate authentication requires tls_cert_file and tls_key_file.")
+	}
+	if len(config.Admin.Auth.ClientCerts) > 0 && config.Admin.Auth.ClientCAFile == "" {
+		return nil, fmt.Errorf("Admin client_certs require client_ca_file.")
+	}
+	for _, token := range config.Admin.Auth.Tokens {
+		if token.Name == "" {
+			return nil, fmt.Errorf("Admin token name is required.")
+		}
+		if (token.Token == "") == (token.TokenFile == "") {
+			return nil, fmt.Errorf("Admin token %q requires exactly one of token or token_file.", token.Name)
+		}
+	}
+	if err := validateAdminAuth(config.Admin); err != nil {
+		return nil, err
+	}
+
+	if config.RateLimit.AllowLegacyClientIDKeys == nil {
+		// Клиенты, заведённые до появления ключей, ключей не получили; чтобы они не получили 401 сразу после
+		// обновления, client_id в X-API-KEY принимается, пока это явно не выключено.
+		allowLegacy := true
+		config.RateLimit.AllowLegacyClientIDKeys = &allowLegacy
+	}
+	if config.RateLimit.APIKeyCacheTTL <= 0 {
+		config.RateLimit.APIKeyCacheTTL = 30 * time.Second
+	}
+	if config.RateLimit.PolicyRefreshInterval <= 0 {
+		config.RateLimit.PolicyRefreshInterval = 10 * time.Second
+	}
+	if config.RateLimit.PlanRefreshInterval <= 0 {
+		config.RateLimit.PlanRefreshInterval = 10 * time.Second
+	}
+	if config.RateLimit.ClientRefreshInterval <= 0 {
+		config.RateLimit.ClientRefreshInterval = 10 * time.Second
+	}
+	if config.RateLimit.QuotaSyncInterval <= 0 {
+		config.RateLimit.QuotaSyncInterval = 5 * time.Second
+	}
+	if config.RateLimit.Cost.MaxHeaderCost <= 0 {
+		config.RateLimit.Cost.MaxHeaderCost = 1000
+	}
+	if config.RateLimit.Cost.BodyBytesPerUnit < 0 {
+		return nil, fmt.Errorf("Invalid rate limit cost body_bytes_per_unit %d. It must not be negative", config.RateLimit.Cost.BodyBytesPerUnit)
+	}
+	if err := validateTrustedProxies(config.RateLimit.Cost.TrustedProxies); err != nil {
+		return nil, err
+	}
+	if config.RateLimit.Cost.Header != "" && len(config.RateLimit.Cost.TrustedProxies) == 0 {
+		config.Warnings = append(config.Warnings, fmt.Sprintf(
+			"Rate limit cost header %q is ignored: no trusted_proxies configured for it.", config.RateLimit.Cost.Header))
+	}
+	for i, route := range config.RateLimit.Cost.Routes {
+		config.RateLimit.Cost.Routes[i].Method = strings.ToUpper(route.Method)
+		if !strings.HasPrefix(route.PathPrefix, "/") {
+			return nil, fmt.Errorf("Rate limit cost path prefix %q must start with /.", route.PathPrefix)
+		}
+		if route.Cost < 1 {
+			return nil, fmt.Errorf("Rate limit cost for %q must be at least 1.", route.PathPrefix)
+		}
+	}
+	if config.RateLimit.Headers == "" {
+		config.RateLimit.Headers = "ietf"
+	}
+	if !rateLimitHeaderStyles[config.RateLimit.Headers] {
+		return nil, fmt.Errorf("Unknown rate limit headers style %q. It must be ietf, legacy, both or none", config.RateLimit.Headers)
+	}
+
+	if err := validateIdentity(&config.RateLimit.Identity, config.TLS); err != nil {
+		return nil, err
+	}
+
+	if err := validateAnonymous(&config.RateLimit.Anonymous); err != nil {
+		return nil, err
+	}
+	if config.RateLimit.OnError == "" {
+		config.RateLimit.OnError = "reject"
+	}
+	if config.RateLimit.OnError != "reject" && config.RateLimit.OnError != "allow" {
+		return nil, fmt.Errorf("Unknown rate limit on_error %q. It must be reject or allow", config.RateLimit.OnError)
+	}
+
+	if config.RateLimit.Mode == "" {
+		config.RateLimit.Mode = RateLimitModeLocal
+	}
+	if config.RateLimit.Mode != RateLimitModeLocal && config.RateLimit.Mode != RateLimitModeDistributed {
+		return nil, fmt.Errorf("Unknown rate limit mode %q. It must be local or distributed", config.RateLimit.Mode)
+	}
+	if config.RateLimit.LeaseSize <= 0 {
+		config.RateLimit.LeaseSize = 5
+	}
+	if config.RateLimit.LeaseTTL <= 0 {
+		config.RateLimit.LeaseTTL = time.Second
+	}
+
+	if config.Shutdown.Timeout <= 0 {
+		config.Shutdown.Timeout = 30 * time.Second
+	}
+
+	if config.AccessLog.SampleRate == 0 {
+		config.AccessLog.SampleRate = 1
+	}
+	if config.AccessLog.SampleRate < 0 || config.AccessLog.SampleRate > 1 {
+		return nil, fmt.Errorf("Invalid access log sample rate %v. It must be between 0 and 1", config.AccessLog.SampleRate)
+	}
+	if err := validateTrustedProxies(config.AccessLog.TrustedProxies); err != nil {
+		return nil, err
+	}
+	if config.AccessLog.Format == "template" && config.AccessLog.Template == "" {
+		return nil, fmt.Errorf("Access log format is template, but no template found in config file.")
+	}
+
 	return &config, nil
 }
+
+// normalizeUpstreams — сводит верхнеуровневые backends и balance_strategy к пулу default с маршрутом "/", если пулы и
+// маршруты не заданы явно, и проверяет, что пулы и маршруты согласованы между собой. Неизвестная стратегия пула
+// заменяется на round_robin с предупреждением.
+func (c *Config) normalizeUpstreams() error {
+	if len(c.Pools) == 0 {
+		if len(c.Backends) == 0 {
+			return fmt.Errorf("No backends found in config file. Please enter at least one.")
+		}
+		c.Pools = []Pool{{Name: DefaultPool, BalanceStrategy: c.BalanceStrategy, Backends: c.Backends}}
+	}
+
+	pools := make(map[string]bool, len(c.Pools))
+	for i, pool := range c.Pools {
+		if pool.Name == "" {
+			return fmt.Errorf("Pool without name found in config file.")
+		}
+		if pools[pool.Name] {
+			return fmt.Errorf("Pool %q is declared more than once.", pool.Name)
+		}
+		pools[pool.Name] = true
+
+		if !balanceStrategies[pool.BalanceStrategy] {
+			c.Warnings = append(c.Warnings, fmt.Sprintf("Unknown balance strategy %q in pool %q, using round_robin.",
+				pool.BalanceStrategy, pool.Name))
+			c.Pools[i].BalanceStrategy = ""
+		}
+		if c.Pools[i].BalanceStrategy == "" {
+			c.Pools[i].BalanceStrategy = "round_robin"
+		}
+		if len(pool.Backends) == 0 {
+			return fmt.Errorf("No backends found in pool %q. Please enter at least one.", pool.Name)
+		}
+		for _, backend := range pool.Backends {
+			u, err := url.Parse(backend)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("Invalid backend url %q in pool %q.", backend, pool.Name)
+			}
+		}
+	}
+
+	if len(c.Routes) == 0 {
+		c.Routes = []Route{{PathPrefix: "/", Pool: c.Pools[0].Name}}
+	}
+	for i := range c.Routes {
+		route := &c.Routes[i]
+		if route.PathPrefix == "" {
+			route.PathPrefix = "/"
+		}
+		if !strings.HasPrefix(route.PathPrefix, "/") {
+			return fmt.Errorf("Route path prefix %q must start with /.", route.PathPrefix)
+		}
+		if !pools[route.Pool] {
+			return fmt.Errorf("Route %q refers to unknown pool %q.", route.Host+route.PathPrefix, route.Pool)
+		}
+		if route.Name == "" {
+			route.Name = route.Host + route.PathPrefix
+		}
+	}
+
+	return nil
+}
+
+// validateIdentity — проверяет источники идентификации клиентов и заполняет значения по умолчанию. Без источников
+// клиент определяется по API-ключу в X-API-KEY.
+func validateIdentity(identity *Identity, tls TLS) error {
+	if len(identity.Sources) == 0 {
+		identity.Sources = []IdentitySource{{Type: "api_key"}}
+	}
+	if identity.Separator == "" {
+		identity.Separator = ":"
+	}
+
+	for i := range identity.Sources {
+		source := &identity.Sources[i]
+		switch source.Type {
+		case "api_key":
+			if source.Header == "" {
+				source.Header = "X-API-KEY"
+			}
+		case "header":
+			if source.Header == "" {
+				return fmt.Errorf("Identity source header requires header.")
+			}
+		case "query":
+			if source.Param == "" {
+				return fmt.Errorf("Identity source query requires param.")
+			}
+		case "jwt":
+			if source.JWKSFile == "" {
+				return fmt.Errorf("Identity source jwt requires jwks_file.")
+			}
+			if source.Header == "" {
+				source.Header = "Authorization"
+			}
+			if source.Claim == "" {
+				source.Claim = "sub"
+			}
+		case "mtls":
+			if tls.ClientCAFile == "" {
+				return fmt.Errorf("Identity source mtls requires tls client_ca_file.")
+			}
+			if source.Field == "" {
+				source.Field = "subject"
+			}
+			if source.Field != "subject" && source.Field != "san" {
+				return fmt.Errorf("Unknown mtls identity field %q. It must be subject or san", source.Field)
+			}
+		case "ip":
+			if source.IPv4Prefix == 0 {
+				source.IPv4Prefix = 32
+			}
+			if source.IPv6Prefix == 0 {
+				source.IPv6Prefix = 128
+			}
+			if source.IPv4Prefix < 0 || source.IPv4Prefix > 32 || source.IPv6Prefix < 0 || source.IPv6Prefix > 128 {
+				return fmt.Errorf("Invalid ip identity prefix: ipv4_prefix must be 0-32 and ipv6_prefix 0-128.")
+			}
+			if err := validateTrustedProxies(source.TrustedProxies); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("Unknown identity source %q. It must be api_key, header, query, jwt, mtls or ip", source.Type)
+		}
+	}
+	return nil
+}
+
+// validateAnonymous — проверяет анонимный лимит и заполняет значения по умолчанию.
+func validateAnonymous(anonymous *Anonymous) error {
+	if anonymous.Capacity == 0 {
+		anonymous.Capacity = 10
+	}
+	if anonymous.Rate == 0 {
+		anonymous.Rate = 60
+	}
+	if anonymous.RatePeriod == 0 {
+		anonymous.RatePeriod = time.Minute
+	}
+	if anonymous.Algorithm == "" {
+		anonymous.Algorithm = "token_bucket"
+	}
+	if anonymous.IPv4Prefix == 0 {
+		anonymous.IPv4Prefix = 32
+	}
+	if anonymous.IPv6Prefix == 0 {
+		anonymous.IPv6Prefix = 64
+	}
+
+	switch {
+	case anonymous.Capacity < 0 || anonymous.Rate < 0:
+		return fmt.Errorf("Anonymous rate limit capacity and rate must be positive.")
+	case anonymous.RatePeriod < time.Millisecond:
+		return fmt.Errorf("Anonymous rate limit rate_period must be at least 1ms.")
+	case !rateLimitAlgorithms[anonymous.Algorithm]:
+		return fmt.Errorf("Unknown anonymous rate limit algorithm %q.", anonymous.Algorithm)
+	case anonymous.IPv4Prefix < 0 || anonymous.IPv4Prefix > 32 || anonymous.IPv6Prefix < 0 || anonymous.IPv6Prefix > 128:
+		return fmt.Errorf("Invalid anonymous rate limit prefix: ipv4_prefix must be 0-32 and ipv6_prefix 0-128.")
+	}
+	return validateTrustedProxies(anonymous.TrustedProxies)
+}
+
+// validateAdminAuth — админский API без аутентификации не запускается. Открыть его всем можно только явно, через
+// auth.disabled, и только на loopback-адресе.
+func validateAdminAuth(admin Admin) error {
+	configured := len(admin.Auth.Tokens) > 0 || len(admin.Auth.ClientCerts) > 0
+	if !admin.Auth.Disabled {
+		if !configured {
+			return fmt.Errorf("Admin authentication is not configured. Set admin.auth tokens or client_certs, or admin.auth.disabled with a loopback admin address.")
+		}
+		return nil
+	}
+	if configured {
+		return fmt.Errorf("Admin auth disabled cannot be combined with tokens or client_certs.")
+	}
+	if !isLoopback(admin.Address) {
+		return fmt.Errorf("Admin auth disabled requires a loopback admin address, got %q.", admin.Address)
+	}
+	return nil
+}
+
+// isLoopback — true, если адрес слушателя вида host:port принимает соединения только с этой машины.
+func isLoopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	addr, err := netip.ParseAddr(host)
+	return err == nil && addr.IsLoopback()
+}
+
+// validateTrustedProxies — проверяет, что доверенные прокси заданы адресами или подсетями.
+func validateTrustedProxies(cidrs []string) error {
+	for _, cidr := range cidrs {
+		if _, err := netip.ParsePrefix(cidr); err != nil {
+			if _, err := netip.ParseAddr(cidr); err != nil {
+				return fmt.Errorf("Invalid trusted proxy %q. It must be an IP address or CIDR", cidr)
+			}
+		}
+	}
+	return nil
+}
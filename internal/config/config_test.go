@@ -0,0 +1,229 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func loadYAML(t *testing.T, data string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return LoadConfig(path)
+}
+
+// adminAuth — минимальная секция admin, без которой конфигурация не загружается.
+const adminAuth = "admin: {auth: {tokens: [{name: ops, token: secret, role: admin}]}}\n"
+
+func TestLoadConfigValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{
+			name: "minimal",
+			yaml: "port: 8080\nbackends: [\"http://a:1\"]\n" + adminAuth,
+		},
+		{
+			name:    "no port",
+			yaml:    "backends: [\"http://a:1\"]\n",
+			wantErr: "No port found",
+		},
+		{
+			name:    "port out of range",
+			yaml:    "port: 70000\nbackends: [\"http://a:1\"]\n",
+			wantErr: "Invalid port number",
+		},
+		{
+			name:    "no backends",
+			yaml:    "port: 8080\n",
+			wantErr: "No backends found",
+		},
+		{
+			name:    "invalid backend url",
+			yaml:    "port: 8080\nbackends: [\"ftp://a:1\"]\n",
+			wantErr: "Invalid backend url",
+		},
+		{
+			name:    "duplicate pool",
+			yaml:    "port: 8080\npools:\n  - {name: a, backends: [\"http://a:1\"]}\n  - {name: a, backends: [\"http://b:1\"]}\n",
+			wantErr: "declared more than once",
+		},
+		{
+			name:    "route to unknown pool",
+			yaml:    "port: 8080\npools:\n  - {name: a, backends: [\"http://a:1\"]}\nroutes:\n  - {path_prefix: /api, pool: b}\n",
+			wantErr: "unknown pool",
+		},
+		{
+			name:    "route prefix without slash",
+			yaml:    "port: 8080\npools:\n  - {name: a, backends: [\"http://a:1\"]}\nroutes:\n  - {path_prefix: api, pool: a}\n",
+			wantErr: "must start with /",
+		},
+		{
+			name:    "sample rate out of range",
+			yaml:    "port: 8080\nbackends: [\"http://a:1\"]\naccess_log: {sample_rate: 2}\n" + adminAuth,
+			wantErr: "Invalid access log sample rate",
+		},
+		{
+			name:    "invalid access log trusted proxy",
+			yaml:    "port: 8080\nbackends: [\"http://a:1\"]\naccess_log: {trusted_proxies: [\"10.0.0.0/33\"]}\n" + adminAuth,
+			wantErr: "Invalid trusted proxy",
+		},
+		{
+			name:    "invalid rate limit cost trusted proxy",
+			yaml:    "port: 8080\nbackends: [\"http://a:1\"]\nrate_limit: {cost: {header: X-Request-Cost, trusted_proxies: [\"proxy\"]}}\n" + adminAuth,
+			wantErr: "Invalid trusted proxy",
+		},
+		{
+			name:    "admin token without value",
+			yaml:    "port: 8080\nbackends: [\"http://a:1\"]\nadmin: {auth: {tokens: [{name: ops, role: admin}]}}\n",
+			wantErr: "requires exactly one of token or token_file",
+		},
+		{
+			name:    "admin without authentication",
+			yaml:    "port: 8080\nbackends: [\"http://a:1\"]\n",
+			wantErr: "Admin authentication is not configured",
+		},
+		{
+			name: "admin auth disabled on loopback",
+			yaml: "port: 8080\nbackends: [\"http://a:1\"]\nadmin: {address: \"[::1]:9090\", auth: {disabled: true}}\n",
+		},
+		{
+			name:    "admin auth disabled on all interfaces",
+			yaml:    "port: 8080\nbackends: [\"http://a:1\"]\nadmin: {address: \":9090\", auth: {disabled: true}}\n",
+			wantErr: "requires a loopback admin address",
+		},
+		{
+			name:    "admin auth disabled with tokens",
+			yaml:    "port: 8080\nbackends: [\"http://a:1\"]\nadmin: {auth: {disabled: true, tokens: [{name: ops, token: a, role: admin}]}}\n",
+			wantErr: "cannot be combined",
+		},
+		{
+			name:    "unknown rate limit headers style",
+			yaml:    "port: 8080\nbackends: [\"http://a:1\"]\nrate_limit: {headers: draft}\n" + adminAuth,
+			wantErr: "Unknown rate limit headers style",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadYAML(t, tt.yaml)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && err == nil:
+				t.Fatalf("expected error containing %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Fatalf("error %q does not contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNormalizeUpstreams(t *testing.T) {
+	tests := []struct {
+		name         string
+		yaml         string
+		wantPools    []Pool
+		wantRoutes   []Route
+		wantWarnings int
+	}{
+		{
+			name:       "top-level backends become default pool",
+			yaml:       "port: 8080\nbalance_strategy: random\nbackends: [\"http://a:1\"]\n" + adminAuth,
+			wantPools:  []Pool{{Name: DefaultPool, BalanceStrategy: "random", Backends: []string{"http://a:1"}}},
+			wantRoutes: []Route{{Name: "/", PathPrefix: "/", Pool: DefaultPool}},
+		},
+		{
+			name:       "empty strategy defaults to round_robin",
+			yaml:       "port: 8080\npools:\n  - {name: a, backends: [\"http://a:1\"]}\n" + adminAuth,
+			wantPools:  []Pool{{Name: "a", BalanceStrategy: "round_robin", Backends: []string{"http://a:1"}}},
+			wantRoutes: []Route{{Name: "/", PathPrefix: "/", Pool: "a"}},
+		},
+		{
+			name:         "unknown strategy falls back to round_robin",
+			yaml:         "port: 8080\npools:\n  - {name: a, balance_strategy: weighted, backends: [\"http://a:1\"]}\n" + adminAuth,
+			wantPools:    []Pool{{Name: "a", BalanceStrategy: "round_robin", Backends: []string{"http://a:1"}}},
+			wantRoutes:   []Route{{Name: "/", PathPrefix: "/", Pool: "a"}},
+			wantWarnings: 1,
+		},
+		{
+			name:       "route name defaults to host and prefix",
+			yaml:       "port: 8080\npools:\n  - {name: a, backends: [\"http://a:1\"]}\nroutes:\n  - {host: api.example.com, pool: a}\n" + adminAuth,
+			wantPools:  []Pool{{Name: "a", BalanceStrategy: "round_robin", Backends: []string{"http://a:1"}}},
+			wantRoutes: []Route{{Name: "api.example.com/", Host: "api.example.com", PathPrefix: "/", Pool: "a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadYAML(t, tt.yaml)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(cfg.Pools) != len(tt.wantPools) {
+				t.Fatalf("pools = %+v, want %+v", cfg.Pools, tt.wantPools)
+			}
+			for i, pool := range tt.wantPools {
+				got := cfg.Pools[i]
+				if got.Name != pool.Name || got.BalanceStrategy != pool.BalanceStrategy ||
+					strings.Join(got.Backends, ",") != strings.Join(pool.Backends, ",") {
+					t.Errorf("pool %d = %+v, want %+v", i, got, pool)
+				}
+			}
+			if len(cfg.Routes) != len(tt.wantRoutes) {
+				t.Fatalf("routes = %+v, want %+v", cfg.Routes, tt.wantRoutes)
+			}
+			for i, route := range tt.wantRoutes {
+				if cfg.Routes[i] != route {
+					t.Errorf("route %d = %+v, want %+v", i, cfg.Routes[i], route)
+				}
+			}
+			if len(cfg.Warnings) != tt.wantWarnings {
+				t.Errorf("warnings = %q, want %d", cfg.Warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	base := func() *Config {
+		port := 8080
+		return &Config{
+			Port:  &port,
+			Admin: Admin{Address: "127.0.0.1:9090", Auth: AdminAuth{Tokens: []AdminToken{{Name: "ops", Token: "a", Role: "admin"}}}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   []string
+	}{
+		{name: "no changes", change: func(c *Config) {}},
+		{name: "pools are reloaded live", change: func(c *Config) { c.Pools = []Pool{{Name: "a"}} }},
+		{name: "admin token rotation is reloaded live", change: func(c *Config) { c.Admin.Auth.Tokens[0].Token = "b" }},
+		{name: "admin address", change: func(c *Config) { c.Admin.Address = "0.0.0.0:9090" }, want: []string{"admin"}},
+		{
+			name:   "port and rate limit",
+			change: func(c *Config) { *c.Port = 8081; c.RateLimit.Mode = RateLimitModeDistributed },
+			want:   []string{"port", "rate_limit"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, next := base(), base()
+			tt.change(next)
+			got := RestartRequired(old, next)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("RestartRequired = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package config
+
+import "go.uber.org/zap/zapcore"
+
+// redacted — то, что пишется в лог вместо секретов.
+const redacted = "[REDACTED]"
+
+// MarshalLogObject — пишет конфигурацию в лог zap без секретов: токенов админского API и пароля БД.
+func (c *Config) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if c.Port != nil {
+		enc.AddInt("port", *c.Port)
+	}
+
+	postgres := c.PostgreSQL
+	if postgres.Password != "" {
+		postgres.Password = redacted
+	}
+
+	admin := c.Admin
+	admin.Auth.Tokens = make([]AdminToken, len(c.Admin.Auth.Tokens))
+	for i, token := range c.Admin.Auth.Tokens {
+		if token.Token != "" {
+			token.Token = redacted
+		}
+		admin.Auth.Tokens[i] = token
+	}
+
+	sections := []struct {
+		key   string
+		value any
+	}{
+		{"pools", c.Pools},
+		{"routes", c.Routes},
+		{"postgres", postgres},
+		{"metrics", c.Metrics},
+		{"access_log", c.AccessLog},
+		{"shutdown", c.Shutdown},
+		{"admin", admin},
+		{"rate_limit", c.RateLimit},
+		{"tls", c.TLS},
+	}
+	for _, section := range sections {
+		if err := enc.AddReflected(section.key, section.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
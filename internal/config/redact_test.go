@@ -0,0 +1,44 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestConfigLogRedactsSecrets(t *testing.T) {
+	port := 8080
+	cfg := &Config{
+		Port:       &port,
+		PostgreSQL: PostgreSQL{User: "lb", Password: "db-secret"},
+		Admin: Admin{Auth: AdminAuth{Tokens: []AdminToken{
+			{Name: "ops", Token: "token-secret", Role: "admin"},
+			{Name: "ci", TokenFile: "/run/secrets/ci", Role: "viewer"},
+		}}},
+	}
+
+	enc := zapcore.NewMapObjectEncoder()
+	if err := cfg.MarshalLogObject(enc); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(enc.Fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range []string{"db-secret", "token-secret"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("log contains secret %q: %s", secret, data)
+		}
+	}
+	for _, visible := range []string{`"ops"`, "/run/secrets/ci", `"lb"`} {
+		if !strings.Contains(string(data), visible) {
+			t.Errorf("log does not contain %s: %s", visible, data)
+		}
+	}
+	if cfg.Admin.Auth.Tokens[0].Token != "token-secret" || cfg.PostgreSQL.Password != "db-secret" {
+		t.Error("logging modified the config")
+	}
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// watchDebounce — сколько ждать после последнего события файловой системы, прежде чем перечитывать конфиг: редакторы
+// часто пишут файл в несколько приёмов.
+const watchDebounce = 500 * time.Millisecond
+
+// Watch — следит за файлом конфигурации и сигналом SIGHUP. При изменении файла или получении сигнала отправляет в
+// канал причину перезагрузки. Следит за каталогом, а не за самим файлом, чтобы переживать атомарную замену файла
+// редакторами и ConfigMap в Kubernetes.
+func Watch(ctx context.Context, path string, logger *zap.SugaredLogger) (<-chan string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to resolve config path")
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create config watcher")
+	}
+	if err := watcher.Add(filepath.Dir(absPath)); err != nil {
+		_ = watcher.Close()
+		return nil, errors.Wrap(err, "failed to watch config directory")
+	}
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	reloads := make(chan string, 1)
+	go func() {
+		defer close(reloads)
+		defer watcher.Close()
+		defer signal.Stop(sighup)
+
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sighup:
+				notify(reloads, "SIGHUP")
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) == absPath && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+					debounce = time.After(watchDebounce)
+				}
+			case <-debounce:
+				debounce = nil
+				notify(reloads, "file changed")
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Warnw("config watcher error", "error", err)
+			}
+		}
+	}()
+
+	return reloads, nil
+}
+
+// notify — отправляет причину перезагрузки, не блокируясь: если предыдущая ещё не обработана, новая с ней сливается.
+func notify(reloads chan<- string, reason string) {
+	select {
+	case reloads <- reason:
+	default:
+	}
+}
+
+// RestartRequired — возвращает секции конфигурации, которые изменились, но не применяются без перезапуска.
+// Пулы, маршруты и бэкенды, а также токены и правила для сертификатов админского API перезагружаются на лету и здесь
+// не учитываются.
+func RestartRequired(old, next *Config) []string {
+	var sections []string
+	if !reflect.DeepEqual(old.Port, next.Port) {
+		sections = append(sections, "port")
+	}
+	if !reflect.DeepEqual(old.PostgreSQL, next.PostgreSQL) {
+		sections = append(sections, "postgres")
+	}
+	if !reflect.DeepEqual(old.Metrics, next.Metrics) {
+		sections = append(sections, "metrics")
+	}
+	if !reflect.DeepEqual(old.AccessLog, next.AccessLog) {
+		sections = append(sections, "access_log")
+	}
+	if !reflect.DeepEqual(old.Shutdown, next.Shutdown) {
+		sections = append(sections, "shutdown")
+	}
+	if !reflect.DeepEqual(withoutCredentials(old.Admin), withoutCredentials(next.Admin)) {
+		sections = append(sections, "admin")
+	}
+	if !reflect.DeepEqual(old.RateLimit, next.RateLimit) {
+		sections = append(sections, "rate_limit")
+	}
+	return sections
+}
+
+// withoutCredentials — секция admin без токенов и правил для сертификатов, которые применяются без перезапуска.
+func withoutCredentials(admin Admin) Admin {
+	admin.Auth.Tokens, admin.Auth.ClientCerts = nil, nil
+	return admin
+}
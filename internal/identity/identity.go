@@ -0,0 +1,246 @@
+package identity
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"load-balancer/internal/apikey"
+)
+
+// Типы источников идентификации клиента.
+const (
+	SourceAPIKey = "api_key"
+	SourceHeader = "header"
+	SourceQuery  = "query"
+	SourceJWT    = "jwt"
+	SourceMTLS   = "mtls"
+	SourceIP     = "ip"
+)
+
+// Поля клиентского сертификата для идентификации через mTLS.
+const (
+	FieldSubject = "subject"
+	FieldSAN     = "san"
+)
+
+// MissingError — в запросе нет данных, по которым источник определяет клиента.
+type MissingError struct {
+	What string
+}
+
+func (e *MissingError) Error() string { return "missing " + e.What }
+
+// Identity — клиент, от имени которого выполняется запрос.
+type Identity struct {
+	// ClientID — ID клиента, у которого берутся лимиты, статус и квоты.
+	ClientID string
+	// Key — ключ, по которому считается расход лимитов клиента. Без combine совпадает с ClientID, с combine — значения
+	// всех источников через разделитель.
+	Key string
+	// Source — источники, по которым определён клиент, например api_key или api_key+ip.
+	Source string
+}
+
+type contextKey struct{}
+
+// WithIdentity — возвращает контекст, в котором хранится клиент запроса.
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext — возвращает клиента запроса, если он уже определён.
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(contextKey{}).(Identity)
+	return id, ok
+}
+
+// SourceConfig — источник идентификации. Какие поля нужны, зависит от Type.
+type SourceConfig struct {
+	Type string
+	// Header — заголовок для api_key, header и jwt.
+	Header string
+	// Param — параметр запроса для query.
+	Param string
+	// Claim, JWKSFile, Issuer и Audience — проверка JWT: из какого claim брать клиента, ключи для проверки подписи,
+	// ожидаемые iss и aud (пустые не проверяются).
+	Claim    string
+	JWKSFile string
+	Issuer   string
+	Audience string
+	// Field — поле сертификата для mtls: subject (CN) или san (первый DNS SAN, а без него email).
+	Field string
+	// IPv4Prefix и IPv6Prefix — длина подсети, до которой обрезается адрес клиента для ip.
+	IPv4Prefix int
+	IPv6Prefix int
+	// TrustedProxies — адреса и подсети прокси, которым можно верить в X-Forwarded-For.
+	TrustedProxies []string
+}
+
+// Config — как определяется клиент запроса. Без Combine клиентом становится первый источник, нашедший данные в
+// запросе; с Combine нужны все источники, клиентом становится первый из них, а значения всех склеиваются через
+// Separator в ключ, по которому считается расход лимитов клиента.
+type Config struct {
+	Sources   []SourceConfig
+	Combine   bool
+	Separator string
+}
+
+// source — один способ определить клиента по запросу.
+type source interface {
+	name() string
+	// identify — возвращает значение, определяющее клиента, или *MissingError, если в запросе нет нужных данных.
+	identify(r *http.Request) (string, error)
+}
+
+type Extractor struct {
+	sources   []source
+	combine   bool
+	separator string
+}
+
+// NewExtractor — создаёт определение клиента по настройкам. keys нужен для источника api_key; ключи JWKS читаются
+// из файлов сразу, поэтому ошибки в них обнаруживаются при старте.
+func NewExtractor(cfg Config, keys *apikey.Resolver) (*Extractor, error) {
+	if len(cfg.Sources) == 0 {
+		return nil, errors.New("no identity sources configured")
+	}
+
+	e := &Extractor{combine: cfg.Combine, separator: cfg.Separator}
+	for _, sc := range cfg.Sources {
+		var (
+			s   source
+			err error
+		)
+		switch sc.Type {
+		case SourceAPIKey:
+			s = &apiKeySource{header: sc.Header, keys: keys}
+		case SourceHeader:
+			s = &headerSource{header: sc.Header}
+		case SourceQuery:
+			s = &querySource{param: sc.Param}
+		case SourceJWT:
+			s, err = newJWTSource(sc)
+		case SourceMTLS:
+			s = &mtlsSource{field: sc.Field}
+		case SourceIP:
+			s, err = newIPSource(sc)
+		default:
+			err = errors.Errorf("unknown identity source %q", sc.Type)
+		}
+		if err != nil {
+			return nil, err
+		}
+		e.sources = append(e.sources, s)
+	}
+	return e, nil
+}
+
+// Extract — определяет клиента запроса и ключ расхода его лимитов. Если данных нет, возвращает *MissingError первого
+// источника, который их не нашёл; ошибки проверки (неизвестный ключ, неверный токен) возвращаются как есть.
+func (e *Extractor) Extract(r *http.Request) (Identity, error) {
+	var (
+		parts   []string
+		names   []string
+		missing error
+	)
+	for _, s := range e.sources {
+		value, err := s.identify(r)
+		var missingErr *MissingError
+		if errors.As(err, &missingErr) && !e.combine {
+			if missing == nil {
+				missing = err
+			}
+			continue
+		}
+		if err != nil {
+			return Identity{}, err
+		}
+
+		if !e.combine {
+			return Identity{ClientID: value, Key: value, Source: s.name()}, nil
+		}
+		parts = append(parts, value)
+		names = append(names, s.name())
+	}
+	if !e.combine {
+		return Identity{}, missing
+	}
+	return Identity{ClientID: parts[0], Key: strings.Join(parts, e.separator), Source: strings.Join(names, "+")}, nil
+}
+
+// apiKeySource — клиент, которому выдан API-ключ из заголовка.
+type apiKeySource struct {
+	header string
+	keys   *apikey.Resolver
+}
+
+func (s *apiKeySource) name() string { return SourceAPIKey }
+
+func (s *apiKeySource) identify(r *http.Request) (string, error) {
+	key := r.Header.Get(s.header)
+	if key == "" {
+		return "", &MissingError{What: s.header + " header"}
+	}
+	return s.keys.Resolve(r.Context(), key)
+}
+
+// headerSource — значение заголовка как есть. Заголовок должен выставлять доверенный сервис перед балансировщиком.
+type headerSource struct {
+	header string
+}
+
+func (s *headerSource) name() string { return SourceHeader }
+
+func (s *headerSource) identify(r *http.Request) (string, error) {
+	value := strings.TrimSpace(r.Header.Get(s.header))
+	if value == "" {
+		return "", &MissingError{What: s.header + " header"}
+	}
+	return value, nil
+}
+
+// querySource — значение параметра запроса как есть.
+type querySource struct {
+	param string
+}
+
+func (s *querySource) name() string { return SourceQuery }
+
+func (s *querySource) identify(r *http.Request) (string, error) {
+	value := r.URL.Query().Get(s.param)
+	if value == "" {
+		return "", &MissingError{What: s.param + " query parameter"}
+	}
+	return value, nil
+}
+
+// mtlsSource — CN или SAN клиентского сертификата, проверенного при TLS-рукопожатии.
+type mtlsSource struct {
+	field string
+}
+
+func (s *mtlsSource) name() string { return SourceMTLS }
+
+func (s *mtlsSource) identify(r *http.Request) (string, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return "", &MissingError{What: "client certificate"}
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+
+	var value string
+	if s.field == FieldSAN {
+		if len(cert.DNSNames) > 0 {
+			value = cert.DNSNames[0]
+		} else if len(cert.EmailAddresses) > 0 {
+			value = cert.EmailAddresses[0]
+		}
+	} else {
+		value = cert.Subject.CommonName
+	}
+	if value == "" {
+		return "", &MissingError{What: "client certificate " + s.field}
+	}
+	return value, nil
+}
@@ -0,0 +1,72 @@
+package identity
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	sources := []SourceConfig{
+		{Type: SourceHeader, Header: "X-Client"},
+		{Type: SourceIP, IPv4Prefix: 24, IPv6Prefix: 64},
+	}
+
+	tests := []struct {
+		name        string
+		combine     bool
+		header      string
+		want        Identity
+		wantMissing bool
+	}{
+		{
+			name:   "first source found",
+			header: "acme",
+			want:   Identity{ClientID: "acme", Key: "acme", Source: SourceHeader},
+		},
+		{
+			name: "falls through to next source",
+			want: Identity{ClientID: "203.0.113.0/24", Key: "203.0.113.0/24", Source: SourceIP},
+		},
+		{
+			name:    "combine takes client from first source",
+			combine: true,
+			header:  "acme",
+			want:    Identity{ClientID: "acme", Key: "acme:203.0.113.0/24", Source: "header+ip"},
+		},
+		{
+			name:        "combine requires all sources",
+			combine:     true,
+			wantMissing: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := NewExtractor(Config{Sources: sources, Combine: tt.combine, Separator: ":"}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = "203.0.113.7:4321"
+			if tt.header != "" {
+				r.Header.Set("X-Client", tt.header)
+			}
+
+			got, err := e.Extract(r)
+			var missing *MissingError
+			if tt.wantMissing {
+				if !errors.As(err, &missing) {
+					t.Fatalf("Extract() error = %v, want *MissingError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Extract() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
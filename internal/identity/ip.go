@@ -0,0 +1,123 @@
+package identity
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ipSource — адрес клиента или его подсеть. Если запрос пришёл от доверенного прокси, адрес берётся из
+// X-Forwarded-For: первый справа адрес, который не принадлежит доверенным прокси.
+type ipSource struct {
+	ipv4Prefix int
+	ipv6Prefix int
+	trusted    TrustedProxies
+}
+
+func newIPSource(cfg SourceConfig) (*ipSource, error) {
+	trusted, err := ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return &ipSource{ipv4Prefix: cfg.IPv4Prefix, ipv6Prefix: cfg.IPv6Prefix, trusted: trusted}, nil
+}
+
+func (s *ipSource) name() string { return SourceIP }
+
+func (s *ipSource) identify(r *http.Request) (string, error) {
+	addr, ok := s.trusted.ClientAddr(r)
+	if !ok {
+		return "", &MissingError{What: "client address"}
+	}
+
+	bits := s.ipv6Prefix
+	if addr.Is4() {
+		bits = s.ipv4Prefix
+	}
+	if bits >= addr.BitLen() {
+		return addr.String(), nil
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to mask client address")
+	}
+	return prefix.String(), nil
+}
+
+// TrustedProxies — адреса и подсети прокси, которым можно верить в X-Forwarded-For и других заголовках, которые
+// выставляет прокси.
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies — разбирает список адресов и подсетей доверенных прокси.
+func ParseTrustedProxies(raw []string) (TrustedProxies, error) {
+	var trusted TrustedProxies
+	for _, value := range raw {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(value)
+			if addrErr != nil {
+				return nil, errors.Errorf("invalid trusted proxy %q", value)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		trusted = append(trusted, prefix.Masked())
+	}
+	return trusted, nil
+}
+
+// FromTrusted — пришёл ли запрос напрямую от доверенного прокси.
+func (t TrustedProxies) FromTrusted(r *http.Request) bool {
+	addr, ok := peerAddr(r)
+	return ok && t.Contains(addr)
+}
+
+// ClientAddr — настоящий адрес клиента. Если запрос пришёл от доверенного прокси, адрес берётся из X-Forwarded-For:
+// первый справа адрес, который не принадлежит доверенным прокси.
+func (t TrustedProxies) ClientAddr(r *http.Request) (netip.Addr, bool) {
+	addr, ok := peerAddr(r)
+	if !ok {
+		return netip.Addr{}, false
+	}
+	if !t.Contains(addr) {
+		return addr, true
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !t.Contains(addr) {
+			break
+		}
+	}
+	return addr, true
+}
+
+// Contains — принадлежит ли адрес доверенному прокси.
+func (t TrustedProxies) Contains(addr netip.Addr) bool {
+	for _, prefix := range t {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// peerAddr — адрес, с которого пришло соединение.
+func peerAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
@@ -0,0 +1,86 @@
+package identity
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestTrustedProxiesClientAddr(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+		wantOK     bool
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.7:1234", want: "203.0.113.7", wantOK: true},
+		{
+			name: "forwarded header from untrusted peer is ignored", remoteAddr: "203.0.113.7:1234",
+			forwarded: []string{"198.51.100.1"}, want: "203.0.113.7", wantOK: true,
+		},
+		{name: "trusted proxy", remoteAddr: "10.0.0.1:1234", forwarded: []string{"198.51.100.1"}, want: "198.51.100.1", wantOK: true},
+		{
+			name: "chain of trusted proxies", remoteAddr: "10.0.0.1:1234",
+			forwarded: []string{"198.51.100.1, 192.0.2.1, 10.2.3.4"}, want: "198.51.100.1", wantOK: true,
+		},
+		{
+			name: "spoofed leftmost address is skipped", remoteAddr: "10.0.0.1:1234",
+			forwarded: []string{"1.2.3.4, 198.51.100.1"}, want: "198.51.100.1", wantOK: true,
+		},
+		{
+			name: "several header lines", remoteAddr: "10.0.0.1:1234",
+			forwarded: []string{"1.2.3.4", "198.51.100.1, 10.0.0.2"}, want: "198.51.100.1", wantOK: true,
+		},
+		{
+			name: "garbage stops the walk", remoteAddr: "10.0.0.1:1234",
+			forwarded: []string{"198.51.100.1, unknown, 10.0.0.2"}, want: "10.0.0.2", wantOK: true,
+		},
+		{name: "trusted proxy without header", remoteAddr: "10.0.0.1:1234", want: "10.0.0.1", wantOK: true},
+		{name: "all hops trusted", remoteAddr: "10.0.0.1:1234", forwarded: []string{"10.0.0.3, 10.0.0.2"}, want: "10.0.0.3", wantOK: true},
+		{name: "IPv4-mapped IPv6", remoteAddr: "[::ffff:10.0.0.1]:1234", forwarded: []string{"::ffff:198.51.100.1"}, want: "198.51.100.1", wantOK: true},
+		{name: "unparsable remote address", remoteAddr: "pipe", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+
+			got, ok := trusted.ClientAddr(r)
+			if ok != tt.wantOK {
+				t.Fatalf("ClientAddr() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && got != netip.MustParseAddr(tt.want) {
+				t.Errorf("ClientAddr() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		raw     []string
+		wantErr bool
+	}{
+		{raw: nil},
+		{raw: []string{"10.0.0.0/8", "2001:db8::/32", "192.0.2.1", "::1"}},
+		{raw: []string{"10.0.0.1/8"}},
+		{raw: []string{"10.0.0.0/33"}, wantErr: true},
+		{raw: []string{"proxy.internal"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		_, err := ParseTrustedProxies(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTrustedProxies(%v) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+		}
+	}
+}
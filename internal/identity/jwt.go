@@ -0,0 +1,318 @@
+package identity
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// jwk — открытый ключ из JWKS. Поддерживаются ключи RSA, EC (P-256, P-384, P-521) и Ed25519.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// esCurves — кривая, которой требует каждый алгоритм ES*: подпись другой кривой токен с этим alg не проходит.
+var esCurves = map[string]elliptic.Curve{
+	"ES256": elliptic.P256(),
+	"ES384": elliptic.P384(),
+	"ES512": elliptic.P521(),
+}
+
+type verificationKey struct {
+	kid string
+	alg string
+	key crypto.PublicKey
+}
+
+// jwtSource — claim bearer-токена, подпись которого проверена ключами из локального JWKS-файла.
+type jwtSource struct {
+	header   string
+	claim    string
+	issuer   string
+	audience string
+	keys     []verificationKey
+}
+
+func newJWTSource(cfg SourceConfig) (*jwtSource, error) {
+	data, err := os.ReadFile(cfg.JWKSFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read JWKS file")
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, errors.Wrap(err, "failed to parse JWKS file")
+	}
+
+	s := &jwtSource{header: cfg.Header, claim: cfg.Claim, issuer: cfg.Issuer, audience: cfg.Audience}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid JWKS key %q", k.Kid)
+		}
+		s.keys = append(s.keys, verificationKey{kid: k.Kid, alg: k.Alg, key: key})
+	}
+	if len(s.keys) == 0 {
+		return nil, errors.Errorf("JWKS file %s contains no signing keys", cfg.JWKSFile)
+	}
+	return s, nil
+}
+
+func (s *jwtSource) name() string { return SourceJWT }
+
+func (s *jwtSource) identify(r *http.Request) (string, error) {
+	raw := r.Header.Get(s.header)
+	token, ok := strings.CutPrefix(raw, "Bearer ")
+	if !ok && strings.EqualFold(s.header, "Authorization") {
+		return "", &MissingError{What: "bearer token"}
+	}
+	raw = strings.TrimSpace(token)
+	if raw == "" {
+		return "", &MissingError{What: "bearer token"}
+	}
+
+	claims, err := s.verify(raw, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	switch value := claims[s.claim].(type) {
+	case string:
+		if value != "" {
+			return value, nil
+		}
+	case json.Number:
+		return value.String(), nil
+	}
+	return "", errors.Wrapf(ErrInvalidToken, "claim %q is missing", s.claim)
+}
+
+// verify — проверяет подпись, срок действия и, если заданы, издателя и аудиторию токена и возвращает его claims.
+func (s *jwtSource) verify(raw string, now time.Time) (map[string]any, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, key := range s.keys {
+		if header.Kid != "" && key.kid != "" && key.kid != header.Kid {
+			continue
+		}
+		if key.alg != "" && key.alg != header.Alg {
+			continue
+		}
+		if verifySignature(header.Alg, key.key, signed, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, errors.Wrap(ErrInvalidToken, "signature verification failed")
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if exp, ok := numericDate(claims["exp"]); ok && !now.Before(exp) {
+		return nil, errors.Wrap(ErrInvalidToken, "token expired")
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Before(nbf) {
+		return nil, errors.Wrap(ErrInvalidToken, "token not yet valid")
+	}
+	if s.issuer != "" && claims["iss"] != s.issuer {
+		return nil, errors.Wrap(ErrInvalidToken, "unexpected issuer")
+	}
+	if s.audience != "" && !hasAudience(claims["aud"], s.audience) {
+		return nil, errors.Wrap(ErrInvalidToken, "unexpected audience")
+	}
+	return claims, nil
+}
+
+// decodeSegment — декодирует JSON из сегмента токена. Числа остаются json.Number: через float64 числовой claim
+// вроде 1234567 превратился бы в 1.234567e+06, а идентификаторы больше 2^53 потеряли бы точность.
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("unexpected data after JSON value")
+	}
+	return nil
+}
+
+// numericDate — значение claim exp или nbf: число секунд Unix.
+func numericDate(value any) (time.Time, bool) {
+	n, ok := value.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(seconds), 0), true
+}
+
+// hasAudience — aud может быть строкой или списком строк.
+func hasAudience(aud any, audience string) bool {
+	switch value := aud.(type) {
+	case string:
+		return value == audience
+	case []any:
+		for _, item := range value {
+			if item == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifySignature — проверяет подпись JWS алгоритмом alg. Алгоритмы с общим секретом и none не принимаются, а ключ
+// EC должен быть на кривой, которой требует alg.
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) bool {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	case "EdDSA":
+		edKey, ok := key.(ed25519.PublicKey)
+		return ok && ed25519.Verify(edKey, signed, signature)
+	default:
+		return false
+	}
+
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if strings.HasPrefix(alg, "RS") {
+			return rsa.VerifyPKCS1v15(k, hash, digest, signature) == nil
+		}
+		if strings.HasPrefix(alg, "PS") {
+			return rsa.VerifyPSS(k, hash, digest, signature, nil) == nil
+		}
+	case *ecdsa.PublicKey:
+		if esCurves[alg] != k.Curve {
+			return false
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(k, digest, r, s)
+	}
+	return false
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid n")
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid e")
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid e")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid x")
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid y")
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return key, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, errors.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid x")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, errors.Errorf("unsupported key type %q", k.Kty)
+	}
+}
@@ -0,0 +1,216 @@
+package identity
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signJWT — собирает токен с заголовком header и claims, подписанный sign.
+func signJWT(t *testing.T, header, claims map[string]any, sign func(signed []byte) []byte) string {
+	t.Helper()
+	encode := func(v any) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(header) + "." + encode(claims)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+// signES — подпись ECDSA в формате JWS: r и s фиксированной длины подряд.
+func signES(t *testing.T, key *ecdsa.PrivateKey, digest []byte) []byte {
+	t.Helper()
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := (key.Curve.Params().BitSize + 7) / 8
+	signature := make([]byte, 2*size)
+	r.FillBytes(signature[:size])
+	s.FillBytes(signature[size:])
+	return signature
+}
+
+func TestJWTVerify(t *testing.T) {
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+
+	es256 := func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		return signES(t, p256, digest[:])
+	}
+	es256WithP384 := func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		return signES(t, p384, digest[:])
+	}
+	es384 := func(signed []byte) []byte {
+		digest := sha512.Sum384(signed)
+		return signES(t, p384, digest[:])
+	}
+	rs256 := func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signature
+	}
+	eddsa := func(signed []byte) []byte { return ed25519.Sign(edPrivate, signed) }
+	none := func([]byte) []byte { return nil }
+
+	s := &jwtSource{
+		claim:    "sub",
+		issuer:   "https://issuer.example",
+		audience: "lb",
+		keys: []verificationKey{
+			{kid: "ec256", key: &p256.PublicKey},
+			{kid: "ec384", key: &p384.PublicKey},
+			{kid: "rsa", alg: "RS256", key: &rsaKey.PublicKey},
+			{kid: "ed", key: edPublic},
+		},
+	}
+
+	now := time.Unix(1_700_000_000, 0)
+	valid := func(overrides map[string]any) map[string]any {
+		claims := map[string]any{"sub": "acme", "iss": "https://issuer.example", "aud": "lb",
+			"exp": now.Add(time.Hour).Unix(), "nbf": now.Add(-time.Minute).Unix()}
+		for k, v := range overrides {
+			if v == nil {
+				delete(claims, k)
+			} else {
+				claims[k] = v
+			}
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		header  map[string]any
+		claims  map[string]any
+		sign    func([]byte) []byte
+		wantErr bool
+	}{
+		{name: "ES256", header: map[string]any{"alg": "ES256", "kid": "ec256"}, claims: valid(nil), sign: es256},
+		{name: "ES384", header: map[string]any{"alg": "ES384", "kid": "ec384"}, claims: valid(nil), sign: es384},
+		{name: "RS256", header: map[string]any{"alg": "RS256", "kid": "rsa"}, claims: valid(nil), sign: rs256},
+		{name: "EdDSA", header: map[string]any{"alg": "EdDSA", "kid": "ed"}, claims: valid(nil), sign: eddsa},
+		{name: "no kid tries all keys", header: map[string]any{"alg": "ES256"}, claims: valid(nil), sign: es256},
+		{name: "aud list", header: map[string]any{"alg": "EdDSA"}, claims: valid(map[string]any{"aud": []string{"other", "lb"}}), sign: eddsa},
+		{
+			name: "ES256 signed with P-384 key", header: map[string]any{"alg": "ES256", "kid": "ec384"},
+			claims: valid(nil), sign: es256WithP384, wantErr: true,
+		},
+		{
+			name: "ES256 without kid signed with P-384 key", header: map[string]any{"alg": "ES256"},
+			claims: valid(nil), sign: es256WithP384, wantErr: true,
+		},
+		{name: "alg none", header: map[string]any{"alg": "none"}, claims: valid(nil), sign: none, wantErr: true},
+		{name: "HS256 rejected", header: map[string]any{"alg": "HS256", "kid": "rsa"}, claims: valid(nil), sign: rs256, wantErr: true},
+		{name: "alg does not match key alg", header: map[string]any{"alg": "RS384", "kid": "rsa"}, claims: valid(nil), sign: rs256, wantErr: true},
+		{name: "unknown kid", header: map[string]any{"alg": "ES256", "kid": "missing"}, claims: valid(nil), sign: es256, wantErr: true},
+		{name: "kid of another key", header: map[string]any{"alg": "EdDSA", "kid": "ec256"}, claims: valid(nil), sign: eddsa, wantErr: true},
+		{name: "expired", header: map[string]any{"alg": "EdDSA"}, claims: valid(map[string]any{"exp": now.Unix()}), sign: eddsa, wantErr: true},
+		{name: "not yet valid", header: map[string]any{"alg": "EdDSA"}, claims: valid(map[string]any{"nbf": now.Add(time.Second).Unix()}), sign: eddsa, wantErr: true},
+		{name: "wrong issuer", header: map[string]any{"alg": "EdDSA"}, claims: valid(map[string]any{"iss": "https://evil.example"}), sign: eddsa, wantErr: true},
+		{name: "wrong audience", header: map[string]any{"alg": "EdDSA"}, claims: valid(map[string]any{"aud": "other"}), sign: eddsa, wantErr: true},
+		{name: "missing audience", header: map[string]any{"alg": "EdDSA"}, claims: valid(map[string]any{"aud": nil}), sign: eddsa, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := s.verify(signJWT(t, tt.header, tt.claims, tt.sign), now)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Fatalf("verify() error = %v, want ErrInvalidToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verify() error = %v", err)
+			}
+			if claims["sub"] != "acme" {
+				t.Errorf("sub = %v, want acme", claims["sub"])
+			}
+		})
+	}
+}
+
+func TestJWTVerifyTampered(t *testing.T) {
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	s := &jwtSource{claim: "sub", keys: []verificationKey{{key: edPublic}}}
+	token := signJWT(t, map[string]any{"alg": "EdDSA"}, map[string]any{"sub": "acme"},
+		func(signed []byte) []byte { return ed25519.Sign(edPrivate, signed) })
+	forged := strings.Split(signJWT(t, map[string]any{"alg": "EdDSA"}, map[string]any{"sub": "admin"},
+		func([]byte) []byte { return nil }), ".")
+	parts := strings.Split(token, ".")
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "claims swapped", token: parts[0] + "." + forged[1] + "." + parts[2]},
+		{name: "signature stripped", token: parts[0] + "." + parts[1] + "."},
+		{name: "two segments", token: parts[0] + "." + parts[1]},
+		{name: "garbage", token: "a.b.c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.verify(tt.token, time.Now()); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("verify() error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestJWTIdentifyNumericClaim(t *testing.T) {
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	s := &jwtSource{header: "Authorization", claim: "sub", keys: []verificationKey{{key: edPublic}}}
+	sign := func(signed []byte) []byte { return ed25519.Sign(edPrivate, signed) }
+
+	tests := []struct {
+		name string
+		sub  any
+		want string
+	}{
+		{name: "string", sub: "acme", want: "acme"},
+		{name: "integer", sub: 1234567, want: "1234567"},
+		{name: "integer above 2^53", sub: json.Number("9007199254740993"), want: "9007199254740993"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exp := time.Now().Add(time.Hour).Unix()
+			token := signJWT(t, map[string]any{"alg": "EdDSA"}, map[string]any{"sub": tt.sub, "exp": exp}, sign)
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Authorization", "Bearer "+token)
+
+			got, err := s.identify(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("identify() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
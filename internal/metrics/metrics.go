@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+)
+
+// Решения рейт-лимитера, которые передаются в ObserveRateLimit.
+const (
+	DecisionAllowed  = "allowed"
+	DecisionLimited  = "limited"
+	DecisionRejected = "rejected"
+	DecisionError    = "error"
+	// DecisionQuotaExceeded — запрос отклонён, потому что клиент исчерпал квоту на день, неделю или месяц.
+	DecisionQuotaExceeded = "quota_exceeded"
+)
+
+// Операции TokenBucket, для которых измеряется длительность и число ошибок.
+const (
+	OperationSync      = "sync"
+	OperationReplenish = "replenish"
+	// OperationTake — атомарное получение токенов из БД в распределённом режиме.
+	OperationTake = "take"
+)
+
+// Recorder — точка инструментирования сервиса. Реализации получают события от прокси, балансировщиков и TokenBucket
+// и переводят их в метрики конкретной системы мониторинга.
+type Recorder interface {
+	// ObserveRequest — учитывает завершённый проксированный запрос и время ответа апстрима. Пустой backend означает,
+	// что запрос не дошёл до апстрима (нет маршрута или доступных бэкендов): такой запрос учитывается только в счётчике
+	// запросов, а не в распределении времени ответа.
+	ObserveRequest(route, pool, backend, method string, status int, upstreamLatency time.Duration)
+	// IncInFlight — увеличивает число запросов, которые сейчас обрабатывает бэкенд.
+	IncInFlight(pool, backend string)
+	// DecInFlight — уменьшает число запросов, которые сейчас обрабатывает бэкенд.
+	DecInFlight(pool, backend string)
+	// SetBackendAvailable — выставляет текущую доступность бэкенда.
+	SetBackendAvailable(pool, backend string, available bool)
+	// ObserveHealthCheck — учитывает результат и длительность очередной проверки доступности бэкенда.
+	ObserveHealthCheck(pool, backend string, ok bool, duration time.Duration)
+	// ObserveBalancerPick — учитывает выбор бэкенда балансировщиком; пустой backend означает, что выбрать было не из чего.
+	ObserveBalancerPick(pool, strategy, backend string)
+	// ObserveRateLimit — учитывает решение рейт-лимитера по клиенту.
+	ObserveRateLimit(clientID, decision string)
+	// ObserveTokenBucketOperation — учитывает длительность и результат синхронизации или пополнения токенов.
+	ObserveTokenBucketOperation(operation string, duration time.Duration, err error)
+}
+
+// StatusClass — сворачивает HTTP-статус в класс вида "2xx", чтобы не раздувать кардинальность метрик.
+func StatusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+type nop struct{}
+
+// NewNop — возвращает Recorder, который ничего не делает. Удобен там, где метрики не нужны.
+func NewNop() Recorder {
+	return nop{}
+}
+
+func (nop) ObserveRequest(string, string, string, string, int, time.Duration) {}
+func (nop) IncInFlight(string, string)                                        {}
+func (nop) DecInFlight(string, string)                                        {}
+func (nop) SetBackendAvailable(string, string, bool)                          {}
+func (nop) ObserveHealthCheck(string, string, bool, time.Duration)            {}
+func (nop) ObserveBalancerPick(string, string, string)                        {}
+func (nop) ObserveRateLimit(string, string)                                   {}
+func (nop) ObserveTokenBucketOperation(string, time.Duration, error)          {}
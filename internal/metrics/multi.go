@@ -0,0 +1,61 @@
+package metrics
+
+import "time"
+
+type multi []Recorder
+
+// NewMulti — объединяет несколько Recorder в один: каждое событие передаётся во все переданные реализации.
+func NewMulti(recorders ...Recorder) Recorder {
+	if len(recorders) == 1 {
+		return recorders[0]
+	}
+	return multi(recorders)
+}
+
+func (m multi) ObserveRequest(route, pool, backend, method string, status int, upstreamLatency time.Duration) {
+	for _, r := range m {
+		r.ObserveRequest(route, pool, backend, method, status, upstreamLatency)
+	}
+}
+
+func (m multi) IncInFlight(pool, backend string) {
+	for _, r := range m {
+		r.IncInFlight(pool, backend)
+	}
+}
+
+func (m multi) DecInFlight(pool, backend string) {
+	for _, r := range m {
+		r.DecInFlight(pool, backend)
+	}
+}
+
+func (m multi) SetBackendAvailable(pool, backend string, available bool) {
+	for _, r := range m {
+		r.SetBackendAvailable(pool, backend, available)
+	}
+}
+
+func (m multi) ObserveHealthCheck(pool, backend string, ok bool, duration time.Duration) {
+	for _, r := range m {
+		r.ObserveHealthCheck(pool, backend, ok, duration)
+	}
+}
+
+func (m multi) ObserveBalancerPick(pool, strategy, backend string) {
+	for _, r := range m {
+		r.ObserveBalancerPick(pool, strategy, backend)
+	}
+}
+
+func (m multi) ObserveRateLimit(clientID, decision string) {
+	for _, r := range m {
+		r.ObserveRateLimit(clientID, decision)
+	}
+}
+
+func (m multi) ObserveTokenBucketOperation(operation string, duration time.Duration, err error) {
+	for _, r := range m {
+		r.ObserveTokenBucketOperation(operation, duration, err)
+	}
+}
@@ -0,0 +1,200 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "lb"
+
+	// otherClientLabel — значение метки client для клиентов, не попавших в лимит кардинальности.
+	otherClientLabel = "__other__"
+)
+
+type Prometheus struct {
+	registry *prometheus.Registry
+
+	requests         *prometheus.CounterVec
+	upstreamLatency  *prometheus.HistogramVec
+	inFlight         *prometheus.GaugeVec
+	backendAvailable *prometheus.GaugeVec
+	healthChecks     *prometheus.CounterVec
+	healthCheckTime  *prometheus.HistogramVec
+	balancerPicks    *prometheus.CounterVec
+	rateLimit        *prometheus.CounterVec
+	tbDuration       *prometheus.HistogramVec
+	tbFailures       *prometheus.CounterVec
+
+	clients *clientLabels
+}
+
+// NewPrometheus — создаёт Recorder, публикующий метрики в собственном реестре Prometheus. maxClientLabels ограничивает
+// число различных клиентов в метриках рейт-лимита, остальные попадают под общую метку.
+func NewPrometheus(maxClientLabels int) *Prometheus {
+	p := &Prometheus{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Proxied requests by route, pool, backend, method and status class.",
+		}, []string{"route", "pool", "backend", "method", "status_class"}),
+		upstreamLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "upstream_request_duration_seconds",
+			Help:      "Time spent waiting for the upstream backend response.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"pool", "backend"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "backend_in_flight_requests",
+			Help:      "Requests currently being served by the backend.",
+		}, []string{"pool", "backend"}),
+		backendAvailable: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "backend_available",
+			Help:      "Whether the backend is available (1) or not (0).",
+		}, []string{"pool", "backend"}),
+		healthChecks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "health_checks_total",
+			Help:      "Backend health check results.",
+		}, []string{"pool", "backend", "result"}),
+		healthCheckTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "health_check_duration_seconds",
+			Help:      "Duration of backend health checks.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"pool", "backend"}),
+		balancerPicks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "balancer_picks_total",
+			Help:      "Backends chosen by the balancer; empty backend means no backend was available.",
+		}, []string{"pool", "strategy", "backend"}),
+		rateLimit: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limit_decisions_total",
+			Help:      "Rate limiter decisions by client.",
+		}, []string{"client", "decision"}),
+		tbDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "token_bucket_operation_duration_seconds",
+			Help:      "Duration of token bucket sync, replenish and take operations.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		tbFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_bucket_operation_failures_total",
+			Help:      "Failed token bucket sync, replenish and take operations.",
+		}, []string{"operation"}),
+		clients: newClientLabels(maxClientLabels),
+	}
+
+	p.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		p.requests,
+		p.upstreamLatency,
+		p.inFlight,
+		p.backendAvailable,
+		p.healthChecks,
+		p.healthCheckTime,
+		p.balancerPicks,
+		p.rateLimit,
+		p.tbDuration,
+		p.tbFailures,
+	)
+
+	return p
+}
+
+// RegisterDBPool — подключает к реестру статистику пула соединений pgxpool, которая снимается при каждом scrape.
+func (p *Prometheus) RegisterDBPool(stat func() *pgxpool.Stat) {
+	p.registry.MustRegister(newDBPoolCollector(stat))
+}
+
+// Handler — возвращает HTTP-хендлер, отдающий метрики в формате Prometheus.
+func (p *Prometheus) Handler() http.Handler {
+	return promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{})
+}
+
+func (p *Prometheus) ObserveRequest(route, pool, backend, method string, status int, upstreamLatency time.Duration) {
+	p.requests.WithLabelValues(route, pool, backend, method, StatusClass(status)).Inc()
+	if backend != "" {
+		p.upstreamLatency.WithLabelValues(pool, backend).Observe(upstreamLatency.Seconds())
+	}
+}
+
+func (p *Prometheus) IncInFlight(pool, backend string) {
+	p.inFlight.WithLabelValues(pool, backend).Inc()
+}
+
+func (p *Prometheus) DecInFlight(pool, backend string) {
+	p.inFlight.WithLabelValues(pool, backend).Dec()
+}
+
+func (p *Prometheus) SetBackendAvailable(pool, backend string, available bool) {
+	value := 0.0
+	if available {
+		value = 1
+	}
+	p.backendAvailable.WithLabelValues(pool, backend).Set(value)
+}
+
+func (p *Prometheus) ObserveHealthCheck(pool, backend string, ok bool, duration time.Duration) {
+	result := "success"
+	if !ok {
+		result = "failure"
+	}
+	p.healthChecks.WithLabelValues(pool, backend, result).Inc()
+	p.healthCheckTime.WithLabelValues(pool, backend).Observe(duration.Seconds())
+}
+
+func (p *Prometheus) ObserveBalancerPick(pool, strategy, backend string) {
+	p.balancerPicks.WithLabelValues(pool, strategy, backend).Inc()
+}
+
+func (p *Prometheus) ObserveRateLimit(clientID, decision string) {
+	p.rateLimit.WithLabelValues(p.clients.label(clientID), decision).Inc()
+}
+
+func (p *Prometheus) ObserveTokenBucketOperation(operation string, duration time.Duration, err error) {
+	p.tbDuration.WithLabelValues(operation).Observe(duration.Seconds())
+	if err != nil {
+		p.tbFailures.WithLabelValues(operation).Inc()
+	}
+}
+
+// clientLabels — ограничивает число различных значений метки client: первые max клиентов получают собственную метку,
+// остальные сводятся в otherClientLabel.
+type clientLabels struct {
+	mu   sync.Mutex
+	max  int
+	seen map[string]struct{}
+}
+
+func newClientLabels(max int) *clientLabels {
+	return &clientLabels{
+		max:  max,
+		seen: make(map[string]struct{}),
+	}
+}
+
+func (c *clientLabels) label(clientID string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.seen[clientID]; ok {
+		return clientID
+	}
+	if len(c.seen) >= c.max {
+		return otherClientLabel
+	}
+	c.seen[clientID] = struct{}{}
+	return clientID
+}
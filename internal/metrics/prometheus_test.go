@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveRequestWithoutBackend(t *testing.T) {
+	tests := []struct {
+		name        string
+		backend     string
+		status      int
+		wantSamples int
+	}{
+		{name: "proxied request", backend: "a:1", status: http.StatusOK, wantSamples: 1},
+		{name: "no route", status: http.StatusNotFound},
+		{name: "no available backend", status: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPrometheus(10)
+			p.ObserveRequest("r", "pool", tt.backend, http.MethodGet, tt.status, 20*time.Millisecond)
+
+			if got := testutil.CollectAndCount(p.requests); got != 1 {
+				t.Errorf("requests series = %d, want 1", got)
+			}
+			if got := testutil.CollectAndCount(p.upstreamLatency); got != tt.wantSamples {
+				t.Errorf("upstream latency series = %d, want %d", got, tt.wantSamples)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Диалекты протокола StatsD. Обычный StatsD не поддерживает теги, поэтому они отбрасываются.
+const (
+	FlavorStatsD    = "statsd"
+	FlavorDogStatsD = "dogstatsd"
+)
+
+const defaultMaxPacketSize = 1432
+
+// tagReplacer — заменяет символы, имеющие особый смысл в протоколе DogStatsD.
+var tagReplacer = strings.NewReplacer("|", "_", ",", "_", "#", "_", "\n", "_")
+
+// StatsDConfig — параметры отправки метрик в агент StatsD/DogStatsD.
+type StatsDConfig struct {
+	Address       string
+	Prefix        string
+	Flavor        string
+	Tags          []string
+	FlushInterval time.Duration
+	MaxPacketSize int
+}
+
+type StatsD struct {
+	conn   net.Conn
+	cfg    StatsDConfig
+	logger *zap.SugaredLogger
+
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	dbStat func() *pgxpool.Stat
+
+	inFlightMu sync.Mutex
+	inFlight   map[string]int64
+
+	clients *clientLabels
+}
+
+// NewStatsD — создаёт Recorder, который копит метрики в буфере и пачками отправляет их по UDP в агент StatsD/DogStatsD.
+func NewStatsD(cfg StatsDConfig, maxClientLabels int, logger *zap.SugaredLogger) (*StatsD, error) {
+	if cfg.Flavor == "" {
+		cfg.Flavor = FlavorDogStatsD
+	}
+	if cfg.Flavor != FlavorStatsD && cfg.Flavor != FlavorDogStatsD {
+		return nil, errors.Errorf("unknown statsd flavor %q", cfg.Flavor)
+	}
+	if cfg.MaxPacketSize <= 0 {
+		cfg.MaxPacketSize = defaultMaxPacketSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+
+	conn, err := net.Dial("udp", cfg.Address)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to dial statsd agent")
+	}
+
+	return &StatsD{
+		conn:     conn,
+		cfg:      cfg,
+		logger:   logger,
+		inFlight: make(map[string]int64),
+		clients:  newClientLabels(maxClientLabels),
+	}, nil
+}
+
+// RegisterDBPool — включает отправку статистики пула pgxpool при каждом сбросе буфера.
+func (s *StatsD) RegisterDBPool(stat func() *pgxpool.Stat) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dbStat = stat
+}
+
+// Run — периодически отправляет накопленные метрики, пока не будет отменён контекст. Перед выходом делает финальную
+// отправку и закрывает соединение.
+func (s *StatsD) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.Flush()
+			_ = s.conn.Close()
+			return
+		case <-ticker.C:
+			s.reportDBPool()
+			s.Flush()
+		}
+	}
+}
+
+// Flush — отправляет содержимое буфера одним пакетом.
+func (s *StatsD) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushLocked()
+}
+
+func (s *StatsD) flushLocked() {
+	if s.buf.Len() == 0 {
+		return
+	}
+	if _, err := s.conn.Write(s.buf.Bytes()); err != nil {
+		s.logger.Warnw("failed to send metrics to statsd", "error", err)
+	}
+	s.buf.Reset()
+}
+
+func (s *StatsD) ObserveRequest(route, pool, backend, method string, status int, upstreamLatency time.Duration) {
+	s.send("http_requests", "1|c", "route:"+route, "pool:"+pool, "backend:"+backend, "method:"+method,
+		"status_class:"+StatusClass(status))
+	if backend != "" {
+		s.send("upstream_request_duration", formatMillis(upstreamLatency)+"|ms", "pool:"+pool, "backend:"+backend)
+	}
+}
+
+func (s *StatsD) IncInFlight(pool, backend string) {
+	s.sendInFlight(pool, backend, 1)
+}
+
+func (s *StatsD) DecInFlight(pool, backend string) {
+	s.sendInFlight(pool, backend, -1)
+}
+
+// sendInFlight — хранит текущее значение счётчика локально и отправляет абсолютное значение: DogStatsD не понимает
+// относительные изменения gauge.
+func (s *StatsD) sendInFlight(pool, backend string, delta int64) {
+	key := pool + "\x00" + backend
+	s.inFlightMu.Lock()
+	s.inFlight[key] += delta
+	value := s.inFlight[key]
+	s.inFlightMu.Unlock()
+
+	s.send("backend_in_flight_requests", strconv.FormatInt(value, 10)+"|g", "pool:"+pool, "backend:"+backend)
+}
+
+func (s *StatsD) SetBackendAvailable(pool, backend string, available bool) {
+	value := "0|g"
+	if available {
+		value = "1|g"
+	}
+	s.send("backend_available", value, "pool:"+pool, "backend:"+backend)
+}
+
+func (s *StatsD) ObserveHealthCheck(pool, backend string, ok bool, duration time.Duration) {
+	result := "success"
+	if !ok {
+		result = "failure"
+	}
+	s.send("health_checks", "1|c", "pool:"+pool, "backend:"+backend, "result:"+result)
+	s.send("health_check_duration", formatMillis(duration)+"|ms", "pool:"+pool, "backend:"+backend)
+}
+
+func (s *StatsD) ObserveBalancerPick(pool, strategy, backend string) {
+	s.send("balancer_picks", "1|c", "pool:"+pool, "strategy:"+strategy, "backend:"+backend)
+}
+
+func (s *StatsD) ObserveRateLimit(clientID, decision string) {
+	s.send("rate_limit_decisions", "1|c", "client:"+s.clients.label(clientID), "decision:"+decision)
+}
+
+func (s *StatsD) ObserveTokenBucketOperation(operation string, duration time.Duration, err error) {
+	s.send("token_bucket_operation_duration", formatMillis(duration)+"|ms", "operation:"+operation)
+	if err != nil {
+		s.send("token_bucket_operation_failures", "1|c", "operation:"+operation)
+	}
+}
+
+// reportDBPool — отправляет текущие значения статистики пула соединений, если она была подключена.
+func (s *StatsD) reportDBPool() {
+	s.mu.Lock()
+	stat := s.dbStat
+	s.mu.Unlock()
+	if stat == nil {
+		return
+	}
+
+	st := stat()
+	if st == nil {
+		return
+	}
+	s.send("db_pool.acquired_conns", strconv.FormatInt(int64(st.AcquiredConns()), 10)+"|g")
+	s.send("db_pool.idle_conns", strconv.FormatInt(int64(st.IdleConns()), 10)+"|g")
+	s.send("db_pool.total_conns", strconv.FormatInt(int64(st.TotalConns()), 10)+"|g")
+	s.send("db_pool.max_conns", strconv.FormatInt(int64(st.MaxConns()), 10)+"|g")
+	s.send("db_pool.acquires", strconv.FormatInt(st.AcquireCount(), 10)+"|g")
+	s.send("db_pool.empty_acquires", strconv.FormatInt(st.EmptyAcquireCount(), 10)+"|g")
+	s.send("db_pool.canceled_acquires", strconv.FormatInt(st.CanceledAcquireCount(), 10)+"|g")
+}
+
+// send — форматирует строку метрики и добавляет её в буфер. Если пакет переполнится, буфер сначала отправляется.
+func (s *StatsD) send(name, value string, tags ...string) {
+	var line strings.Builder
+	line.WriteString(s.cfg.Prefix)
+	line.WriteString(name)
+	line.WriteByte(':')
+	line.WriteString(value)
+
+	if s.cfg.Flavor == FlavorDogStatsD && len(tags)+len(s.cfg.Tags) > 0 {
+		line.WriteString("|#")
+		for i, tag := range append(append([]string{}, s.cfg.Tags...), tags...) {
+			if i > 0 {
+				line.WriteByte(',')
+			}
+			line.WriteString(tagReplacer.Replace(tag))
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.buf.Len() > 0 && s.buf.Len()+1+line.Len() > s.cfg.MaxPacketSize {
+		s.flushLocked()
+	}
+	if s.buf.Len() > 0 {
+		s.buf.WriteByte('\n')
+	}
+	s.buf.WriteString(line.String())
+}
+
+func formatMillis(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
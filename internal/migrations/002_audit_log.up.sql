@@ -0,0 +1,15 @@
+CREATE TABLE audit_log (
+                           id BIGSERIAL PRIMARY KEY,
+                           occurred_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                           actor TEXT NOT NULL,
+                           action TEXT NOT NULL,
+                           target_type TEXT NOT NULL,
+                           target TEXT NOT NULL,
+                           before JSONB,
+                           after JSONB,
+                           source_ip TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_audit_log_occurred_at ON audit_log(occurred_at);
+CREATE INDEX idx_audit_log_target ON audit_log(target_type, target);
+CREATE INDEX idx_audit_log_actor ON audit_log(actor);
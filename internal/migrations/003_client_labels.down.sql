@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_clients_labels;
+ALTER TABLE clients DROP COLUMN IF EXISTS labels;
\ No newline at end of file
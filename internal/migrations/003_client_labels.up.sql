@@ -0,0 +1,3 @@
+ALTER TABLE clients ADD COLUMN labels JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX idx_clients_labels ON clients USING GIN (labels);
@@ -0,0 +1,10 @@
+CREATE TABLE api_keys (
+                          prefix TEXT PRIMARY KEY,
+                          client_id TEXT NOT NULL REFERENCES clients(client_id) ON DELETE CASCADE,
+                          key_hash BYTEA NOT NULL,
+                          created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                          expires_at TIMESTAMPTZ,
+                          revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_api_keys_client_id ON api_keys(client_id);
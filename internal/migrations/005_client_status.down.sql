@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_clients_status;
+ALTER TABLE clients DROP COLUMN IF EXISTS status, DROP COLUMN IF EXISTS expires_at;
\ No newline at end of file
@@ -0,0 +1,5 @@
+ALTER TABLE clients
+    ADD COLUMN status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'suspended', 'disabled')),
+    ADD COLUMN expires_at TIMESTAMPTZ;
+
+CREATE INDEX idx_clients_status ON clients(status);
@@ -0,0 +1 @@
+ALTER TABLE clients DROP COLUMN IF EXISTS algorithm;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE clients
+    ADD COLUMN algorithm TEXT NOT NULL DEFAULT 'token_bucket'
+        CHECK (algorithm IN ('token_bucket', 'sliding_window_log', 'sliding_window_counter', 'gcra', 'leaky_bucket'));
@@ -0,0 +1,12 @@
+ALTER TABLE clients DROP COLUMN rate_per_second;
+
+ALTER TABLE clients ADD COLUMN rate_per_second BIGINT;
+
+UPDATE clients SET rate_per_second = GREATEST(1, round(rate * 1000.0 / rate_period_ms));
+
+ALTER TABLE clients
+    ALTER COLUMN rate_per_second SET NOT NULL,
+    DROP COLUMN rate,
+    DROP COLUMN rate_period_ms,
+    ALTER COLUMN tokens TYPE BIGINT USING floor(tokens),
+    ALTER COLUMN last_refill_at TYPE BIGINT USING extract(epoch FROM last_refill_at)::bigint;
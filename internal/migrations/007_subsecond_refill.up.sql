@@ -0,0 +1,15 @@
+ALTER TABLE clients
+    ALTER COLUMN tokens TYPE DOUBLE PRECISION,
+    ALTER COLUMN last_refill_at TYPE TIMESTAMPTZ USING to_timestamp(last_refill_at),
+    ADD COLUMN rate BIGINT,
+    ADD COLUMN rate_period_ms BIGINT NOT NULL DEFAULT 1000 CHECK (rate_period_ms > 0);
+
+UPDATE clients SET rate = rate_per_second;
+
+ALTER TABLE clients
+    ALTER COLUMN rate SET NOT NULL,
+    ADD CONSTRAINT clients_rate_positive CHECK (rate > 0),
+    DROP COLUMN rate_per_second;
+
+ALTER TABLE clients
+    ADD COLUMN rate_per_second DOUBLE PRECISION GENERATED ALWAYS AS ((rate * 1000.0 / rate_period_ms)::double precision) STORED;
@@ -0,0 +1,13 @@
+CREATE TABLE rate_limit_policies (
+    name TEXT PRIMARY KEY,
+    method TEXT NOT NULL DEFAULT '',
+    path_pattern TEXT NOT NULL,
+    capacity BIGINT NOT NULL CHECK (capacity > 0),
+    rate BIGINT NOT NULL CHECK (rate > 0),
+    rate_period_ms BIGINT NOT NULL DEFAULT 1000 CHECK (rate_period_ms > 0),
+    algorithm TEXT NOT NULL DEFAULT 'token_bucket'
+        CHECK (algorithm IN ('token_bucket', 'sliding_window_log', 'sliding_window_counter', 'gcra', 'leaky_bucket')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (method, path_pattern)
+);
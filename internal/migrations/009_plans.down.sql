@@ -0,0 +1,19 @@
+DROP VIEW IF EXISTS client_limits;
+
+UPDATE clients c SET
+    capacity = COALESCE(c.capacity, p.capacity),
+    rate = COALESCE(c.rate, p.rate),
+    rate_period_ms = COALESCE(c.rate_period_ms, p.rate_period_ms),
+    algorithm = COALESCE(c.algorithm, p.algorithm)
+FROM plans p WHERE p.name = c.plan;
+
+ALTER TABLE clients
+    DROP CONSTRAINT clients_limits_or_plan,
+    DROP CONSTRAINT clients_rate_with_period,
+    DROP COLUMN plan,
+    ALTER COLUMN capacity SET NOT NULL,
+    ALTER COLUMN rate SET NOT NULL,
+    ALTER COLUMN rate_period_ms SET NOT NULL,
+    ALTER COLUMN algorithm SET NOT NULL;
+
+DROP TABLE IF EXISTS plans;
@@ -0,0 +1,44 @@
+CREATE TABLE plans (
+    name TEXT PRIMARY KEY,
+    capacity BIGINT NOT NULL CHECK (capacity > 0),
+    rate BIGINT NOT NULL CHECK (rate > 0),
+    rate_period_ms BIGINT NOT NULL DEFAULT 1000 CHECK (rate_period_ms > 0),
+    algorithm TEXT NOT NULL DEFAULT 'token_bucket'
+        CHECK (algorithm IN ('token_bucket', 'sliding_window_log', 'sliding_window_counter', 'gcra', 'leaky_bucket')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- У клиента с планом capacity, rate с rate_period_ms и algorithm — переопределения плана, NULL берёт значение плана.
+ALTER TABLE clients
+    ADD COLUMN plan TEXT REFERENCES plans(name) ON DELETE RESTRICT,
+    ALTER COLUMN capacity DROP NOT NULL,
+    ALTER COLUMN rate DROP NOT NULL,
+    ALTER COLUMN rate_period_ms DROP NOT NULL,
+    ALTER COLUMN algorithm DROP NOT NULL,
+    ADD CONSTRAINT clients_rate_with_period CHECK ((rate IS NULL) = (rate_period_ms IS NULL)),
+    ADD CONSTRAINT clients_limits_or_plan
+        CHECK (plan IS NOT NULL OR (capacity IS NOT NULL AND rate IS NOT NULL AND algorithm IS NOT NULL));
+
+CREATE INDEX idx_clients_plan ON clients(plan);
+
+-- client_limits — клиенты с действующими лимитами: собственными или взятыми из плана.
+CREATE VIEW client_limits AS
+SELECT c.client_id,
+       COALESCE(c.capacity, p.capacity) AS capacity,
+       COALESCE(c.rate, p.rate) AS rate,
+       COALESCE(c.rate_period_ms, p.rate_period_ms) AS rate_period_ms,
+       (COALESCE(c.rate, p.rate) * 1000.0 / COALESCE(c.rate_period_ms, p.rate_period_ms))::double precision AS rate_per_second,
+       c.tokens,
+       c.last_refill_at,
+       c.labels,
+       c.status,
+       c.expires_at,
+       COALESCE(c.algorithm, p.algorithm) AS algorithm,
+       c.plan,
+       c.capacity AS capacity_override,
+       c.rate AS rate_override,
+       c.rate_period_ms AS rate_period_ms_override,
+       c.algorithm AS algorithm_override
+FROM clients c
+LEFT JOIN plans p ON p.name = c.plan;
@@ -0,0 +1,9 @@
+CREATE TABLE client_quotas (
+    client_id TEXT NOT NULL REFERENCES clients(client_id) ON DELETE CASCADE,
+    period TEXT NOT NULL CHECK (period IN ('day', 'week', 'month')),
+    quota_limit BIGINT NOT NULL CHECK (quota_limit > 0),
+    time_zone TEXT NOT NULL DEFAULT 'UTC',
+    used BIGINT NOT NULL DEFAULT 0,
+    window_start TIMESTAMPTZ NOT NULL DEFAULT 'epoch',
+    PRIMARY KEY (client_id, period)
+);
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// Состояния API-ключа.
+const (
+	APIKeyActive  = "active"
+	APIKeyExpired = "expired"
+	APIKeyRevoked = "revoked"
+)
+
+// APIKey — выданный клиенту API-ключ. Сам ключ не хранится: только его префикс, по которому ключ ищется, и хэш.
+// ExpiresAt задаётся при ротации, чтобы старый ключ ещё работал в течение льготного периода.
+type APIKey struct {
+	Prefix    string     `json:"prefix"`
+	ClientID  string     `json:"client_id"`
+	Hash      []byte     `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// State — состояние ключа на момент now.
+func (k *APIKey) State(now time.Time) string {
+	switch {
+	case k.RevokedAt != nil:
+		return APIKeyRevoked
+	case k.ExpiresAt != nil && !now.Before(*k.ExpiresAt):
+		return APIKeyExpired
+	default:
+		return APIKeyActive
+	}
+}
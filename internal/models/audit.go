@@ -0,0 +1,33 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditRecord — запись журнала административных изменений: кто, когда и откуда изменил объект и как он выглядел до
+// и после изменения.
+type AuditRecord struct {
+	ID         int64           `json:"id"`
+	Time       time.Time       `json:"time"`
+	Actor      string          `json:"actor"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	Target     string          `json:"target"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	SourceIP   string          `json:"source_ip,omitempty"`
+}
+
+// AuditFilter — условия выборки записей журнала. Пустые поля не ограничивают выборку. Записи отдаются от новых к
+// старым; BeforeID — курсор, начиная с которого (не включая) продолжается выдача.
+type AuditFilter struct {
+	Actor      string
+	Action     string
+	TargetType string
+	Target     string
+	From       time.Time
+	To         time.Time
+	BeforeID   int64
+	Limit      int
+}
@@ -0,0 +1,235 @@
+package models
+
+import (
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// healthHistorySize — сколько последних проверок доступности хранится у бэкенда.
+	healthHistorySize = 20
+	// ewmaAlpha — вес нового наблюдения при расчёте EWMA латентности и доли ошибок.
+	ewmaAlpha = 0.1
+)
+
+// Состояния circuit breaker бэкенда: closed — трафик идёт; open — прокси не смог получить ответ, и бэкенд выведен из
+// ротации до успешной проверки доступности; half_open — проверка прошла, бэкенд снова получает трафик, и следующий
+// ответ решает, закрыть цепь или открыть снова.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// Административные состояния бэкенда. Трафик получают только активные бэкенды; draining перестаёт принимать новые
+// запросы и переходит в drained, когда завершатся запросы в работе.
+const (
+	BackendActive   = "active"
+	BackendDisabled = "disabled"
+	BackendDraining = "draining"
+	BackendDrained  = "drained"
+)
+
+type Backend struct {
+	URL       *url.URL
+	Available bool
+	// Weight — доля трафика бэкенда относительно остальных бэкендов пула. Задаётся при создании и дальше не меняется.
+	Weight int
+	Mu     sync.Mutex
+
+	adminState      string
+	circuitState    string
+	inFlight        atomic.Int64
+	lastStateChange time.Time
+	ewmaLatency     float64
+	errorRate       float64
+	healthChecks    []HealthCheckResult
+}
+
+type HealthCheckResult struct {
+	Time       time.Time `json:"time"`
+	OK         bool      `json:"ok"`
+	DurationMs float64   `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+type BackendStatus struct {
+	ID              string              `json:"id"`
+	URL             string              `json:"url"`
+	AdminState      string              `json:"admin_state"`
+	Available       bool                `json:"available"`
+	Weight          int                 `json:"weight"`
+	InFlight        int64               `json:"in_flight"`
+	EWMALatencyMs   float64             `json:"ewma_latency_ms"`
+	ErrorRate       float64             `json:"error_rate"`
+	CircuitState    string              `json:"circuit_state"`
+	LastStateChange time.Time           `json:"last_state_change"`
+	HealthChecks    []HealthCheckResult `json:"health_checks"`
+}
+
+// NewBackend — создаёт доступный бэкенд с весом 1.
+func NewBackend(u *url.URL) *Backend {
+	return &Backend{
+		URL:             u,
+		Available:       true,
+		Weight:          1,
+		adminState:      BackendActive,
+		circuitState:    CircuitClosed,
+		lastStateChange: time.Now(),
+	}
+}
+
+// ID — идентификатор бэкенда внутри пула (host:port), используется в админском API.
+func (b *Backend) ID() string {
+	return b.URL.Host
+}
+
+// AdminState — возвращает административное состояние бэкенда.
+func (b *Backend) AdminState() string {
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+	return b.adminState
+}
+
+// SetAdminState — меняет административное состояние бэкенда.
+func (b *Backend) SetAdminState(state string) {
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+	b.adminState = state
+}
+
+// Routable — можно ли отправлять на бэкенд новые запросы: он доступен, активен и его цепь не разомкнута.
+func (b *Backend) Routable() bool {
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+	return b.Available && b.adminState == BackendActive && b.circuitState != CircuitOpen
+}
+
+// CircuitState — возвращает состояние circuit breaker бэкенда.
+func (b *Backend) CircuitState() string {
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+	return b.circuitState
+}
+
+// TripCircuit — размыкает цепь после того, как прокси не смог получить ответ бэкенда. Возвращает true, если состояние
+// изменилось.
+func (b *Backend) TripCircuit() bool {
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+	return b.setCircuitState(CircuitOpen)
+}
+
+// setCircuitState — меняет состояние цепи и запоминает время смены. Вызывается под Mu.
+func (b *Backend) setCircuitState(state string) bool {
+	if b.circuitState == state {
+		return false
+	}
+	b.circuitState = state
+	b.lastStateChange = time.Now()
+	return true
+}
+
+// SetAvailable — меняет доступность бэкенда и запоминает время смены состояния. Возвращает true, если состояние изменилось.
+func (b *Backend) SetAvailable(available bool) bool {
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+
+	if b.Available == available {
+		return false
+	}
+	b.Available = available
+	b.lastStateChange = time.Now()
+	return true
+}
+
+// IsAvailable — возвращает текущую доступность бэкенда.
+func (b *Backend) IsAvailable() bool {
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+	return b.Available
+}
+
+// Acquire — отмечает начало запроса к бэкенду.
+func (b *Backend) Acquire() {
+	b.inFlight.Add(1)
+}
+
+// Release — отмечает завершение запроса к бэкенду.
+func (b *Backend) Release() {
+	b.inFlight.Add(-1)
+}
+
+// InFlight — возвращает число запросов, которые бэкенд обрабатывает прямо сейчас.
+func (b *Backend) InFlight() int64 {
+	return b.inFlight.Load()
+}
+
+// RecordResponse — обновляет EWMA латентности и доли ошибок по результату очередного проксированного запроса. Ответ
+// бэкенда в состоянии half_open замыкает цепь, ошибка размыкает её снова.
+func (b *Backend) RecordResponse(latency time.Duration, failed bool) {
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+
+	if b.circuitState == CircuitHalfOpen {
+		if failed {
+			b.setCircuitState(CircuitOpen)
+		} else {
+			b.setCircuitState(CircuitClosed)
+		}
+	}
+
+	latencyMs := float64(latency) / float64(time.Millisecond)
+	if b.ewmaLatency == 0 {
+		b.ewmaLatency = latencyMs
+	} else {
+		b.ewmaLatency = ewmaAlpha*latencyMs + (1-ewmaAlpha)*b.ewmaLatency
+	}
+
+	failure := 0.0
+	if failed {
+		failure = 1
+	}
+	b.errorRate = ewmaAlpha*failure + (1-ewmaAlpha)*b.errorRate
+}
+
+// RecordHealthCheck — добавляет результат проверки в историю, вытесняя самые старые записи. Успешная проверка
+// переводит разомкнутую цепь в half_open.
+func (b *Backend) RecordHealthCheck(result HealthCheckResult) {
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+
+	if result.OK && b.circuitState == CircuitOpen {
+		b.setCircuitState(CircuitHalfOpen)
+	}
+
+	b.healthChecks = append(b.healthChecks, result)
+	if len(b.healthChecks) > healthHistorySize {
+		b.healthChecks = b.healthChecks[len(b.healthChecks)-healthHistorySize:]
+	}
+}
+
+// Status — возвращает снимок состояния бэкенда для админского API.
+func (b *Backend) Status() BackendStatus {
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+
+	healthChecks := make([]HealthCheckResult, len(b.healthChecks))
+	copy(healthChecks, b.healthChecks)
+
+	return BackendStatus{
+		ID:              b.URL.Host,
+		URL:             b.URL.String(),
+		AdminState:      b.adminState,
+		Available:       b.Available,
+		Weight:          b.Weight,
+		InFlight:        b.inFlight.Load(),
+		EWMALatencyMs:   b.ewmaLatency,
+		ErrorRate:       b.errorRate,
+		CircuitState:    b.circuitState,
+		LastStateChange: b.lastStateChange,
+		HealthChecks:    healthChecks,
+	}
+}
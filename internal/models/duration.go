@@ -0,0 +1,28 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Duration — длительность, которая в JSON записывается строкой вида "1m30s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return errors.New("duration must be a string like \"1m\"")
+	}
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return errors.Wrapf(err, "invalid duration %q", raw)
+	}
+	*d = Duration(parsed)
+	return nil
+}
@@ -1,31 +1,174 @@
 package models
 
 import (
-	"net/url"
-	"sync"
+	"math"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
-type Backend struct {
-	URL       *url.URL
-	Available bool
-	Mu        sync.Mutex
-}
+// Статусы клиента. Приостановленный клиент (suspended) — временная мера, например при злоупотреблениях; отключённый
+// (disabled) — клиент, который больше не должен работать, но запись и история по нему сохраняются.
+const (
+	ClientActive    = "active"
+	ClientSuspended = "suspended"
+	ClientDisabled  = "disabled"
+)
 
 type RateLimitClient struct {
-	ClientID      string `json:"client_id"`
-	Capacity      int64  `json:"capacity"`
-	RatePerSecond int64  `json:"rate_per_second"`
-	Tokens        int64  `json:"tokens"`
-	LastRefillAt  int64  `json:"last_refill_at"`
+	ClientID      string            `json:"client_id"`
+	Capacity      int64             `json:"capacity"`
+	Rate          int64             `json:"rate"`
+	RatePeriod    Duration          `json:"rate_period"`
+	RatePerSecond float64           `json:"rate_per_second"`
+	Tokens        float64           `json:"tokens"`
+	LastRefillAt  time.Time         `json:"last_refill_at"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	Status        string            `json:"status"`
+	ExpiresAt     *time.Time        `json:"expires_at,omitempty"`
+	Algorithm     string            `json:"algorithm"`
+	// Plan — план клиента; пустой — лимиты заданы самому клиенту. Лимиты клиента плана выше — действующие, с учётом
+	// переопределений Overrides.
+	Plan      string          `json:"plan,omitempty"`
+	Overrides *LimitOverrides `json:"overrides,omitempty"`
+	// Quotas — квоты клиента на день, неделю или месяц с расходом в текущем окне. Заполняются только в ответе
+	// GET /clients/{id}.
+	Quotas []ClientQuota `json:"quotas,omitempty"`
+}
+
+// DefaultRatePeriod — период, за который клиенту начисляется rate токенов, если период не указан.
+const DefaultRatePeriod = time.Second
+
+// NormalizeRate — приводит скорость клиента к виду rate за rate_period и вычисляет RatePerSecond. Если rate не задан,
+// он берётся из rate_per_second за секунду, как в API до появления периода; дробную скорость так задать нельзя.
+// Период округляется до миллисекунды — с такой точностью он хранится в БД.
+func (c *RateLimitClient) NormalizeRate() error {
+	return normalizeRate(c.Capacity, &c.Rate, &c.RatePeriod, &c.RatePerSecond)
+}
+
+// normalizeRate — общая часть NormalizeRate клиента, политики и плана. Кроме скорости проверяет, что вся ёмкость
+// восстанавливается за время, которое помещается в time.Duration: иначе окно алгоритма переполнится.
+func normalizeRate(capacity int64, rate *int64, period *Duration, perSecond *float64) error {
+	if *rate == 0 && *perSecond != 0 {
+		if *perSecond != math.Trunc(*perSecond) {
+			return errors.New("rate_per_second must be a whole number, use rate and rate_period for fractional rates")
+		}
+		*rate = int64(*perSecond)
+		*period = Duration(time.Second)
+	}
+	if *period == 0 {
+		*period = Duration(DefaultRatePeriod)
+	}
+	*period = Duration(time.Duration(*period).Round(time.Millisecond))
+
+	switch {
+	case *rate <= 0:
+		return errors.New("rate must be positive")
+	case *period <= 0:
+		return errors.New("rate_period must be at least 1ms")
+	case float64(*period)/float64(*rate)*float64(max(capacity, 1)) >= math.MaxInt64:
+		return errors.New("capacity is too large for the rate: refilling it would take longer than 292 years")
+	}
+	*perSecond = RefillRate(*rate, time.Duration(*period))
+	return nil
+}
+
+// RefillRate — скорость пополнения токенов в секунду при rate токенов за period.
+func RefillRate(rate int64, period time.Duration) float64 {
+	if period <= 0 {
+		return 0
+	}
+	return float64(rate) / period.Seconds()
+}
+
+// Алгоритмы рейт-лимита. Для всех алгоритмов capacity — допустимый всплеск запросов, rate за rate_period — средняя
+// скорость, к которой сходится поток запросов клиента.
+const (
+	AlgorithmTokenBucket          = "token_bucket"
+	AlgorithmSlidingWindowLog     = "sliding_window_log"
+	AlgorithmSlidingWindowCounter = "sliding_window_counter"
+	AlgorithmGCRA                 = "gcra"
+	AlgorithmLeakyBucket          = "leaky_bucket"
+)
+
+// ValidAlgorithm — true, если алгоритм рейт-лимита известен.
+func ValidAlgorithm(algorithm string) bool {
+	switch algorithm {
+	case AlgorithmTokenBucket, AlgorithmSlidingWindowLog, AlgorithmSlidingWindowCounter, AlgorithmGCRA, AlgorithmLeakyBucket:
+		return true
+	}
+	return false
+}
+
+// ValidClientStatus — true, если статус клиента известен.
+func ValidClientStatus(status string) bool {
+	return status == ClientActive || status == ClientSuspended || status == ClientDisabled
+}
+
+// ImportClient — клиент для массовой загрузки. TokensSet — заданы ли токены явно; если нет, при обновлении
+// существующего клиента его токены сохраняются. Key — первый API-ключ нового клиента, записывается вместе с ним.
+type ImportClient struct {
+	Client    RateLimitClient
+	TokensSet bool
+	Key       *APIKey
+}
+
+// ClientFilter — условия выборки клиентов. Пустые поля и nil не ограничивают выборку; границы диапазонов включаются.
+type ClientFilter struct {
+	IDPrefix    string
+	MinCapacity *int64
+	MaxCapacity *int64
+	MinRate     *float64
+	MaxRate     *float64
+	Labels      map[string]string
+	Status      string
+	Plan        string
+}
+
+// ClientPage — сортировка и положение страницы в выборке клиентов. Если HasCursor, выдача продолжается после клиента
+// AfterID со значением поля сортировки AfterValue.
+type ClientPage struct {
+	SortBy     string
+	Desc       bool
+	HasCursor  bool
+	AfterID    string
+	AfterValue float64
+	Limit      int
+}
+
+// Поля, по которым можно сортировать клиентов.
+const (
+	ClientSortID       = "client_id"
+	ClientSortCapacity = "capacity"
+	ClientSortRate     = "rate_per_second"
+	ClientSortTokens   = "tokens"
+)
+
+// TokenGrant — результат атомарного получения токенов клиента из БД: сколько токенов выдано, сколько осталось в БД
+// и текущие лимиты и статус клиента.
+type TokenGrant struct {
+	Granted    int64
+	Tokens     float64
+	Capacity   int64
+	Rate       int64
+	RatePeriod time.Duration
+	Status     string
+	ExpiresAt  *time.Time
 }
 
 type RateLimitState struct {
 	ClientID      string
 	Capacity      int64
-	RatePerSecond int64
-	Tokens        int64
-	LastRefillAt  int64
+	Rate          int64
+	RatePeriod    time.Duration
+	RatePerSecond float64
+	Tokens        float64
+	LastRefillAt  time.Time
+	Status        string
+	ExpiresAt     *time.Time
 	Dirty         bool
 	LastSeen      time.Time
+	// Plan и Overrides — план клиента и его переопределения, чтобы пересчитать лимиты при изменении плана.
+	Plan      string
+	Overrides *LimitOverrides
 }
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestNormalizeRate(t *testing.T) {
+	tests := []struct {
+		name              string
+		client            RateLimitClient
+		wantRatePerSecond float64
+		wantErr           bool
+	}{
+		{name: "rate per period", client: RateLimitClient{Capacity: 10, Rate: 5, RatePeriod: Duration(time.Minute)}, wantRatePerSecond: 5.0 / 60},
+		{name: "rate per second", client: RateLimitClient{Capacity: 10, RatePerSecond: 3}, wantRatePerSecond: 3},
+		{name: "fractional rate per second", client: RateLimitClient{Capacity: 10, RatePerSecond: 0.5}, wantErr: true},
+		{name: "no rate", client: RateLimitClient{Capacity: 10}, wantErr: true},
+		{name: "huge capacity", client: RateLimitClient{Capacity: math.MaxInt64, Rate: 1, RatePeriod: Duration(time.Second)}, wantErr: true},
+		{
+			name:    "refill longer than the maximum duration",
+			client:  RateLimitClient{Capacity: 1 << 20, Rate: 1, RatePeriod: Duration(time.Duration(math.MaxInt64 / 2))},
+			wantErr: true,
+		},
+		{
+			name:              "large capacity that still fits",
+			client:            RateLimitClient{Capacity: 1 << 30, Rate: 1000, RatePeriod: Duration(time.Second)},
+			wantRatePerSecond: 1000,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.client
+			err := c.NormalizeRate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeRate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && c.RatePerSecond != tt.wantRatePerSecond {
+				t.Errorf("RatePerSecond = %v, want %v", c.RatePerSecond, tt.wantRatePerSecond)
+			}
+		})
+	}
+}
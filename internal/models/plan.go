@@ -0,0 +1,89 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Plan — тариф с общими лимитами для группы клиентов. Клиент плана получает его лимиты, если не переопределил их
+// сам, поэтому изменение плана меняет лимиты сразу всех его клиентов.
+type Plan struct {
+	Name          string    `json:"name"`
+	Capacity      int64     `json:"capacity"`
+	Rate          int64     `json:"rate"`
+	RatePeriod    Duration  `json:"rate_period"`
+	RatePerSecond float64   `json:"rate_per_second"`
+	Algorithm     string    `json:"algorithm"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Validate — проверяет план и приводит его скорость к виду rate за rate_period. План без алгоритма использует
+// токен-бакет.
+func (p *Plan) Validate() error {
+	if p.Algorithm == "" {
+		p.Algorithm = AlgorithmTokenBucket
+	}
+
+	switch {
+	case p.Name == "":
+		return errors.New("name is required")
+	case strings.IndexFunc(p.Name, invalidNameRune) >= 0:
+		return errors.New("name may contain only letters, digits, '-', '_' and '.'")
+	case p.Capacity <= 0:
+		return errors.New("capacity must be positive")
+	case !ValidAlgorithm(p.Algorithm):
+		return errors.Errorf("unknown algorithm %q", p.Algorithm)
+	}
+	return normalizeRate(p.Capacity, &p.Rate, &p.RatePeriod, &p.RatePerSecond)
+}
+
+// Limits — лимиты клиента плана с переопределениями o; nil o — лимиты плана как есть.
+func (p *Plan) Limits(o *LimitOverrides) (capacity, rate int64, period time.Duration, algorithm string) {
+	capacity, rate, period, algorithm = p.Capacity, p.Rate, time.Duration(p.RatePeriod), p.Algorithm
+	if o == nil {
+		return capacity, rate, period, algorithm
+	}
+	if o.Capacity != nil {
+		capacity = *o.Capacity
+	}
+	if o.Rate != nil && o.RatePeriod != nil {
+		rate, period = *o.Rate, time.Duration(*o.RatePeriod)
+	}
+	if o.Algorithm != nil {
+		algorithm = *o.Algorithm
+	}
+	return capacity, rate, period, algorithm
+}
+
+// LimitOverrides — лимиты, заданные клиенту плана поверх лимитов плана. nil — значение берётся из плана; rate
+// и rate_period переопределяются только вместе.
+type LimitOverrides struct {
+	Capacity   *int64    `json:"capacity,omitempty"`
+	Rate       *int64    `json:"rate,omitempty"`
+	RatePeriod *Duration `json:"rate_period,omitempty"`
+	Algorithm  *string   `json:"algorithm,omitempty"`
+}
+
+// Empty — true, если клиент не переопределяет ни одного лимита плана.
+func (o *LimitOverrides) Empty() bool {
+	return o == nil || o.Capacity == nil && o.Rate == nil && o.RatePeriod == nil && o.Algorithm == nil
+}
+
+// ApplyPlan — привязывает клиента к плану p и пересчитывает его действующие лимиты из лимитов плана
+// и переопределений клиента.
+func (c *RateLimitClient) ApplyPlan(p *Plan) {
+	var period time.Duration
+	c.Plan = p.Name
+	c.Capacity, c.Rate, period, c.Algorithm = p.Limits(c.Overrides)
+	c.RatePeriod = Duration(period)
+	c.RatePerSecond = RefillRate(c.Rate, period)
+}
+
+// DetachPlan — отвязывает клиента от плана; его действующие лимиты становятся собственными.
+func (c *RateLimitClient) DetachPlan() {
+	c.Plan = ""
+	c.Overrides = nil
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RateLimitPolicy — лимит на группу запросов, выбранную методом и шаблоном пути. Каждый клиент получает по политике
+// собственный лимит, который действует вместе с его общим лимитом.
+type RateLimitPolicy struct {
+	Name string `json:"name"`
+	// Method — HTTP-метод запросов; пустой метод подходит к любому.
+	Method string `json:"method,omitempty"`
+	// PathPattern — шаблон пути в синтаксисе path.Match: * заменяет один сегмент пути. Шаблон, оканчивающийся на /**,
+	// подходит ко всем путям с этим префиксом.
+	PathPattern   string    `json:"path_pattern"`
+	Capacity      int64     `json:"capacity"`
+	Rate          int64     `json:"rate"`
+	RatePeriod    Duration  `json:"rate_period"`
+	RatePerSecond float64   `json:"rate_per_second"`
+	Algorithm     string    `json:"algorithm"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Validate — проверяет политику и приводит её скорость к виду rate за rate_period, а метод — к верхнему регистру.
+// Политика без алгоритма использует токен-бакет.
+func (p *RateLimitPolicy) Validate() error {
+	p.Method = strings.ToUpper(p.Method)
+	if p.Algorithm == "" {
+		p.Algorithm = AlgorithmTokenBucket
+	}
+
+	switch {
+	case p.Name == "":
+		return errors.New("name is required")
+	case strings.IndexFunc(p.Name, invalidNameRune) >= 0:
+		return errors.New("name may contain only letters, digits, '-', '_' and '.'")
+	case p.Method != "" && !validMethod(p.Method):
+		return errors.Errorf("unknown method %q", p.Method)
+	case !strings.HasPrefix(p.PathPattern, "/"):
+		return errors.New("path_pattern must start with /")
+	case p.Capacity <= 0:
+		return errors.New("capacity must be positive")
+	case !ValidAlgorithm(p.Algorithm):
+		return errors.Errorf("unknown algorithm %q", p.Algorithm)
+	}
+	if _, err := path.Match(strings.TrimSuffix(p.PathPattern, "/**"), "/"); err != nil {
+		return errors.New("invalid path_pattern")
+	}
+	return normalizeRate(p.Capacity, &p.Rate, &p.RatePeriod, &p.RatePerSecond)
+}
+
+// Matches — true, если политика относится к запросу с методом method и путём urlPath.
+func (p *RateLimitPolicy) Matches(method, urlPath string) bool {
+	if p.Method != "" && p.Method != method {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(p.PathPattern, "/**"); ok {
+		if prefix == "" {
+			return true
+		}
+		for dir := urlPath; ; dir = path.Dir(dir) {
+			if matched, _ := path.Match(prefix, dir); matched {
+				return true
+			}
+			if dir == "/" || dir == "." {
+				return false
+			}
+		}
+	}
+	matched, _ := path.Match(p.PathPattern, urlPath)
+	return matched
+}
+
+// invalidNameRune — имя политики попадает в путь админского API и в заголовки RateLimit, поэтому допускаются только
+// латинские буквы, цифры, '-', '_' и '.'.
+func invalidNameRune(r rune) bool {
+	return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.')
+}
+
+func validMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+		http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"time"
+	// Базу часовых поясов встраиваем в бинарник: в контейнерах без tzdata LoadLocation иначе не найдёт пояс квоты.
+	_ "time/tzdata"
+
+	"github.com/pkg/errors"
+)
+
+// Периоды квот. Окно квоты — календарный день, неделя с понедельника или месяц в часовом поясе квоты.
+const (
+	QuotaDay   = "day"
+	QuotaWeek  = "week"
+	QuotaMonth = "month"
+)
+
+// DefaultQuotaTimeZone — часовой пояс квоты, если он не указан.
+const DefaultQuotaTimeZone = "UTC"
+
+// ClientQuota — квота клиента: сколько единиц лимита он может израсходовать за календарный период, независимо от
+// лимита всплесков. Used, Remaining и ResetsAt заполняются при чтении и относятся к текущему окну.
+type ClientQuota struct {
+	Period    string    `json:"period"`
+	Limit     int64     `json:"limit"`
+	TimeZone  string    `json:"time_zone"`
+	Used      int64     `json:"used"`
+	Remaining int64     `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
+	// WindowStart — начало окна, к которому относится Used в БД.
+	WindowStart time.Time `json:"-"`
+}
+
+// Validate — проверяет квоту; квота без часового пояса считается в DefaultQuotaTimeZone.
+func (q *ClientQuota) Validate() error {
+	if q.TimeZone == "" {
+		q.TimeZone = DefaultQuotaTimeZone
+	}
+
+	switch {
+	case q.Period != QuotaDay && q.Period != QuotaWeek && q.Period != QuotaMonth:
+		return errors.Errorf("unknown quota period %q", q.Period)
+	case q.Limit <= 0:
+		return errors.New("quota limit must be positive")
+	}
+	if _, err := time.LoadLocation(q.TimeZone); err != nil {
+		return errors.Errorf("unknown time zone %q", q.TimeZone)
+	}
+	return nil
+}
+
+// Fill — заполняет Used, Remaining и ResetsAt для окна, в которое попадает now. Если в БД записан расход прошлого
+// окна, в текущем окне ещё ничего не израсходовано.
+func (q *ClientQuota) Fill(now time.Time) {
+	loc, err := time.LoadLocation(q.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	start, end := QuotaWindow(q.Period, loc, now)
+	if !q.WindowStart.Equal(start) {
+		q.Used = 0
+	}
+	q.Remaining = max(q.Limit-q.Used, 0)
+	q.ResetsAt = end
+}
+
+// QuotaWindow — начало и конец окна квоты с периодом period в часовом поясе loc, в которое попадает now.
+func QuotaWindow(period string, loc *time.Location, now time.Time) (start, end time.Time) {
+	local := now.In(loc)
+	year, month, day := local.Date()
+	switch period {
+	case QuotaWeek:
+		day -= (int(local.Weekday()) + 6) % 7
+		return midnight(year, month, day, loc), midnight(year, month, day+7, loc)
+	case QuotaMonth:
+		return midnight(year, month, 1, loc), midnight(year, month+1, 1, loc)
+	default:
+		return midnight(year, month, day, loc), midnight(year, month, day+1, loc)
+	}
+}
+
+// midnight — начало календарного дня в часовом поясе loc; day и month могут выходить за пределы, как в time.Date.
+// Если в полночь часы переводятся вперёд, полуночи в этот день нет, и time.Date возвращает момент ещё в предыдущем
+// дне; тогда день начинается с перевода часов.
+func midnight(year int, month time.Month, day int, loc *time.Location) time.Time {
+	t := time.Date(year, month, day, 0, 0, 0, 0, loc)
+	wantYear, wantMonth, wantDay := time.Date(year, month, day, 12, 0, 0, 0, loc).Date()
+	if y, m, d := t.Date(); y != wantYear || m != wantMonth || d != wantDay {
+		if _, transition := t.ZoneBounds(); !transition.IsZero() {
+			return transition
+		}
+	}
+	return t
+}
+
+// QuotaUsage — расход квоты клиента, который инстанс добавляет к счётчику в БД. После записи Used и WindowStart
+// содержат общий расход и окно счётчика в БД.
+type QuotaUsage struct {
+	ClientID    string
+	Period      string
+	WindowStart time.Time
+	Delta       int64
+	Used        int64
+}
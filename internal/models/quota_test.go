@@ -0,0 +1,178 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func utc(value string) time.Time {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+func TestQuotaWindow(t *testing.T) {
+	tests := []struct {
+		name      string
+		period    string
+		zone      string
+		now       string
+		wantStart string
+		wantEnd   string
+	}{
+		{
+			name: "day in UTC", period: QuotaDay, zone: "UTC", now: "2025-03-10T15:04:05Z",
+			wantStart: "2025-03-10T00:00:00Z", wantEnd: "2025-03-11T00:00:00Z",
+		},
+		{
+			name: "day already changed in the quota zone", period: QuotaDay, zone: "Europe/Moscow", now: "2025-03-10T22:30:00Z",
+			wantStart: "2025-03-10T21:00:00Z", wantEnd: "2025-03-11T21:00:00Z",
+		},
+		{
+			name: "day not yet changed in the quota zone", period: QuotaDay, zone: "America/Los_Angeles", now: "2025-07-01T05:00:00Z",
+			wantStart: "2025-06-30T07:00:00Z", wantEnd: "2025-07-01T07:00:00Z",
+		},
+		{
+			name: "non-hour offset", period: QuotaDay, zone: "Asia/Kathmandu", now: "2025-05-01T18:15:00Z",
+			wantStart: "2025-05-01T18:15:00Z", wantEnd: "2025-05-02T18:15:00Z",
+		},
+		{
+			name: "day before the non-hour offset midnight", period: QuotaDay, zone: "Asia/Kathmandu", now: "2025-05-01T18:14:59Z",
+			wantStart: "2025-04-30T18:15:00Z", wantEnd: "2025-05-01T18:15:00Z",
+		},
+		{
+			name: "23-hour day when DST starts", period: QuotaDay, zone: "America/New_York", now: "2025-03-09T12:00:00Z",
+			wantStart: "2025-03-09T05:00:00Z", wantEnd: "2025-03-10T04:00:00Z",
+		},
+		{
+			name: "25-hour day when DST ends", period: QuotaDay, zone: "America/New_York", now: "2025-11-02T12:00:00Z",
+			wantStart: "2025-11-02T04:00:00Z", wantEnd: "2025-11-03T05:00:00Z",
+		},
+		{
+			name: "DST starts at midnight", period: QuotaDay, zone: "America/Santiago", now: "2024-09-08T15:00:00Z",
+			wantStart: "2024-09-08T04:00:00Z", wantEnd: "2024-09-09T03:00:00Z",
+		},
+		{
+			name: "week starts on Monday", period: QuotaWeek, zone: "UTC", now: "2025-03-16T23:59:59Z",
+			wantStart: "2025-03-10T00:00:00Z", wantEnd: "2025-03-17T00:00:00Z",
+		},
+		{
+			name: "Monday opens a new week", period: QuotaWeek, zone: "UTC", now: "2025-03-17T00:00:00Z",
+			wantStart: "2025-03-17T00:00:00Z", wantEnd: "2025-03-24T00:00:00Z",
+		},
+		{
+			name: "week across the new year", period: QuotaWeek, zone: "UTC", now: "2025-01-01T10:00:00Z",
+			wantStart: "2024-12-30T00:00:00Z", wantEnd: "2025-01-06T00:00:00Z",
+		},
+		{
+			name: "week with DST change", period: QuotaWeek, zone: "Europe/Berlin", now: "2025-03-28T12:00:00Z",
+			wantStart: "2025-03-23T23:00:00Z", wantEnd: "2025-03-30T22:00:00Z",
+		},
+		{
+			name: "week in the zone is a day ahead of UTC", period: QuotaWeek, zone: "Pacific/Auckland", now: "2025-03-16T12:00:00Z",
+			wantStart: "2025-03-16T11:00:00Z", wantEnd: "2025-03-23T11:00:00Z",
+		},
+		{
+			name: "leap February", period: QuotaMonth, zone: "UTC", now: "2024-02-29T23:59:59Z",
+			wantStart: "2024-02-01T00:00:00Z", wantEnd: "2024-03-01T00:00:00Z",
+		},
+		{
+			name: "first instant of the month", period: QuotaMonth, zone: "UTC", now: "2025-03-01T00:00:00Z",
+			wantStart: "2025-03-01T00:00:00Z", wantEnd: "2025-04-01T00:00:00Z",
+		},
+		{
+			name: "December rolls over the year", period: QuotaMonth, zone: "UTC", now: "2025-12-31T12:00:00Z",
+			wantStart: "2025-12-01T00:00:00Z", wantEnd: "2026-01-01T00:00:00Z",
+		},
+		{
+			name: "month already changed in the quota zone", period: QuotaMonth, zone: "Asia/Tokyo", now: "2025-01-31T16:00:00Z",
+			wantStart: "2025-01-31T15:00:00Z", wantEnd: "2025-02-28T15:00:00Z",
+		},
+		{
+			name: "month with DST change", period: QuotaMonth, zone: "America/New_York", now: "2025-03-15T12:00:00Z",
+			wantStart: "2025-03-01T05:00:00Z", wantEnd: "2025-04-01T04:00:00Z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := QuotaWindow(tt.period, mustLoad(t, tt.zone), utc(tt.now))
+			if !start.Equal(utc(tt.wantStart)) || !end.Equal(utc(tt.wantEnd)) {
+				t.Errorf("QuotaWindow() = [%v, %v), want [%s, %s)", start.UTC(), end.UTC(), tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+// TestQuotaWindowsAreContiguous — конец каждого окна совпадает с началом следующего, в том числе через переходы
+// на летнее время и границы месяцев.
+func TestQuotaWindowsAreContiguous(t *testing.T) {
+	zones := []string{"UTC", "America/New_York", "Europe/Berlin", "America/Santiago", "Australia/Lord_Howe"}
+	for _, zone := range zones {
+		loc := mustLoad(t, zone)
+		for _, period := range []string{QuotaDay, QuotaWeek, QuotaMonth} {
+			start, end := QuotaWindow(period, loc, utc("2024-01-01T12:00:00Z"))
+			for i := 0; i < 400 && end.Before(utc("2025-01-01T00:00:00Z")); i++ {
+				if !start.Before(end) {
+					t.Fatalf("%s %s: empty window [%v, %v)", zone, period, start, end)
+				}
+				nextStart, nextEnd := QuotaWindow(period, loc, end)
+				if !nextStart.Equal(end) {
+					t.Fatalf("%s %s: window after [%v, %v) starts at %v", zone, period, start, end, nextStart)
+				}
+				if prevStart, _ := QuotaWindow(period, loc, end.Add(-time.Nanosecond)); !prevStart.Equal(start) {
+					t.Fatalf("%s %s: last instant of [%v, %v) falls into window starting %v", zone, period, start, end, prevStart)
+				}
+				start, end = nextStart, nextEnd
+			}
+		}
+	}
+}
+
+func TestClientQuotaFill(t *testing.T) {
+	now := utc("2025-03-10T22:30:00Z")
+	tests := []struct {
+		name          string
+		quota         ClientQuota
+		wantUsed      int64
+		wantRemaining int64
+		wantResetsAt  string
+	}{
+		{
+			name:     "usage in the current window",
+			quota:    ClientQuota{Period: QuotaDay, Limit: 100, TimeZone: "UTC", Used: 40, WindowStart: utc("2025-03-10T00:00:00Z")},
+			wantUsed: 40, wantRemaining: 60, wantResetsAt: "2025-03-11T00:00:00Z",
+		},
+		{
+			name:     "usage of the previous window is not counted",
+			quota:    ClientQuota{Period: QuotaDay, Limit: 100, TimeZone: "Europe/Moscow", Used: 40, WindowStart: utc("2025-03-09T21:00:00Z")},
+			wantUsed: 0, wantRemaining: 100, wantResetsAt: "2025-03-11T21:00:00Z",
+		},
+		{
+			name:     "overspent",
+			quota:    ClientQuota{Period: QuotaMonth, Limit: 100, TimeZone: "UTC", Used: 130, WindowStart: utc("2025-03-01T00:00:00Z")},
+			wantUsed: 130, wantRemaining: 0, wantResetsAt: "2025-04-01T00:00:00Z",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := tt.quota
+			q.Fill(now)
+			if q.Used != tt.wantUsed || q.Remaining != tt.wantRemaining || !q.ResetsAt.Equal(utc(tt.wantResetsAt)) {
+				t.Errorf("Fill() = used %d, remaining %d, resets at %v; want %d, %d, %s",
+					q.Used, q.Remaining, q.ResetsAt.UTC(), tt.wantUsed, tt.wantRemaining, tt.wantResetsAt)
+			}
+		})
+	}
+}
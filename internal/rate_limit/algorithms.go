@@ -0,0 +1,423 @@
+package rate_limit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"load-balancer/internal/models"
+)
+
+// newAlgorithm — создаёт состояние алгоритма в памяти. capacity задаёт допустимый всплеск, ratePerSecond — средний
+// темп запросов. Для неизвестного алгоритма возвращает nil.
+func newAlgorithm(name string, capacity int64, ratePerSecond float64, now time.Time) algorithm {
+	capacity, interval, window := algorithmParams(capacity, ratePerSecond)
+
+	switch name {
+	case models.AlgorithmTokenBucket:
+		return &memoryTokenBucket{capacity: capacity, ratePerSecond: ratePerSecond, tokens: float64(capacity), lastRefillAt: now}
+	case models.AlgorithmSlidingWindowLog:
+		return &slidingWindowLog{window: window, limit: capacity}
+	case models.AlgorithmSlidingWindowCounter:
+		return &slidingWindowCounter{window: window, limit: capacity, currStart: now}
+	case models.AlgorithmGCRA:
+		return &gcra{limit: capacity, interval: interval, tolerance: mulDuration(interval, capacity-1)}
+	case models.AlgorithmLeakyBucket:
+		return &leakyBucket{limit: capacity, interval: interval, maxDelay: window}
+	}
+	return nil
+}
+
+// algorithmParams — ёмкость не меньше одного запроса, интервал между запросами при темпе ratePerSecond и окно, за
+// которое восстанавливается вся ёмкость. Интервал и окно не больше максимальной длительности: NormalizeRate не даёт
+// сохранить такие лимиты, но записи, созданные до этой проверки, могут их содержать.
+func algorithmParams(capacity int64, ratePerSecond float64) (int64, time.Duration, time.Duration) {
+	capacity = max(capacity, 1)
+	interval := time.Second
+	if ratePerSecond > 0 {
+		interval = max(floatDuration(float64(time.Second)/ratePerSecond), 1)
+	}
+	return capacity, interval, mulDuration(interval, capacity)
+}
+
+// mulDuration — d * n без переполнения: результат не больше math.MaxInt64.
+func mulDuration(d time.Duration, n int64) time.Duration {
+	return floatDuration(float64(d) * float64(n))
+}
+
+// floatDuration — длительность из числа наносекунд, ограниченная math.MaxInt64. Преобразование float64, которое не
+// помещается в int64, даёт в Go произвольный результат, поэтому граница проверяется до него.
+func floatDuration(ns float64) time.Duration {
+	if ns >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(ns)
+}
+
+// memoryTokenBucket — токен-бакет, состояние которого хранится только в памяти. Используется для лимитов по
+// маршрутам; общий лимит клиента с токен-бакетом ведёт TokenBucket.
+type memoryTokenBucket struct {
+	mu            sync.Mutex
+	capacity      int64
+	ratePerSecond float64
+	tokens        float64
+	lastRefillAt  time.Time
+}
+
+func (a *memoryTokenBucket) allow(now time.Time, cost int64) Decision {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	refill(&a.tokens, &a.lastRefillAt, a.capacity, a.ratePerSecond, now)
+	return takeTokens(&a.tokens, a.capacity, a.ratePerSecond, cost)
+}
+
+func (a *memoryTokenBucket) charge(now time.Time, cost int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	refill(&a.tokens, &a.lastRefillAt, a.capacity, a.ratePerSecond, now)
+	a.tokens -= float64(cost)
+}
+
+func (a *memoryTokenBucket) refund(_ time.Time, cost int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.tokens = min(a.tokens+float64(cost), float64(a.capacity))
+}
+
+func (a *memoryTokenBucket) resize(capacity int64, ratePerSecond float64, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	refill(&a.tokens, &a.lastRefillAt, a.capacity, a.ratePerSecond, now)
+	a.capacity, a.ratePerSecond = max(capacity, 1), ratePerSecond
+	a.tokens = min(a.tokens, float64(a.capacity))
+}
+
+// logEntry — пропущенный запрос и его стоимость.
+type logEntry struct {
+	at   time.Time
+	cost int64
+}
+
+// slidingWindowLog — хранит время и стоимость каждого пропущенного запроса за окно capacity/rate и пропускает запрос,
+// если их суммарная стоимость вместе с ним не превышает capacity. Точный, но хранит до capacity записей на клиента.
+type slidingWindowLog struct {
+	mu     sync.Mutex
+	window time.Duration
+	limit  int64
+	log    []logEntry
+	used   int64
+}
+
+func (a *slidingWindowLog) allow(now time.Time, cost int64) Decision {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.expire(now)
+
+	decision := Decision{Limit: a.limit, Window: a.window}
+	if a.used+cost > a.limit {
+		decision.RetryAfter = a.retryAfter(now, cost)
+	} else {
+		decision.Allowed = true
+		a.log = append(a.log, logEntry{at: now, cost: cost})
+		a.used += cost
+	}
+	decision.Remaining = max(a.limit-a.used, 0)
+	if len(a.log) > 0 {
+		decision.Reset = a.log[len(a.log)-1].at.Add(a.window).Sub(now)
+	}
+	return decision
+}
+
+func (a *slidingWindowLog) charge(now time.Time, cost int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.expire(now)
+	a.log = append(a.log, logEntry{at: now, cost: cost})
+	a.used += cost
+}
+
+func (a *slidingWindowLog) refund(takenAt time.Time, cost int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i := len(a.log) - 1; i >= 0; i-- {
+		if a.log[i].at.Equal(takenAt) && a.log[i].cost == cost {
+			a.log = append(a.log[:i], a.log[i+1:]...)
+			a.used -= cost
+			return
+		}
+	}
+}
+
+// resize — меняет окно и лимит; уже пропущенные запросы остаются в журнале и считаются по новому окну.
+func (a *slidingWindowLog) resize(capacity int64, ratePerSecond float64, _ time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.limit, _, a.window = algorithmParams(capacity, ratePerSecond)
+}
+
+// expire — убирает запросы, вышедшие из окна.
+func (a *slidingWindowLog) expire(now time.Time) {
+	boundary := now.Add(-a.window)
+	expired := 0
+	for expired < len(a.log) && !a.log[expired].at.After(boundary) {
+		a.used -= a.log[expired].cost
+		expired++
+	}
+	a.log = a.log[expired:]
+}
+
+// retryAfter — через сколько из окна выйдет достаточно запросов, чтобы поместился запрос стоимостью cost.
+func (a *slidingWindowLog) retryAfter(now time.Time, cost int64) time.Duration {
+	excess := a.used + cost - a.limit
+	for _, entry := range a.log {
+		excess -= entry.cost
+		if excess <= 0 {
+			return entry.at.Add(a.window).Sub(now)
+		}
+	}
+	return a.window
+}
+
+// slidingWindowCounter — считает стоимость запросов в текущем и предыдущем окне и оценивает её за последнее окно,
+// взвешивая предыдущее окно по доле, которая ещё в него попадает.
+type slidingWindowCounter struct {
+	mu        sync.Mutex
+	window    time.Duration
+	limit     int64
+	currStart time.Time
+	curr      int64
+	prev      int64
+}
+
+func (a *slidingWindowCounter) allow(now time.Time, cost int64) Decision {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.advance(now)
+	elapsed := now.Sub(a.currStart)
+	estimate := a.estimate(elapsed)
+
+	decision := Decision{Limit: a.limit, Window: a.window}
+	if estimate+float64(cost) > float64(a.limit) {
+		decision.RetryAfter = a.retryAfter(elapsed, cost)
+	} else {
+		decision.Allowed = true
+		a.curr += cost
+		estimate += float64(cost)
+	}
+	decision.Remaining = max(a.limit-int64(math.Ceil(estimate)), 0)
+	decision.Reset = 2*a.window - elapsed
+	if a.curr == 0 {
+		decision.Reset = a.window - elapsed
+	}
+	return decision
+}
+
+func (a *slidingWindowCounter) charge(now time.Time, cost int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.advance(now)
+	a.curr += cost
+}
+
+func (a *slidingWindowCounter) refund(takenAt time.Time, cost int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case !takenAt.Before(a.currStart):
+		a.curr = max(a.curr-cost, 0)
+	case !takenAt.Before(a.currStart.Add(-a.window)):
+		a.prev = max(a.prev-cost, 0)
+	}
+}
+
+// resize — меняет окно и лимит. Границы окон при этом сдвигаются, поэтому оценка расхода за последнее окно целиком
+// переносится в окно, которое начинается сейчас.
+func (a *slidingWindowCounter) resize(capacity int64, ratePerSecond float64, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.advance(now)
+	used := int64(math.Ceil(a.estimate(now.Sub(a.currStart))))
+	a.limit, _, a.window = algorithmParams(capacity, ratePerSecond)
+	a.currStart, a.curr, a.prev = now, used, 0
+}
+
+// estimate — оценка расхода за последнее окно: предыдущее окно учитывается в той доле, которая ещё в него попадает.
+func (a *slidingWindowCounter) estimate(elapsed time.Duration) float64 {
+	weight := 1 - float64(elapsed)/float64(a.window)
+	return float64(a.prev)*weight + float64(a.curr)
+}
+
+// advance — переходит к окну, в которое попадает now.
+func (a *slidingWindowCounter) advance(now time.Time) {
+	if elapsed := now.Sub(a.currStart) / a.window; elapsed > 0 {
+		if elapsed == 1 {
+			a.prev = a.curr
+		} else {
+			a.prev = 0
+		}
+		a.curr = 0
+		a.currStart = a.currStart.Add(elapsed * a.window)
+	}
+}
+
+// retryAfter — через сколько оценка опустится настолько, чтобы поместился запрос стоимостью cost: вклад предыдущего
+// окна убывает до конца текущего, а если места не хватает уже в текущем окне, ждать нужно до следующего окна.
+func (a *slidingWindowCounter) retryAfter(elapsed time.Duration, cost int64) time.Duration {
+	free := float64(a.limit - a.curr - cost)
+	if free < 0 || a.prev == 0 {
+		return a.window - elapsed
+	}
+	untilFree := time.Duration((1 - free/float64(a.prev)) * float64(a.window))
+	return max(untilFree-elapsed, 0)
+}
+
+// gcra — Generic Cell Rate Algorithm: хранит теоретическое время, когда лимит восстановится после уже пропущенных
+// запросов, и пропускает запрос, если с учётом его стоимости это время опережает текущее не больше чем на capacity
+// интервалов.
+type gcra struct {
+	mu        sync.Mutex
+	limit     int64
+	interval  time.Duration
+	tolerance time.Duration
+	tat       time.Time
+}
+
+func (a *gcra) allow(now time.Time, cost int64) Decision {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	decision := Decision{Limit: a.limit, Window: mulDuration(a.interval, a.limit)}
+	tat := a.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	newTat := tat.Add(mulDuration(a.interval, cost))
+	if ahead := newTat.Sub(now) - a.tolerance - a.interval; ahead > 0 {
+		decision.RetryAfter = ahead
+	} else {
+		decision.Allowed = true
+		tat = newTat
+		a.tat = tat
+	}
+	decision.Remaining = max(int64((a.tolerance+a.interval-tat.Sub(now))/a.interval), 0)
+	decision.Reset = tat.Sub(now)
+	return decision
+}
+
+func (a *gcra) charge(now time.Time, cost int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.tat.Before(now) {
+		a.tat = now
+	}
+	a.tat = a.tat.Add(mulDuration(a.interval, cost))
+}
+
+func (a *gcra) refund(takenAt time.Time, cost int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.tat = a.tat.Add(-mulDuration(a.interval, cost))
+	if a.tat.Before(takenAt) {
+		a.tat = takenAt
+	}
+}
+
+// resize — меняет лимит и интервал. Долг по уже пропущенным запросам сохраняется в запросах и пересчитывается
+// в новый интервал.
+func (a *gcra) resize(capacity int64, ratePerSecond float64, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var owed float64
+	if a.tat.After(now) {
+		owed = float64(a.tat.Sub(now)) / float64(a.interval)
+	}
+	a.limit, a.interval, _ = algorithmParams(capacity, ratePerSecond)
+	a.tolerance = mulDuration(a.interval, a.limit-1)
+	a.tat = now.Add(floatDuration(owed * float64(a.interval)))
+}
+
+// leakyBucket — выравнивает поток: запрос ждёт своей очереди, и запросы уходят с темпом rate, причём запрос
+// стоимостью cost занимает cost интервалов. Если очередь длиннее capacity интервалов, новый запрос отклоняется.
+// Сам allow не ждёт: место в очереди занимается сразу, а сколько ждать, возвращается в Decision.delay, чтобы
+// запрос, который отклонит другой лимит, не ждал зря и освободил место.
+type leakyBucket struct {
+	mu       sync.Mutex
+	limit    int64
+	interval time.Duration
+	maxDelay time.Duration
+	next     time.Time
+}
+
+func (a *leakyBucket) allow(now time.Time, cost int64) Decision {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	slot := a.next
+	if slot.Before(now) {
+		slot = now
+	}
+	wait := slot.Sub(now)
+	occupied := mulDuration(a.interval, cost)
+	decision := Decision{Limit: a.limit, Window: a.maxDelay, Reset: wait}
+	if overflow := wait + occupied - a.maxDelay; overflow > 0 {
+		decision.RetryAfter = overflow
+		return decision
+	}
+	a.next = slot.Add(occupied)
+
+	decision.Allowed = true
+	decision.Reset = wait + occupied
+	decision.Remaining = max(int64((a.maxDelay-decision.Reset)/a.interval), 0)
+	decision.delay = wait
+	return decision
+}
+
+func (a *leakyBucket) charge(now time.Time, cost int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.next.Before(now) {
+		a.next = now
+	}
+	a.next = a.next.Add(mulDuration(a.interval, cost))
+}
+
+// refund — освобождает место в очереди. Запросы, вставшие в очередь позже, уже ждут своего времени, поэтому очередь
+// просто укорачивается с конца.
+func (a *leakyBucket) refund(takenAt time.Time, cost int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.next = a.next.Add(-mulDuration(a.interval, cost))
+	if a.next.Before(takenAt) {
+		a.next = takenAt
+	}
+}
+
+// resize — меняет темп и длину очереди. Занятые в очереди места сохраняются и пересчитываются в новый интервал.
+func (a *leakyBucket) resize(capacity int64, ratePerSecond float64, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var queued float64
+	if a.next.After(now) {
+		queued = float64(a.next.Sub(now)) / float64(a.interval)
+	}
+	a.limit, a.interval, a.maxDelay = algorithmParams(capacity, ratePerSecond)
+	a.next = now.Add(floatDuration(queued * float64(a.interval)))
+}
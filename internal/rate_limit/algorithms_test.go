@@ -0,0 +1,244 @@
+package rate_limit
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"load-balancer/internal/models"
+)
+
+var t0 = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// step — запрос стоимостью cost через at после t0 и ожидаемое решение по нему.
+type step struct {
+	at         time.Duration
+	cost       int64
+	allowed    bool
+	remaining  int64
+	retryAfter time.Duration
+	delay      time.Duration
+}
+
+func TestAlgorithmAllow(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		capacity  int64
+		rate      float64
+		steps     []step
+	}{
+		{
+			algorithm: models.AlgorithmTokenBucket,
+			capacity:  3,
+			rate:      1,
+			steps: []step{
+				{at: 0, cost: 1, allowed: true, remaining: 2},
+				{at: 0, cost: 2, allowed: true, remaining: 0},
+				{at: 0, cost: 1, retryAfter: time.Second},
+				{at: 500 * time.Millisecond, cost: 1, retryAfter: 500 * time.Millisecond},
+				{at: 2 * time.Second, cost: 2, allowed: true, remaining: 0},
+			},
+		},
+		{
+			algorithm: models.AlgorithmSlidingWindowLog,
+			capacity:  3,
+			rate:      1,
+			steps: []step{
+				{at: 0, cost: 1, allowed: true, remaining: 2},
+				{at: time.Second, cost: 2, allowed: true, remaining: 0},
+				{at: time.Second, cost: 1, retryAfter: 2 * time.Second},
+				{at: 2 * time.Second, cost: 2, retryAfter: 2 * time.Second},
+				{at: 3 * time.Second, cost: 1, allowed: true, remaining: 0},
+				{at: 4 * time.Second, cost: 2, allowed: true, remaining: 0},
+			},
+		},
+		{
+			algorithm: models.AlgorithmSlidingWindowCounter,
+			capacity:  4,
+			rate:      1,
+			steps: []step{
+				{at: 0, cost: 1, allowed: true, remaining: 3},
+				{at: 0, cost: 3, allowed: true, remaining: 0},
+				{at: 0, cost: 1, retryAfter: 4 * time.Second},
+				// Предыдущее окно учитывается наполовину: 4*0.5 + 1 = 3.
+				{at: 6 * time.Second, cost: 1, allowed: true, remaining: 1},
+				{at: 6 * time.Second, cost: 2, remaining: 1, retryAfter: time.Second},
+			},
+		},
+		{
+			algorithm: models.AlgorithmGCRA,
+			capacity:  3,
+			rate:      1,
+			steps: []step{
+				{at: 0, cost: 1, allowed: true, remaining: 2},
+				{at: 0, cost: 2, allowed: true, remaining: 0},
+				{at: 0, cost: 1, retryAfter: time.Second},
+				{at: 1500 * time.Millisecond, cost: 1, allowed: true, remaining: 0},
+				{at: 10 * time.Second, cost: 3, allowed: true, remaining: 0},
+			},
+		},
+		{
+			algorithm: models.AlgorithmLeakyBucket,
+			capacity:  3,
+			rate:      1,
+			steps: []step{
+				{at: 0, cost: 1, allowed: true, remaining: 2},
+				{at: 0, cost: 2, allowed: true, remaining: 0, delay: time.Second},
+				{at: 0, cost: 1, retryAfter: time.Second},
+				{at: 2 * time.Second, cost: 1, allowed: true, remaining: 1, delay: time.Second},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			state := newAlgorithm(tt.algorithm, tt.capacity, tt.rate, t0)
+			for i, s := range tt.steps {
+				got := state.allow(t0.Add(s.at), s.cost)
+				if got.Allowed != s.allowed || got.Remaining != s.remaining || got.RetryAfter != s.retryAfter ||
+					got.delay != s.delay {
+					t.Errorf("step %d: got allowed=%v remaining=%d retryAfter=%v delay=%v, want %+v",
+						i, got.Allowed, got.Remaining, got.RetryAfter, got.delay, s)
+				}
+				if got.Limit != tt.capacity {
+					t.Errorf("step %d: Limit = %d, want %d", i, got.Limit, tt.capacity)
+				}
+			}
+		})
+	}
+}
+
+func TestAlgorithmRefund(t *testing.T) {
+	algorithms := []string{
+		models.AlgorithmTokenBucket,
+		models.AlgorithmSlidingWindowLog,
+		models.AlgorithmSlidingWindowCounter,
+		models.AlgorithmGCRA,
+		models.AlgorithmLeakyBucket,
+	}
+	for _, name := range algorithms {
+		t.Run(name, func(t *testing.T) {
+			state := newAlgorithm(name, 3, 1, t0)
+			if got := state.allow(t0, 3); !got.Allowed {
+				t.Fatalf("first request rejected: %+v", got)
+			}
+			if got := state.allow(t0, 1); got.Allowed {
+				t.Fatalf("request over the limit allowed: %+v", got)
+			}
+
+			state.refund(t0, 3)
+			if got := state.allow(t0, 3); !got.Allowed {
+				t.Errorf("request after refund rejected: %+v", got)
+			}
+		})
+	}
+}
+
+func TestAlgorithmResize(t *testing.T) {
+	tests := []struct {
+		name       string
+		algorithm  string
+		capacity   int64
+		rate       float64
+		taken      int64
+		next       step
+		resizeTo   int64
+		resizeRate float64
+	}{
+		// Ёмкость уменьшилась с 4 до 2 после трёх пропущенных запросов.
+		{
+			name: "shrink", algorithm: models.AlgorithmTokenBucket, capacity: 4, rate: 1, taken: 3,
+			resizeTo: 2, resizeRate: 1,
+			next: step{cost: 1, allowed: true, remaining: 0},
+		},
+		{
+			name: "shrink", algorithm: models.AlgorithmSlidingWindowLog, capacity: 4, rate: 1, taken: 3,
+			resizeTo: 2, resizeRate: 1,
+			next: step{cost: 1, retryAfter: 2 * time.Second},
+		},
+		{
+			name: "shrink", algorithm: models.AlgorithmSlidingWindowCounter, capacity: 4, rate: 1, taken: 3,
+			resizeTo: 2, resizeRate: 1,
+			next: step{cost: 1, retryAfter: 2 * time.Second},
+		},
+		{
+			name: "shrink", algorithm: models.AlgorithmGCRA, capacity: 4, rate: 1, taken: 3,
+			resizeTo: 2, resizeRate: 1,
+			next: step{cost: 1, retryAfter: 2 * time.Second},
+		},
+		{
+			name: "shrink", algorithm: models.AlgorithmLeakyBucket, capacity: 4, rate: 1, taken: 3,
+			resizeTo: 2, resizeRate: 1,
+			next: step{cost: 1, retryAfter: 2 * time.Second},
+		},
+		// Темп вырос вдвое после двух пропущенных запросов: израсходованное сохраняется.
+		{
+			name: "faster", algorithm: models.AlgorithmTokenBucket, capacity: 4, rate: 1, taken: 2,
+			resizeTo: 4, resizeRate: 2,
+			next: step{cost: 3, retryAfter: 500 * time.Millisecond, remaining: 2},
+		},
+		{
+			name: "faster", algorithm: models.AlgorithmSlidingWindowLog, capacity: 4, rate: 1, taken: 2,
+			resizeTo: 4, resizeRate: 2,
+			next: step{cost: 3, retryAfter: 2 * time.Second, remaining: 2},
+		},
+		{
+			name: "faster", algorithm: models.AlgorithmSlidingWindowCounter, capacity: 4, rate: 1, taken: 2,
+			resizeTo: 4, resizeRate: 2,
+			next: step{cost: 3, retryAfter: 2 * time.Second, remaining: 2},
+		},
+		{
+			name: "faster", algorithm: models.AlgorithmGCRA, capacity: 4, rate: 1, taken: 2,
+			resizeTo: 4, resizeRate: 2,
+			next: step{cost: 3, retryAfter: 500 * time.Millisecond, remaining: 2},
+		},
+		{
+			name: "faster", algorithm: models.AlgorithmLeakyBucket, capacity: 4, rate: 1, taken: 2,
+			resizeTo: 4, resizeRate: 2,
+			next: step{cost: 3, retryAfter: 500 * time.Millisecond},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+"/"+tt.algorithm, func(t *testing.T) {
+			state := newAlgorithm(tt.algorithm, tt.capacity, tt.rate, t0)
+			if got := state.allow(t0, tt.taken); !got.Allowed {
+				t.Fatalf("first request rejected: %+v", got)
+			}
+
+			state.resize(tt.resizeTo, tt.resizeRate, t0)
+			got := state.allow(t0, tt.next.cost)
+			if got.Allowed != tt.next.allowed || got.RetryAfter != tt.next.retryAfter ||
+				got.Remaining != tt.next.remaining {
+				t.Errorf("got allowed=%v remaining=%d retryAfter=%v, want %+v",
+					got.Allowed, got.Remaining, got.RetryAfter, tt.next)
+			}
+			if got.Limit != tt.resizeTo {
+				t.Errorf("Limit = %d, want %d", got.Limit, tt.resizeTo)
+			}
+		})
+	}
+}
+
+func TestAlgorithmParamsSaturate(t *testing.T) {
+	tests := []struct {
+		name          string
+		capacity      int64
+		ratePerSecond float64
+		wantInterval  time.Duration
+		wantWindow    time.Duration
+	}{
+		{name: "regular limit", capacity: 10, ratePerSecond: 2, wantInterval: 500 * time.Millisecond, wantWindow: 5 * time.Second},
+		{name: "huge capacity", capacity: math.MaxInt64, ratePerSecond: 1, wantInterval: time.Second, wantWindow: math.MaxInt64},
+		{name: "tiny rate", capacity: 10, ratePerSecond: 1e-12, wantInterval: math.MaxInt64, wantWindow: math.MaxInt64},
+		{name: "tiny rate and huge capacity", capacity: math.MaxInt64, ratePerSecond: 1e-300, wantInterval: math.MaxInt64, wantWindow: math.MaxInt64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, interval, window := algorithmParams(tt.capacity, tt.ratePerSecond)
+			if interval != tt.wantInterval || window != tt.wantWindow {
+				t.Errorf("algorithmParams() = interval %v, window %v; want %v, %v", interval, window, tt.wantInterval, tt.wantWindow)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package rate_limit
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"load-balancer/internal/identity"
+)
+
+// CostConfig — правила, по которым определяется стоимость запроса в единицах лимита.
+type CostConfig struct {
+	// Routes — стоимость запросов по методу и префиксу пути. Остальные запросы стоят 1.
+	Routes []CostRoute
+	// Header — заголовок запроса со стоимостью, который выставляет доверенный сервис перед балансировщиком. Его
+	// значение учитывается, только если запрос пришёл с адреса из TrustedProxies, не больше MaxHeaderCost и только
+	// если оно больше стоимости по маршруту.
+	Header         string
+	MaxHeaderCost  int64
+	TrustedProxies identity.TrustedProxies
+	// BodyBytesPerUnit — если больше нуля, к стоимости добавляется единица за каждые начатые BodyBytesPerUnit байт
+	// тела запроса.
+	BodyBytesPerUnit int64
+	// ResponseHeader — заголовок ответа бэкенда со стоимостью, которая списывается после ответа. Клиенту заголовок
+	// не передаётся.
+	ResponseHeader string
+}
+
+// CostRoute — стоимость запросов с методом Method (пустой — любой) и путём, начинающимся с PathPrefix.
+type CostRoute struct {
+	Method     string
+	PathPrefix string
+	Cost       int64
+}
+
+type CostRules struct {
+	cfg CostConfig
+}
+
+// NewCostRules — создаёт правила стоимости запросов. Маршруты проверяются от самого длинного префикса к самому
+// короткому.
+func NewCostRules(cfg CostConfig) *CostRules {
+	routes := append([]CostRoute(nil), cfg.Routes...)
+	sort.SliceStable(routes, func(i, j int) bool { return len(routes[i].PathPrefix) > len(routes[j].PathPrefix) })
+	cfg.Routes = routes
+	return &CostRules{cfg: cfg}
+}
+
+// RequestCost — стоимость запроса, известная до его выполнения: по маршруту или заголовку плюс размер тела
+// по Content-Length. Не меньше 1. Заголовок со стоимостью от недоверенного адреса удаляется из запроса, чтобы
+// не дойти до бэкенда.
+func (c *CostRules) RequestCost(r *http.Request) int64 {
+	cost := int64(1)
+	for _, route := range c.cfg.Routes {
+		if (route.Method == "" || route.Method == r.Method) && strings.HasPrefix(r.URL.Path, route.PathPrefix) {
+			cost = route.Cost
+			break
+		}
+	}
+
+	if c.cfg.Header != "" {
+		if !c.cfg.TrustedProxies.FromTrusted(r) {
+			r.Header.Del(c.cfg.Header)
+		} else if n, ok := parseCost(r.Header.Get(c.cfg.Header)); ok {
+			if c.cfg.MaxHeaderCost > 0 {
+				n = min(n, c.cfg.MaxHeaderCost)
+			}
+			cost = max(cost, n)
+		}
+	}
+
+	cost += c.BodyCost(max(r.ContentLength, 0))
+
+	return max(cost, 1)
+}
+
+// CountsBody — true, если стоимость зависит от размера тела запроса.
+func (c *CostRules) CountsBody() bool {
+	return c.cfg.BodyBytesPerUnit > 0
+}
+
+// BodyCost — стоимость тела запроса размером size байт.
+func (c *CostRules) BodyCost(size int64) int64 {
+	if c.cfg.BodyBytesPerUnit <= 0 || size <= 0 {
+		return 0
+	}
+	return (size + c.cfg.BodyBytesPerUnit - 1) / c.cfg.BodyBytesPerUnit
+}
+
+// Deferred — true, если стоимость запросов досписывается по ответу бэкенда.
+func (c *CostRules) Deferred() bool {
+	return c.cfg.ResponseHeader != ""
+}
+
+// ResponseCost — забирает из заголовков ответа бэкенда стоимость, которую нужно досписать, и удаляет заголовок.
+func (c *CostRules) ResponseCost(h http.Header) int64 {
+	if c.cfg.ResponseHeader == "" {
+		return 0
+	}
+	raw := h.Get(c.cfg.ResponseHeader)
+	h.Del(c.cfg.ResponseHeader)
+	n, _ := parseCost(raw)
+	return n
+}
+
+func parseCost(raw string) (int64, bool) {
+	if raw == "" {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,114 @@
+package rate_limit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"load-balancer/internal/identity"
+)
+
+func TestRequestCost(t *testing.T) {
+	trusted, err := identity.ParseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := NewCostRules(CostConfig{
+		Routes: []CostRoute{
+			{Method: http.MethodPost, PathPrefix: "/search", Cost: 50},
+			{PathPrefix: "/api", Cost: 2},
+		},
+		Header:           "X-Request-Cost",
+		MaxHeaderCost:    100,
+		TrustedProxies:   trusted,
+		BodyBytesPerUnit: 1024,
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		remoteAddr string
+		header     string
+		body       string
+		chunked    bool
+		want       int64
+		wantHeader string
+	}{
+		{name: "default", method: http.MethodGet, path: "/", remoteAddr: "203.0.113.1:1234", want: 1},
+		{name: "route", method: http.MethodGet, path: "/api/users", remoteAddr: "203.0.113.1:1234", want: 2},
+		{name: "longest prefix with method", method: http.MethodPost, path: "/search", remoteAddr: "203.0.113.1:1234", want: 50},
+		{
+			name: "header from untrusted address is stripped", method: http.MethodPost, path: "/search",
+			remoteAddr: "203.0.113.1:1234", header: "1", want: 50,
+		},
+		{
+			name: "header from trusted proxy cannot lower route cost", method: http.MethodPost, path: "/search",
+			remoteAddr: "10.1.2.3:1234", header: "1", want: 50, wantHeader: "1",
+		},
+		{
+			name: "header from trusted proxy raises cost", method: http.MethodGet, path: "/api",
+			remoteAddr: "10.1.2.3:1234", header: "30", want: 30, wantHeader: "30",
+		},
+		{
+			name: "header capped", method: http.MethodGet, path: "/", remoteAddr: "10.1.2.3:1234", header: "5000",
+			want: 100, wantHeader: "5000",
+		},
+		{
+			name: "invalid header ignored", method: http.MethodGet, path: "/api", remoteAddr: "10.1.2.3:1234",
+			header: "-3", want: 2, wantHeader: "-3",
+		},
+		{
+			name: "body by content length", method: http.MethodPost, path: "/api", remoteAddr: "203.0.113.1:1234",
+			body: strings.Repeat("x", 2049), want: 5,
+		},
+		{
+			name: "chunked body is charged after reading", method: http.MethodPost, path: "/api",
+			remoteAddr: "203.0.113.1:1234", body: strings.Repeat("x", 2049), chunked: true, want: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			r.RemoteAddr = tt.remoteAddr
+			if tt.chunked {
+				r.ContentLength = -1
+			}
+			if tt.header != "" {
+				r.Header.Set("X-Request-Cost", tt.header)
+			}
+
+			if got := rules.RequestCost(r); got != tt.want {
+				t.Errorf("RequestCost() = %d, want %d", got, tt.want)
+			}
+			if got := r.Header.Get("X-Request-Cost"); got != tt.wantHeader {
+				t.Errorf("cost header = %q, want %q", got, tt.wantHeader)
+			}
+		})
+	}
+}
+
+func TestBodyCost(t *testing.T) {
+	rules := NewCostRules(CostConfig{BodyBytesPerUnit: 1024})
+	tests := []struct {
+		size int64
+		want int64
+	}{
+		{size: -1, want: 0},
+		{size: 0, want: 0},
+		{size: 1, want: 1},
+		{size: 1024, want: 1},
+		{size: 1025, want: 2},
+	}
+	for _, tt := range tests {
+		if got := rules.BodyCost(tt.size); got != tt.want {
+			t.Errorf("BodyCost(%d) = %d, want %d", tt.size, got, tt.want)
+		}
+	}
+
+	if NewCostRules(CostConfig{}).BodyCost(4096) != 0 {
+		t.Error("BodyCost without body_bytes_per_unit must be 0")
+	}
+}
@@ -0,0 +1,173 @@
+package rate_limit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"load-balancer/internal/metrics"
+	"load-balancer/internal/models"
+	"load-balancer/internal/repo"
+)
+
+// DistributedConfig — настройки токен-бакета, общего для всех инстансов. Бакет хранится в БД, а инстанс забирает
+// из него токены порциями (арендой), чтобы не обращаться к БД на каждый запрос.
+type DistributedConfig struct {
+	// LeaseSize — сколько токенов инстанс забирает из БД за раз. 1 — каждый запрос идёт в БД, лимит точный.
+	LeaseSize int64
+	// LeaseTTL — сколько инстанс держит взятые токены. Неизрасходованные токены после этого возвращаются в БД.
+	LeaseTTL time.Duration
+}
+
+// lease — токены клиента, взятые инстансом из общего бакета, и состояние бакета на момент их получения.
+type lease struct {
+	mu sync.Mutex
+	// removed — аренда убрана из памяти, пока её ждал запрос; запрос должен взять новую.
+	removed bool
+
+	tokens        int64
+	validUntil    time.Time
+	shared        float64
+	takenAt       time.Time
+	capacity      int64
+	ratePerSecond float64
+	status        string
+	expiresAt     *time.Time
+	lastSeen      time.Time
+}
+
+// allowShared — AllowN в распределённом режиме. Запрос оплачивается из аренды; если её не хватает или она истекла,
+// остаток возвращается в БД одним запросом с получением новой аренды. Инстанс не может выдать больше токенов, чем
+// получил из БД, поэтому все инстансы вместе не превышают лимит клиента. Пока по последнему ответу БД токенов для
+// запроса не набралось, запрос отклоняется без обращения к БД.
+func (tb *TokenBucket) allowShared(ctx context.Context, clientID string, cost int64) (Decision, error) {
+	l := tb.lockLease(clientID)
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.lastSeen = now
+	if !now.Before(l.validUntil) || (l.tokens < cost && l.available(now) >= float64(cost)) {
+		if err := tb.renewLease(ctx, clientID, l, max(tb.distributed.LeaseSize, cost), cost, 0, now); err != nil {
+			return Decision{}, err
+		}
+	}
+
+	if err := checkLifecycle(l.status, l.expiresAt, now); err != nil {
+		return Decision{}, err
+	}
+
+	available := l.available(now)
+	decision := takeTokens(&available, l.capacity, l.ratePerSecond, cost)
+	if decision.Allowed {
+		l.tokens -= cost
+	}
+	return decision, nil
+}
+
+// chargeShared — Charge в распределённом режиме: cost списывается из аренды, а то, чего в ней не хватило, — из БД.
+func (tb *TokenBucket) chargeShared(ctx context.Context, clientID string, cost int64) error {
+	l := tb.lockLease(clientID)
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.lastSeen = now
+	if l.tokens >= cost {
+		l.tokens -= cost
+		return nil
+	}
+	return tb.renewLease(ctx, clientID, l, 0, 0, -float64(cost), now)
+}
+
+// lockLease — возвращает заблокированную аренду клиента, создавая её при первом запросе.
+func (tb *TokenBucket) lockLease(clientID string) *lease {
+	for {
+		tb.mu.Lock()
+		l, ok := tb.leases[clientID]
+		if !ok {
+			l = &lease{}
+			tb.leases[clientID] = l
+		}
+		tb.mu.Unlock()
+
+		l.mu.Lock()
+		if !l.removed {
+			return l
+		}
+		l.mu.Unlock()
+	}
+}
+
+// renewLease — возвращает в БД остаток аренды вместе с adjust и берёт новую аренду до want токенов, если в бакете есть
+// хотя бы need. Вызывается под l.mu.
+func (tb *TokenBucket) renewLease(ctx context.Context, clientID string, l *lease, want, need int64, adjust float64, now time.Time) error {
+	start := time.Now()
+	grant, err := tb.repo.TakeTokens(ctx, clientID, want, need, float64(l.tokens)+adjust)
+	tb.metrics.ObserveTokenBucketOperation(metrics.OperationTake, time.Since(start), err)
+	if errors.Is(err, repo.ErrClientNotFound) {
+		return ErrUnknownClient
+	}
+	if err != nil {
+		return errors.Wrap(err, "error taking tokens")
+	}
+
+	l.tokens = grant.Granted
+	l.validUntil = now.Add(tb.distributed.LeaseTTL)
+	l.shared = grant.Tokens
+	l.takenAt = now
+	l.capacity = grant.Capacity
+	l.ratePerSecond = models.RefillRate(grant.Rate, grant.RatePeriod)
+	l.status = grant.Status
+	l.expiresAt = grant.ExpiresAt
+	return nil
+}
+
+// available — оценка токенов клиента на всех инстансах: аренда плюс остаток в БД, пополненный с момента получения
+// аренды. Аренды других инстансов не учитываются.
+func (l *lease) available(now time.Time) float64 {
+	shared := l.shared
+	takenAt := l.takenAt
+	refill(&shared, &takenAt, l.capacity, l.ratePerSecond, now)
+	return min(float64(l.tokens)+shared, float64(l.capacity))
+}
+
+// returnLeases — возвращает в БД неизрасходованные токены аренд: истёкших или, если all, всех.
+func (tb *TokenBucket) returnLeases(ctx context.Context, all bool) error {
+	tb.mu.Lock()
+	leases := make(map[string]*lease, len(tb.leases))
+	for id, l := range tb.leases {
+		leases[id] = l
+	}
+	tb.mu.Unlock()
+
+	var returnErr error
+	now := time.Now()
+	for id, l := range leases {
+		l.mu.Lock()
+		if !l.removed && l.tokens > 0 && (all || !now.Before(l.validUntil)) {
+			if err := tb.renewLease(ctx, id, l, 0, 0, 0, now); err != nil {
+				returnErr = err
+			}
+		}
+		l.mu.Unlock()
+	}
+	return returnErr
+}
+
+// cleanupInactiveLeases — убирает из памяти аренды клиентов, которые давно не делали запросов и не держат токенов.
+// Занятые сейчас аренды пропускаются, чтобы не ждать их запроса к БД под tb.mu.
+func (tb *TokenBucket) cleanupInactiveLeases(timeout time.Duration) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	for id, l := range tb.leases {
+		if !l.mu.TryLock() {
+			continue
+		}
+		if l.tokens == 0 && time.Since(l.lastSeen) > timeout {
+			l.removed = true
+			delete(tb.leases, id)
+		}
+		l.mu.Unlock()
+	}
+}
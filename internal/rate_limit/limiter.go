@@ -0,0 +1,552 @@
+package rate_limit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"load-balancer/internal/models"
+	"load-balancer/internal/repo"
+)
+
+var (
+	ErrUnknownClient   = errors.New("unknown client")
+	ErrClientSuspended = errors.New("client suspended")
+	ErrClientDisabled  = errors.New("client disabled")
+	ErrClientExpired   = errors.New("client expired")
+)
+
+// DefaultPolicy — имя общего лимита клиента в решениях лимитера.
+const DefaultPolicy = "default"
+
+// AnonymousPolicy — имя лимита анонимных запросов в решениях лимитера.
+const AnonymousPolicy = "anonymous"
+
+// Tier — лимит, который задаётся в конфигурации, а не записью клиента в БД.
+type Tier struct {
+	Capacity      int64
+	RatePerSecond float64
+	Algorithm     string
+}
+
+// Request — запрос клиента, по которому лимитер принимает решение.
+type Request struct {
+	// ClientID — клиент, у которого берутся лимиты, статус и квоты.
+	ClientID string
+	// Key — ключ, по которому считается расход лимитов, например ID клиента вместе с подсетью. Пустой — ClientID.
+	Key string
+	// Anonymous — запрос без данных о клиенте; ClientID тогда адрес или подсеть, которые делят анонимный лимит.
+	Anonymous bool
+	Method    string
+	Path      string
+	// Cost — сколько единиц лимита расходует запрос; 0 считается за 1.
+	Cost int64
+}
+
+// key — ключ расхода лимитов с учётом значения по умолчанию.
+func (req Request) key() string {
+	if req.Key == "" {
+		return req.ClientID
+	}
+	return req.Key
+}
+
+// cost — стоимость запроса с учётом значения по умолчанию.
+func (req Request) cost() int64 {
+	return max(req.Cost, 1)
+}
+
+// Decision — решение лимитера по запросу и состояние лимита клиента после него.
+type Decision struct {
+	Allowed bool
+	// Policy — лимит, к которому относится решение: DefaultPolicy или имя политики маршрута.
+	Policy string
+	// Limit — сколько запросов клиент может сделать за Window, начиная с полного лимита.
+	Limit  int64
+	Window time.Duration
+	// Remaining — сколько запросов клиент может сделать прямо сейчас.
+	Remaining int64
+	// Reset — через сколько лимит восстановится полностью.
+	Reset time.Duration
+	// RetryAfter — через сколько стоит повторить отклонённый запрос. Для пропущенного запроса — 0.
+	RetryAfter time.Duration
+	// delay — сколько пропущенный запрос должен подождать своей очереди, прежде чем уйти на бэкенд (leaky bucket).
+	delay time.Duration
+}
+
+// Limiter — рейт-лимитер запросов клиентов.
+type Limiter interface {
+	// Allow — решает, можно ли выполнить запрос клиента. Неизвестному клиенту возвращает ErrUnknownClient,
+	// приостановленному, отключённому и истёкшему — ErrClientSuspended, ErrClientDisabled и ErrClientExpired.
+	// Анонимному запросу без настроенного анонимного лимита возвращает ErrUnknownClient, клиенту с исчерпанной
+	// квотой — *QuotaExceededError.
+	Allow(ctx context.Context, req Request) (Decision, error)
+	// Charge — дополнительно списывает с лимитов клиента cost единиц за уже выполненный запрос, например по стоимости,
+	// которую сообщил бэкенд. Лимит может уйти в минус, тогда следующие запросы ждут, пока он восстановится.
+	Charge(ctx context.Context, req Request, cost int64) error
+	// Invalidate — забывает закешированные настройки клиента, чтобы изменения применились со следующего запроса.
+	Invalidate(clientID string)
+}
+
+// algorithm — состояние алгоритма рейт-лимита для одного клиента. Методы не блокируются: если запрос должен
+// подождать, allow возвращает задержку в Decision.delay.
+type algorithm interface {
+	allow(now time.Time, cost int64) Decision
+	charge(now time.Time, cost int64)
+	// refund — возвращает cost, пропущенный allow в момент takenAt, если запрос всё же не выполнится.
+	refund(takenAt time.Time, cost int64)
+	// resize — меняет лимиты, сохраняя уже израсходованное.
+	resize(capacity int64, ratePerSecond float64, now time.Time)
+}
+
+// clientLimiter — настройки клиента, загруженные из БД, и состояние его алгоритма для одного ключа расхода. Если state
+// равен nil, общий лимит клиента ведёт TokenBucket.
+type clientLimiter struct {
+	clientID  string
+	policy    string
+	plan      string
+	overrides *models.LimitOverrides
+	algorithm string
+	status    string
+	expiresAt *time.Time
+	state     algorithm
+	lastSeen  time.Time
+}
+
+// routeKey — лимит клиента по политике маршрута.
+type routeKey struct {
+	key       string
+	anonymous bool
+	policy    string
+}
+
+// routeLimiter — состояние лимита клиента по политике и политика, по которой оно создано.
+type routeLimiter struct {
+	policy   *models.RateLimitPolicy
+	state    algorithm
+	lastSeen time.Time
+}
+
+type Dispatcher struct {
+	repo          repo.Repository
+	tokenBucket   *TokenBucket
+	policies      *Policies
+	quotas        *Quotas
+	anonymousTier *Tier
+	logger        *zap.SugaredLogger
+
+	mu sync.Mutex
+	// clients — настройки и состояние клиентов по ключу расхода.
+	clients   map[string]*clientLimiter
+	anonymous map[string]*clientLimiter
+	routes    map[routeKey]*routeLimiter
+}
+
+// NewDispatcher — создаёт лимитер, который применяет к каждому клиенту алгоритм из его записи в БД, политики
+// маршрутов и квоты клиента. Клиенты с токен-бакетом обслуживаются TokenBucket, чьё состояние сохраняется в БД;
+// состояние остальных алгоритмов и лимитов по маршрутам хранится только в памяти инстанса. Если anonymousTier задан,
+// анонимные запросы ограничиваются им отдельно для каждого адреса или подсети; его состояние тоже хранится в памяти,
+// а квоты к анонимным запросам не применяются. Если ключ расхода запроса отличается от ID клиента, лимиты клиента
+// считаются по этому ключу в памяти, даже для токен-бакета: токены клиента в БД относятся ко всему клиенту.
+func NewDispatcher(repo repo.Repository, tokenBucket *TokenBucket, policies *Policies, quotas *Quotas, anonymousTier *Tier,
+	logger *zap.SugaredLogger) *Dispatcher {
+	return &Dispatcher{
+		repo:          repo,
+		tokenBucket:   tokenBucket,
+		policies:      policies,
+		quotas:        quotas,
+		anonymousTier: anonymousTier,
+		logger:        logger,
+		clients:       make(map[string]*clientLimiter),
+		anonymous:     make(map[string]*clientLimiter),
+		routes:        make(map[routeKey]*routeLimiter),
+	}
+}
+
+// Allow — проверяет запрос по квотам клиента, затем по лимиту клиента на маршрут, если для маршрута есть политика,
+// и по общему лимиту клиента. Исчерпанная квота возвращается ошибкой *QuotaExceededError. Запрос пропускается, только
+// если его пропускают все; в ответе возвращается решение по тому лимиту, который запрос отклонил или у которого
+// осталось меньше запросов. Отклонённый по маршруту запрос общий лимит не расходует, а отклонённый любым лимитом —
+// квоты и остальные лимиты. Если лимит с leaky bucket ставит запрос в очередь, Allow ждёт её только после того, как
+// запрос пропустили все лимиты; если контекст отменён во время ожидания, списанное возвращается.
+func (d *Dispatcher) Allow(ctx context.Context, req Request) (Decision, error) {
+	now := time.Now()
+
+	cl, err := d.limiterFor(ctx, req, now)
+	if err != nil {
+		return Decision{}, err
+	}
+	if err := checkLifecycle(cl.status, cl.expiresAt, now); err != nil {
+		return Decision{}, err
+	}
+
+	if !req.Anonymous {
+		if err := d.quotas.take(ctx, req.ClientID, req.cost(), now); err != nil {
+			return Decision{}, err
+		}
+	}
+	refund := func() {
+		if !req.Anonymous {
+			d.quotas.refund(req.ClientID, req.cost(), now)
+		}
+	}
+
+	var (
+		route      *Decision
+		routeState algorithm
+	)
+	if policy := d.policies.Match(req.Method, req.Path); policy != nil {
+		routeState = d.route(req, policy, now).state
+		decision := routeState.allow(now, req.cost())
+		decision.Policy = policy.Name
+		if !decision.Allowed {
+			refund()
+			return decision, nil
+		}
+		route = &decision
+	}
+	release := func() {
+		refund()
+		if routeState != nil {
+			routeState.refund(now, req.cost())
+		}
+	}
+
+	var global Decision
+	if cl.state == nil {
+		global, err = d.tokenBucket.AllowN(ctx, req.ClientID, req.cost())
+	} else {
+		global = cl.state.allow(now, req.cost())
+	}
+	if err != nil {
+		release()
+		return Decision{}, err
+	}
+	global.Policy = cl.policy
+	if !global.Allowed {
+		release()
+		return global, nil
+	}
+
+	delay := global.delay
+	if route != nil {
+		delay = max(delay, route.delay)
+	}
+	if err := wait(ctx, delay); err != nil {
+		release()
+		if cl.state == nil {
+			d.tokenBucket.Refund(context.WithoutCancel(ctx), req.ClientID, req.cost())
+		} else {
+			cl.state.refund(now, req.cost())
+		}
+		return Decision{}, err
+	}
+
+	if route != nil && route.Remaining < global.Remaining {
+		return *route, nil
+	}
+	return global, nil
+}
+
+// wait — ждёт delay или отмены контекста.
+func wait(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Charge — списывает cost единиц с общего лимита клиента, с его лимита по политике маршрута запроса и с его квот.
+func (d *Dispatcher) Charge(ctx context.Context, req Request, cost int64) error {
+	if cost <= 0 {
+		return nil
+	}
+	now := time.Now()
+
+	cl, err := d.limiterFor(ctx, req, now)
+	if err != nil {
+		return err
+	}
+	if !req.Anonymous {
+		if err := d.quotas.charge(ctx, req.ClientID, cost, now); err != nil {
+			return err
+		}
+	}
+	if policy := d.policies.Match(req.Method, req.Path); policy != nil {
+		d.route(req, policy, now).state.charge(now, cost)
+	}
+	if cl.state == nil {
+		return d.tokenBucket.Charge(ctx, req.ClientID, cost)
+	}
+	cl.state.charge(now, cost)
+	return nil
+}
+
+// route — возвращает лимит клиента по политике, создавая его при первом запросе и после изменения политики.
+func (d *Dispatcher) route(req Request, policy *models.RateLimitPolicy, now time.Time) *routeLimiter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := routeKey{key: req.key(), anonymous: req.Anonymous, policy: policy.Name}
+	rl, ok := d.routes[key]
+	if !ok || rl.policy != policy {
+		rl = &routeLimiter{
+			policy: policy,
+			state:  newAlgorithm(policy.Algorithm, policy.Capacity, policy.RatePerSecond, now),
+		}
+		d.routes[key] = rl
+	}
+	rl.lastSeen = now
+	return rl
+}
+
+// Invalidate — забывает настройки и состояние клиента по всем его ключам расхода, в том числе в TokenBucket,
+// и перечитывает его квоты. Лимиты клиента по маршрутам и расход квот сохраняются.
+func (d *Dispatcher) Invalidate(clientID string) {
+	d.mu.Lock()
+	for key, cl := range d.clients {
+		if cl.clientID == clientID {
+			delete(d.clients, key)
+		}
+	}
+	d.mu.Unlock()
+
+	d.tokenBucket.Invalidate(clientID)
+	d.quotas.invalidate(clientID)
+}
+
+// ApplyPlan — применяет изменённые лимиты плана к его клиентам в памяти с учётом их переопределений. Состояние
+// алгоритма клиента пересчитывается под новые лимиты с сохранением израсходованного, как TokenBucket сохраняет
+// токены. Если у клиента сменился алгоритм, его настройки загружаются из БД заново со следующего запроса, и лимит
+// по новому алгоритму начинается заново.
+func (d *Dispatcher) ApplyPlan(plan *models.Plan) {
+	now := time.Now()
+
+	d.mu.Lock()
+	for id, cl := range d.clients {
+		if cl.plan != plan.Name {
+			continue
+		}
+		capacity, rate, period, algorithm := plan.Limits(cl.overrides)
+		switch {
+		case algorithm != cl.algorithm:
+			delete(d.clients, id)
+		case cl.state != nil:
+			cl.state.resize(capacity, models.RefillRate(rate, period), now)
+		}
+	}
+	d.mu.Unlock()
+
+	d.tokenBucket.ApplyPlan(plan)
+}
+
+// RefreshClients — перечитывает из БД статус и срок действия клиентов, настройки которых есть в памяти, и забывает
+// тех, у кого они изменились или кто удалён, как это делает Invalidate. Так приостановка, отключение и удаление
+// клиента через админский API другого инстанса применяются и здесь.
+func (d *Dispatcher) RefreshClients(ctx context.Context) error {
+	d.mu.Lock()
+	known := make(map[string]*clientLimiter, len(d.clients))
+	for _, cl := range d.clients {
+		known[cl.clientID] = cl
+	}
+	d.mu.Unlock()
+	if len(known) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(known))
+	for id := range known {
+		ids = append(ids, id)
+	}
+	clients, err := d.repo.GetClientsByIDs(ctx, ids)
+	if err != nil {
+		return errors.Wrap(err, "failed to refresh clients")
+	}
+	current := make(map[string]*models.RateLimitClient, len(clients))
+	for _, client := range clients {
+		current[client.ClientID] = client
+	}
+
+	for id, cl := range known {
+		client, ok := current[id]
+		if ok && client.Status == cl.status && sameTime(client.ExpiresAt, cl.expiresAt) {
+			continue
+		}
+		d.Invalidate(id)
+		d.logger.Infow("client lifecycle changed, reloading client", "clientID", id, "deleted", !ok)
+	}
+	return nil
+}
+
+// StartClientRefresh — периодически вызывает RefreshClients.
+func (d *Dispatcher) StartClientRefresh(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.RefreshClients(ctx); err != nil {
+				d.logger.Errorw("failed to refresh rate limit clients", "error", err)
+			}
+		}
+	}
+}
+
+// StartInactiveCleaner — периодически убирает из памяти клиентов, которые давно не делали запросов, в том числе
+// из TokenBucket и квот.
+func (d *Dispatcher) StartInactiveCleaner(ctx context.Context, inactiveTimeout, tickerInterval time.Duration) {
+	ticker := time.NewTicker(tickerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.mu.Lock()
+			for id, cl := range d.clients {
+				if time.Since(cl.lastSeen) > inactiveTimeout {
+					delete(d.clients, id)
+				}
+			}
+			for id, cl := range d.anonymous {
+				if time.Since(cl.lastSeen) > inactiveTimeout {
+					delete(d.anonymous, id)
+				}
+			}
+			for key, rl := range d.routes {
+				if time.Since(rl.lastSeen) > inactiveTimeout {
+					delete(d.routes, key)
+				}
+			}
+			d.mu.Unlock()
+			d.tokenBucket.cleanupInactiveClients(inactiveTimeout)
+			d.quotas.cleanup(inactiveTimeout)
+		}
+	}
+}
+
+// limiterFor — возвращает лимит, которым ограничивается запрос: анонимный лимит адреса или лимит клиента.
+func (d *Dispatcher) limiterFor(ctx context.Context, req Request, now time.Time) (*clientLimiter, error) {
+	if !req.Anonymous {
+		return d.client(ctx, req, now)
+	}
+	if d.anonymousTier == nil {
+		return nil, ErrUnknownClient
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cl, ok := d.anonymous[req.ClientID]
+	if !ok {
+		cl = &clientLimiter{
+			policy:    AnonymousPolicy,
+			algorithm: d.anonymousTier.Algorithm,
+			status:    models.ClientActive,
+			state:     newAlgorithm(d.anonymousTier.Algorithm, d.anonymousTier.Capacity, d.anonymousTier.RatePerSecond, now),
+		}
+		d.anonymous[req.ClientID] = cl
+	}
+	cl.lastSeen = now
+	return cl, nil
+}
+
+// client — возвращает настройки клиента для ключа расхода запроса из памяти или загружает их из БД. Загрузка идёт
+// без блокировки, чтобы запросы других клиентов не ждали БД.
+func (d *Dispatcher) client(ctx context.Context, req Request, now time.Time) (*clientLimiter, error) {
+	clientID, key := req.ClientID, req.key()
+
+	d.mu.Lock()
+	cl, ok := d.clients[key]
+	if ok {
+		cl.lastSeen = now
+	}
+	d.mu.Unlock()
+	if ok {
+		return cl, nil
+	}
+
+	dbClient, err := d.repo.GetClientByID(ctx, clientID)
+	if errors.Is(err, repo.ErrClientNotFound) {
+		return nil, ErrUnknownClient
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting client")
+	}
+
+	cl = &clientLimiter{
+		clientID:  clientID,
+		policy:    DefaultPolicy,
+		plan:      dbClient.Plan,
+		overrides: dbClient.Overrides,
+		algorithm: dbClient.Algorithm,
+		status:    dbClient.Status,
+		expiresAt: dbClient.ExpiresAt,
+		lastSeen:  now,
+	}
+	if cl.algorithm == "" {
+		cl.algorithm = models.AlgorithmTokenBucket
+	}
+	rate := models.RefillRate(dbClient.Rate, time.Duration(dbClient.RatePeriod))
+	if cl.algorithm != models.AlgorithmTokenBucket {
+		cl.state = newAlgorithm(cl.algorithm, dbClient.Capacity, rate, now)
+		if cl.state == nil {
+			d.logger.Warnw("unknown rate limit algorithm, falling back to token bucket", "clientID", clientID,
+				"algorithm", cl.algorithm)
+			cl.algorithm = models.AlgorithmTokenBucket
+		}
+	}
+	if cl.state == nil && key != clientID {
+		cl.state = newAlgorithm(models.AlgorithmTokenBucket, dbClient.Capacity, rate, now)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if existing, ok := d.clients[key]; ok {
+		return existing, nil
+	}
+	d.clients[key] = cl
+	return cl, nil
+}
+
+// sameTime — true, если оба момента не заданы или совпадают.
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// checkLifecycle — проверяет, что клиенту разрешено работать: он активен и его срок не истёк.
+func checkLifecycle(status string, expiresAt *time.Time, now time.Time) error {
+	switch {
+	case status == models.ClientSuspended:
+		return ErrClientSuspended
+	case status == models.ClientDisabled:
+		return ErrClientDisabled
+	case expiresAt != nil && !now.Before(*expiresAt):
+		return ErrClientExpired
+	}
+	return nil
+}
+
+// durationFor — за сколько при скорости ratePerSecond начисляется tokens токенов.
+func durationFor(tokens, ratePerSecond float64) time.Duration {
+	if tokens <= 0 || ratePerSecond <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / ratePerSecond * float64(time.Second))
+}
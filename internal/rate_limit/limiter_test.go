@@ -0,0 +1,131 @@
+package rate_limit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"load-balancer/internal/models"
+	"load-balancer/internal/repo"
+)
+
+// fakeRepo — репозиторий с одним клиентом без квот; остальные методы тестам не нужны.
+type fakeRepo struct {
+	repo.Repository
+	client  *models.RateLimitClient
+	lookups map[string]int
+}
+
+func (f *fakeRepo) GetClientByID(_ context.Context, id string) (*models.RateLimitClient, error) {
+	f.lookups[id]++
+	if id != f.client.ClientID {
+		return nil, repo.ErrClientNotFound
+	}
+	c := *f.client
+	return &c, nil
+}
+
+func (f *fakeRepo) GetClientsByIDs(_ context.Context, ids []string) ([]*models.RateLimitClient, error) {
+	for _, id := range ids {
+		if id == f.client.ClientID {
+			c := *f.client
+			return []*models.RateLimitClient{&c}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeRepo) ListClientQuotas(context.Context, string) ([]models.ClientQuota, error) {
+	return nil, nil
+}
+
+func TestDispatcherCompositeKeys(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+	db := &fakeRepo{
+		client: &models.RateLimitClient{ClientID: "acme", Capacity: 2, Rate: 1, RatePeriod: models.Duration(time.Hour),
+			Tokens: 2, LastRefillAt: time.Now(), Status: models.ClientActive, Algorithm: models.AlgorithmTokenBucket},
+		lookups: make(map[string]int),
+	}
+	d := NewDispatcher(db, NewTokenBucket(db, logger, nil, nil), NewPolicies(db, logger), NewQuotas(db, logger), nil, logger)
+
+	tests := []struct {
+		name    string
+		req     Request
+		allowed bool
+		wantErr error
+	}{
+		{name: "first subnet", req: Request{ClientID: "acme", Key: "acme:203.0.113.0/24", Cost: 2}, allowed: true},
+		{name: "first subnet exhausted", req: Request{ClientID: "acme", Key: "acme:203.0.113.0/24"}},
+		{name: "second subnet has its own budget", req: Request{ClientID: "acme", Key: "acme:198.51.100.0/24", Cost: 2}, allowed: true},
+		{name: "client without key is counted separately", req: Request{ClientID: "acme", Cost: 2}, allowed: true},
+		{name: "unknown primary client", req: Request{ClientID: "other", Key: "other:203.0.113.0/24"}, wantErr: ErrUnknownClient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := d.Allow(context.Background(), tt.req)
+			if err != tt.wantErr {
+				t.Fatalf("Allow() error = %v, want %v", err, tt.wantErr)
+			}
+			if decision.Allowed != tt.allowed {
+				t.Errorf("Allowed = %v, want %v", decision.Allowed, tt.allowed)
+			}
+		})
+	}
+
+	if db.lookups["acme:203.0.113.0/24"] != 0 || db.lookups["acme:198.51.100.0/24"] != 0 {
+		t.Errorf("composite keys were looked up as client IDs: %v", db.lookups)
+	}
+
+	d.Invalidate("acme")
+	if len(d.clients) != 0 {
+		t.Errorf("Invalidate left %d limiters of the client", len(d.clients))
+	}
+}
+
+func TestDispatcherRefreshClients(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+	db := &fakeRepo{
+		client: &models.RateLimitClient{ClientID: "acme", Capacity: 10, Rate: 1, RatePeriod: models.Duration(time.Second),
+			Status: models.ClientActive, Algorithm: models.AlgorithmGCRA},
+		lookups: make(map[string]int),
+	}
+	d := NewDispatcher(db, NewTokenBucket(db, logger, nil, nil), NewPolicies(db, logger), NewQuotas(db, logger), nil, logger)
+	allow := func() error {
+		_, err := d.Allow(context.Background(), Request{ClientID: "acme", Key: "acme:203.0.113.0/24"})
+		return err
+	}
+
+	if err := allow(); err != nil {
+		t.Fatal(err)
+	}
+	// Клиента приостановили на другом инстансе: до обновления здесь действует закешированный статус.
+	db.client.Status = models.ClientSuspended
+	if err := allow(); err != nil {
+		t.Fatalf("before refresh: Allow() error = %v, want cached active status", err)
+	}
+	if err := d.RefreshClients(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := allow(); err != ErrClientSuspended {
+		t.Errorf("after refresh: Allow() error = %v, want ErrClientSuspended", err)
+	}
+
+	db.client.Status = models.ClientActive
+	expired := time.Now().Add(-time.Minute)
+	db.client.ExpiresAt = &expired
+	if err := d.RefreshClients(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := allow(); err != ErrClientExpired {
+		t.Errorf("after expiry change: Allow() error = %v, want ErrClientExpired", err)
+	}
+
+	db.client = &models.RateLimitClient{ClientID: "other"}
+	if err := d.RefreshClients(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := allow(); err != ErrUnknownClient {
+		t.Errorf("after delete: Allow() error = %v, want ErrUnknownClient", err)
+	}
+}
@@ -0,0 +1,71 @@
+package rate_limit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"load-balancer/internal/repo"
+)
+
+// Plans — следит за изменениями планов в БД и применяет их к клиентам в памяти лимитера. Изменения через админский
+// API применяются на этом инстансе сразу, на остальных — при очередном обновлении.
+type Plans struct {
+	repo       repo.Repository
+	dispatcher *Dispatcher
+	logger     *zap.SugaredLogger
+
+	mu      sync.Mutex
+	updated map[string]time.Time
+}
+
+// NewPlans — создаёт отслеживание планов для лимитера dispatcher; текущие версии планов загружаются вызовом Reload.
+func NewPlans(repo repo.Repository, dispatcher *Dispatcher, logger *zap.SugaredLogger) *Plans {
+	return &Plans{
+		repo:       repo,
+		dispatcher: dispatcher,
+		logger:     logger,
+	}
+}
+
+// Reload — перечитывает планы из БД и применяет к клиентам те, что изменились с прошлой загрузки. При первой загрузке
+// клиентов в памяти ещё нет, и версии планов только запоминаются.
+func (p *Plans) Reload(ctx context.Context) error {
+	plans, err := p.repo.ListPlans(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to load plans")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	updated := make(map[string]time.Time, len(plans))
+	for _, plan := range plans {
+		updated[plan.Name] = plan.UpdatedAt
+		if previous, ok := p.updated[plan.Name]; ok && !previous.Equal(plan.UpdatedAt) {
+			p.dispatcher.ApplyPlan(plan)
+			p.logger.Infow("applied rate limit plan change", "plan", plan.Name)
+		}
+	}
+	p.updated = updated
+	return nil
+}
+
+// StartRefresh — периодически перечитывает планы, чтобы изменения, сделанные на других инстансах, применялись и здесь.
+func (p *Plans) StartRefresh(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.Reload(ctx); err != nil {
+				p.logger.Errorw("failed to refresh rate limit plans", "error", err)
+			}
+		}
+	}
+}
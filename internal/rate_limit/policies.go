@@ -0,0 +1,114 @@
+package rate_limit
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"load-balancer/internal/models"
+	"load-balancer/internal/repo"
+)
+
+// Policies — политики лимитов по маршрутам, загруженные из БД. Изменения через админский API применяются на этом
+// инстансе сразу, на остальных — при очередном обновлении.
+type Policies struct {
+	repo   repo.Repository
+	logger *zap.SugaredLogger
+
+	mu       sync.RWMutex
+	policies []*models.RateLimitPolicy
+}
+
+// NewPolicies — создаёт пустой набор политик; политики загружаются вызовом Reload.
+func NewPolicies(repo repo.Repository, logger *zap.SugaredLogger) *Policies {
+	return &Policies{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Reload — перечитывает политики из БД. Неизменённые политики остаются теми же объектами, поэтому лимиты клиентов
+// по ним не сбрасываются.
+func (p *Policies) Reload(ctx context.Context) error {
+	loaded, err := p.repo.ListPolicies(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to load rate limit policies")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	current := make(map[string]*models.RateLimitPolicy, len(p.policies))
+	for _, policy := range p.policies {
+		current[policy.Name] = policy
+	}
+	for i, policy := range loaded {
+		if existing, ok := current[policy.Name]; ok && existing.UpdatedAt.Equal(policy.UpdatedAt) {
+			loaded[i] = existing
+		}
+	}
+	sort.SliceStable(loaded, func(i, j int) bool { return moreSpecific(loaded[i], loaded[j]) })
+	p.policies = loaded
+	return nil
+}
+
+// StartRefresh — периодически перечитывает политики, чтобы изменения, сделанные на других инстансах, применялись
+// и здесь.
+func (p *Policies) StartRefresh(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.Reload(ctx); err != nil {
+				p.logger.Errorw("failed to refresh rate limit policies", "error", err)
+			}
+		}
+	}
+}
+
+// Match — возвращает самую точную политику для запроса или nil, если ни одна не подходит.
+func (p *Policies) Match(method, path string) *models.RateLimitPolicy {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, policy := range p.policies {
+		if policy.Matches(method, path) {
+			return policy
+		}
+	}
+	return nil
+}
+
+// moreSpecific — порядок проверки политик: сначала точные пути, затем шаблоны, затем префиксы /**; среди них —
+// более длинные; при равных путях политика для конкретного метода раньше политики для любого метода.
+func moreSpecific(a, b *models.RateLimitPolicy) bool {
+	if ka, kb := patternKind(a.PathPattern), patternKind(b.PathPattern); ka != kb {
+		return ka < kb
+	}
+	if len(a.PathPattern) != len(b.PathPattern) {
+		return len(a.PathPattern) > len(b.PathPattern)
+	}
+	if (a.Method == "") != (b.Method == "") {
+		return a.Method != ""
+	}
+	return a.Name < b.Name
+}
+
+func patternKind(pattern string) int {
+	switch {
+	case strings.HasSuffix(pattern, "/**"):
+		return 2
+	case strings.ContainsAny(pattern, `*?[\`):
+		return 1
+	default:
+		return 0
+	}
+}
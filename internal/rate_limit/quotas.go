@@ -0,0 +1,299 @@
+package rate_limit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"load-balancer/internal/models"
+	"load-balancer/internal/repo"
+)
+
+// quotaNames — названия квот в сообщениях об ошибке.
+var quotaNames = map[string]string{
+	models.QuotaDay:   "daily",
+	models.QuotaWeek:  "weekly",
+	models.QuotaMonth: "monthly",
+}
+
+// QuotaExceededError — клиент израсходовал квоту за период; запросы снова пройдут с началом следующего окна.
+type QuotaExceededError struct {
+	Period string
+	Limit  int64
+	// Reset — через сколько начнётся следующее окно квоты.
+	Reset time.Duration
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s quota exceeded", quotaNames[e.Period])
+}
+
+// quotaCounter — счётчик квоты клиента в текущем окне.
+type quotaCounter struct {
+	period      string
+	limit       int64
+	loc         *time.Location
+	windowStart time.Time
+	windowEnd   time.Time
+	// used — расход окна в БД на момент последней синхронизации, в том числе других инстансов.
+	used int64
+	// pending — расход на этом инстансе, ещё не записанный в БД.
+	pending int64
+}
+
+// roll — начинает новое окно, если текущее закончилось. Незаписанный расход закончившегося окна отбрасывается: он
+// больше ни на что не влияет.
+func (c *quotaCounter) roll(now time.Time) {
+	if now.Before(c.windowEnd) {
+		return
+	}
+	c.windowStart, c.windowEnd = models.QuotaWindow(c.period, c.loc, now)
+	c.used, c.pending = 0, 0
+}
+
+// clientQuotas — квоты клиента, загруженные из БД. stale — квоты изменились через админский API и при следующем
+// запросе загружаются заново.
+type clientQuotas struct {
+	counters []*quotaCounter
+	stale    bool
+	lastSeen time.Time
+}
+
+// Quotas — квоты клиентов на день, неделю и месяц. Расход считается в памяти и периодически добавляется к счётчикам
+// в БД, откуда инстанс заодно получает расход остальных инстансов. Поэтому при нескольких инстансах квота может быть
+// превышена на то, что остальные израсходовали с последней синхронизации.
+type Quotas struct {
+	repo   repo.Repository
+	logger *zap.SugaredLogger
+
+	mu      sync.Mutex
+	clients map[string]*clientQuotas
+}
+
+// NewQuotas — создаёт учёт квот клиентов; квоты клиента загружаются из БД при его первом запросе.
+func NewQuotas(repo repo.Repository, logger *zap.SugaredLogger) *Quotas {
+	return &Quotas{
+		repo:    repo,
+		logger:  logger,
+		clients: make(map[string]*clientQuotas),
+	}
+}
+
+// take — списывает cost со всех квот клиента, если ни одна из них от этого не превышается, иначе возвращает
+// *QuotaExceededError по первой превышенной квоте и ничего не списывает.
+func (q *Quotas) take(ctx context.Context, clientID string, cost int64, now time.Time) error {
+	if err := q.load(ctx, clientID, now); err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	cq := q.clients[clientID]
+	if cq == nil {
+		return nil
+	}
+	for _, c := range cq.counters {
+		c.roll(now)
+		if c.used+c.pending+cost > c.limit {
+			return &QuotaExceededError{Period: c.period, Limit: c.limit, Reset: c.windowEnd.Sub(now)}
+		}
+	}
+	for _, c := range cq.counters {
+		c.pending += cost
+	}
+	return nil
+}
+
+// refund — возвращает в квоты cost, списанный take в момент takenAt, если запрос всё же не прошёл. В окна, начавшиеся
+// после takenAt, ничего не возвращается.
+func (q *Quotas) refund(clientID string, cost int64, takenAt time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	cq := q.clients[clientID]
+	if cq == nil {
+		return
+	}
+	for _, c := range cq.counters {
+		if !takenAt.Before(c.windowStart) {
+			c.pending -= cost
+		}
+	}
+}
+
+// charge — списывает cost со всех квот клиента без проверки, например за стоимость, которая стала известна после
+// ответа.
+func (q *Quotas) charge(ctx context.Context, clientID string, cost int64, now time.Time) error {
+	if err := q.load(ctx, clientID, now); err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	cq := q.clients[clientID]
+	if cq == nil {
+		return nil
+	}
+	for _, c := range cq.counters {
+		c.roll(now)
+		c.pending += cost
+	}
+	return nil
+}
+
+// load — загружает квоты клиента из БД, если их нет в памяти или они устарели. Загрузка идёт без блокировки, чтобы
+// запросы других клиентов не ждали БД. Незаписанный расход устаревших квот переносится в загруженные.
+func (q *Quotas) load(ctx context.Context, clientID string, now time.Time) error {
+	q.mu.Lock()
+	cq, ok := q.clients[clientID]
+	if ok {
+		cq.lastSeen = now
+	}
+	q.mu.Unlock()
+	if ok && !cq.stale {
+		return nil
+	}
+
+	defs, err := q.repo.ListClientQuotas(ctx, clientID)
+	if err != nil {
+		return errors.Wrap(err, "error getting client quotas")
+	}
+
+	loaded := &clientQuotas{lastSeen: now}
+	for _, def := range defs {
+		loc, err := time.LoadLocation(def.TimeZone)
+		if err != nil {
+			q.logger.Warnw("unknown quota time zone, using UTC", "clientID", clientID, "period", def.Period,
+				"timeZone", def.TimeZone)
+			loc = time.UTC
+		}
+		c := &quotaCounter{period: def.Period, limit: def.Limit, loc: loc}
+		c.windowStart, c.windowEnd = models.QuotaWindow(def.Period, loc, now)
+		if def.WindowStart.Equal(c.windowStart) {
+			c.used = def.Used
+		}
+		loaded.counters = append(loaded.counters, c)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	existing, ok := q.clients[clientID]
+	if ok && !existing.stale {
+		return nil
+	}
+	if ok {
+		for _, c := range loaded.counters {
+			if old := existing.counter(c.period); old != nil && old.windowStart.Equal(c.windowStart) {
+				c.pending = old.pending
+			}
+		}
+	}
+	q.clients[clientID] = loaded
+	return nil
+}
+
+// counter — счётчик квоты с периодом period или nil.
+func (cq *clientQuotas) counter(period string) *quotaCounter {
+	for _, c := range cq.counters {
+		if c.period == period {
+			return c
+		}
+	}
+	return nil
+}
+
+// invalidate — помечает квоты клиента устаревшими, чтобы следующий запрос загрузил их из БД, не теряя расход.
+func (q *Quotas) invalidate(clientID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if cq, ok := q.clients[clientID]; ok {
+		cq.stale = true
+	}
+}
+
+// cleanup — убирает из памяти квоты клиентов, которые давно не делали запросов и чей расход уже записан в БД.
+func (q *Quotas) cleanup(timeout time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for id, cq := range q.clients {
+		if time.Since(cq.lastSeen) <= timeout {
+			continue
+		}
+		synced := true
+		for _, c := range cq.counters {
+			synced = synced && c.pending == 0
+		}
+		if synced {
+			delete(q.clients, id)
+		}
+	}
+}
+
+// Sync — добавляет расход квот, накопленный на инстансе, к счётчикам в БД и обновляет общий расход. Если записать
+// не удалось, расход останется в памяти до следующей синхронизации.
+func (q *Quotas) Sync(ctx context.Context) error {
+	now := time.Now()
+
+	q.mu.Lock()
+	var (
+		usage   []models.QuotaUsage
+		windows []time.Time
+	)
+	for id, cq := range q.clients {
+		for _, c := range cq.counters {
+			c.roll(now)
+			usage = append(usage, models.QuotaUsage{ClientID: id, Period: c.period, WindowStart: c.windowStart, Delta: c.pending})
+			windows = append(windows, c.windowStart)
+		}
+	}
+	q.mu.Unlock()
+
+	if len(usage) == 0 {
+		return nil
+	}
+	if err := q.repo.AddQuotaUsage(ctx, usage); err != nil {
+		return errors.Wrap(err, "failed to sync quota usage")
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, u := range usage {
+		cq := q.clients[u.ClientID]
+		if cq == nil {
+			continue
+		}
+		c := cq.counter(u.Period)
+		if c == nil || !c.windowStart.Equal(windows[i]) {
+			continue
+		}
+		c.pending -= u.Delta
+		if u.WindowStart.Equal(c.windowStart) {
+			c.used = u.Used
+		}
+	}
+	return nil
+}
+
+// StartSync — периодически синхронизирует расход квот с БД.
+func (q *Quotas) StartSync(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := q.Sync(ctx); err != nil {
+				q.logger.Errorw("failed to sync quota usage", "error", err)
+			}
+		}
+	}
+}
@@ -7,65 +7,174 @@ import (
 
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"load-balancer/internal/metrics"
 	"load-balancer/internal/models"
 	"load-balancer/internal/repo"
 )
 
+// replenishBatchSize — сколько клиентов загружается из БД за раз при фоновом пополнении токенов.
+const replenishBatchSize = 500
+
 type TokenBucket struct {
 	repo    repo.Repository
 	mu      sync.Mutex
 	clients map[string]*models.RateLimitState
 	logger  *zap.SugaredLogger
+	metrics metrics.Recorder
+
+	// distributed — настройки распределённого режима; nil — состояние бакетов хранится в памяти инстанса.
+	distributed *DistributedConfig
+	leases      map[string]*lease
 }
 
-// NewTokenBucket — создаёт новый Token Bucket с подключением к репозиторию и логгером, инициализирует внутреннее хранилище клиентов.
-func NewTokenBucket(repo repo.Repository, logger *zap.SugaredLogger) *TokenBucket {
+// NewTokenBucket — создаёт новый Token Bucket с подключением к репозиторию, логгером и метриками, инициализирует
+// внутреннее хранилище клиентов. Если distributed задан, бакеты клиентов общие для всех инстансов и хранятся в БД.
+func NewTokenBucket(repo repo.Repository, logger *zap.SugaredLogger, recorder metrics.Recorder, distributed *DistributedConfig) *TokenBucket {
 	return &TokenBucket{
-		repo:    repo,
-		logger:  logger,
-		clients: make(map[string]*models.RateLimitState),
+		repo:        repo,
+		logger:      logger,
+		metrics:     recorder,
+		clients:     make(map[string]*models.RateLimitState),
+		distributed: distributed,
+		leases:      make(map[string]*lease),
+	}
+}
+
+// Allow — проверяет, есть ли у клиента токен для выполнения запроса, и списывает его.
+func (tb *TokenBucket) Allow(ctx context.Context, clientID string) (Decision, error) {
+	return tb.AllowN(ctx, clientID, 1)
+}
+
+// AllowN — проверяет, есть ли у клиента cost токенов для выполнения запроса, обновляет состояние bucket'а, загружает
+// данные из БД при необходимости. Приостановленному, отключённому и истёкшему клиенту возвращает ErrClientSuspended,
+// ErrClientDisabled и ErrClientExpired, не расходуя токены.
+func (tb *TokenBucket) AllowN(ctx context.Context, clientID string, cost int64) (Decision, error) {
+	if tb.distributed != nil {
+		return tb.allowShared(ctx, clientID, cost)
+	}
+
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := time.Now()
+	cl, err := tb.state(ctx, clientID)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	if err := checkLifecycle(cl.Status, cl.ExpiresAt, now); err != nil {
+		return Decision{}, err
+	}
+
+	refill(&cl.Tokens, &cl.LastRefillAt, cl.Capacity, cl.RatePerSecond, now)
+	cl.LastSeen = now
+
+	decision := takeTokens(&cl.Tokens, cl.Capacity, cl.RatePerSecond, cost)
+	if decision.Allowed {
+		cl.Dirty = true
 	}
+
+	return decision, nil
 }
 
-// Allow — проверяет, есть ли у клиента токены для выполнения запроса, обновляет состояние bucket'а, загружает данные
-// из БД при необходимости.
-func (tb *TokenBucket) Allow(ctx context.Context, clientID string) (bool, error) {
+// Charge — списывает с клиента cost токенов без проверки, например за стоимость запроса, которая стала известна
+// после ответа. Токенов может стать меньше нуля.
+func (tb *TokenBucket) Charge(ctx context.Context, clientID string, cost int64) error {
+	if tb.distributed != nil {
+		return tb.chargeShared(ctx, clientID, cost)
+	}
+
 	tb.mu.Lock()
 	defer tb.mu.Unlock()
 
-	now := time.Now().Unix()
+	cl, err := tb.state(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	refill(&cl.Tokens, &cl.LastRefillAt, cl.Capacity, cl.RatePerSecond, time.Now())
+	cl.Tokens -= float64(cost)
+	cl.Dirty = true
+	return nil
+}
+
+// Refund — возвращает клиенту cost токенов, списанных AllowN, если запрос всё же не выполнился. Лишние токены сверх
+// ёмкости отбрасываются при следующем пополнении.
+func (tb *TokenBucket) Refund(ctx context.Context, clientID string, cost int64) {
+	if err := tb.Charge(ctx, clientID, -cost); err != nil {
+		tb.logger.Warnw("failed to refund tokens", "clientID", clientID, "error", err)
+	}
+}
+
+// state — возвращает состояние клиента из памяти или загружает его из БД. Вызывается под tb.mu.
+func (tb *TokenBucket) state(ctx context.Context, clientID string) (*models.RateLimitState, error) {
 	cl, ok := tb.clients[clientID]
 
 	if !ok {
 		dbClient, err := tb.repo.GetClientByID(ctx, clientID)
+		if errors.Is(err, repo.ErrClientNotFound) {
+			return nil, ErrUnknownClient
+		}
 		if err != nil {
-			return false, errors.Wrap(err, "error getting client")
+			return nil, errors.Wrap(err, "error getting client")
 		}
 		cl = &models.RateLimitState{
 			ClientID:      dbClient.ClientID,
 			Capacity:      dbClient.Capacity,
-			RatePerSecond: dbClient.RatePerSecond,
+			Rate:          dbClient.Rate,
+			RatePeriod:    time.Duration(dbClient.RatePeriod),
+			RatePerSecond: models.RefillRate(dbClient.Rate, time.Duration(dbClient.RatePeriod)),
 			Tokens:        dbClient.Tokens,
 			LastRefillAt:  dbClient.LastRefillAt,
+			Status:        dbClient.Status,
+			ExpiresAt:     dbClient.ExpiresAt,
 			Dirty:         false,
+			Plan:          dbClient.Plan,
+			Overrides:     dbClient.Overrides,
 		}
 		tb.clients[clientID] = cl
 	}
+	return cl, nil
+}
 
-	interval := now - cl.LastRefillAt
-	newTokens := interval * cl.RatePerSecond
-	cl.Tokens = min(cl.Tokens+newTokens, cl.Capacity)
-	cl.LastRefillAt = now
-	cl.LastSeen = time.Now()
+// Invalidate — убирает клиента из памяти, чтобы следующий запрос загрузил его из БД заново. Вызывается после изменения
+// клиента через админский API, чтобы новые лимиты и статус применились сразу. Расход токенов, ещё не сохранённый
+// в БД, при этом теряется; его восполнит фоновое пополнение. В распределённом режиме аренда клиента считается
+// истёкшей: следующий запрос вернёт её остаток в БД и получит новые лимиты и статус.
+func (tb *TokenBucket) Invalidate(clientID string) {
+	tb.mu.Lock()
+	delete(tb.clients, clientID)
+	l, ok := tb.leases[clientID]
+	tb.mu.Unlock()
 
-	if cl.Tokens < 1 {
-		return false, nil
+	if ok {
+		l.mu.Lock()
+		l.validUntil = time.Time{}
+		l.mu.Unlock()
 	}
+}
 
-	cl.Tokens--
-	cl.Dirty = true
+// ApplyPlan — пересчитывает лимиты клиентов плана, загруженных в память, не сбрасывая их токены: токены начисляются
+// по старой скорости до текущего момента и урезаются до новой ёмкости. В распределённом режиме лимиты плана
+// применяются при следующем получении аренды, не позже чем через lease_ttl.
+func (tb *TokenBucket) ApplyPlan(plan *models.Plan) {
+	if tb.distributed != nil {
+		return
+	}
 
-	return true, nil
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := time.Now()
+	for _, state := range tb.clients {
+		if state.Plan != plan.Name {
+			continue
+		}
+		refill(&state.Tokens, &state.LastRefillAt, state.Capacity, state.RatePerSecond, now)
+		state.Capacity, state.Rate, state.RatePeriod, _ = plan.Limits(state.Overrides)
+		state.RatePerSecond = models.RefillRate(state.Rate, state.RatePeriod)
+		state.Tokens = min(state.Tokens, float64(state.Capacity))
+		state.Dirty = true
+	}
 }
 
 // StartBackgroundSync — запускает фоновую горутину, которая периодически сохраняет изменения по клиентам в БД.
@@ -82,11 +191,38 @@ func (tb *TokenBucket) StartBackgroundSync(ctx context.Context, repo repo.Reposi
 	}
 }
 
-// syncToDB — записывает в БД только изменённые (грязные) клиенты, помечая их как синхронизированные.
+// Sync — немедленно сохраняет в БД все несохранённые изменения. Используется для финальной синхронизации при остановке.
+// В распределённом режиме возвращает в БД токены всех аренд.
+func (tb *TokenBucket) Sync() {
+	if tb.distributed != nil {
+		start := time.Now()
+		err := tb.returnLeases(context.Background(), true)
+		tb.metrics.ObserveTokenBucketOperation(metrics.OperationSync, time.Since(start), err)
+		return
+	}
+	tb.syncToDB(tb.repo)
+}
+
+// syncToDB — записывает в БД токены только изменённых (грязных) клиентов, помечая их как синхронизированные. Лимиты
+// клиентов не записываются: их меняют только через админский API. В распределённом
+// режиме состояние бакетов уже в БД, и вместо записи в БД возвращаются токены истёкших аренд.
 func (tb *TokenBucket) syncToDB(repo repo.Repository) {
+	if tb.distributed != nil {
+		start := time.Now()
+		err := tb.returnLeases(context.Background(), false)
+		tb.metrics.ObserveTokenBucketOperation(metrics.OperationSync, time.Since(start), err)
+		return
+	}
+
 	tb.mu.Lock()
 	defer tb.mu.Unlock()
 
+	start := time.Now()
+	var syncErr error
+	defer func() {
+		tb.metrics.ObserveTokenBucketOperation(metrics.OperationSync, time.Since(start), syncErr)
+	}()
+
 	var toUpdate []*models.RateLimitState
 	for _, state := range tb.clients {
 		if state.Dirty {
@@ -96,15 +232,10 @@ func (tb *TokenBucket) syncToDB(repo repo.Repository) {
 	}
 
 	for _, state := range toUpdate {
-		err := repo.UpdateClient(context.Background(), models.RateLimitClient{
-			ClientID:      state.ClientID,
-			Capacity:      state.Capacity,
-			RatePerSecond: state.RatePerSecond,
-			Tokens:        state.Tokens,
-			LastRefillAt:  state.LastRefillAt,
-		})
+		err := repo.SaveClientTokens(context.Background(), state.ClientID, state.Tokens, state.LastRefillAt)
 		if err != nil {
 			state.Dirty = true
+			syncErr = err
 		}
 	}
 }
@@ -125,6 +256,11 @@ func (tb *TokenBucket) StartInactiveCleaner(ctx context.Context, inactiveTimeout
 
 // cleanupInactiveClients — удаляет из памяти клиентов, которые давно не делали запросов.
 func (tb *TokenBucket) cleanupInactiveClients(timeout time.Duration) {
+	if tb.distributed != nil {
+		tb.cleanupInactiveLeases(timeout)
+		return
+	}
+
 	tb.mu.Lock()
 	defer tb.mu.Unlock()
 
@@ -135,8 +271,13 @@ func (tb *TokenBucket) cleanupInactiveClients(timeout time.Duration) {
 	}
 }
 
-// ReplenishAll — фоновая задача, которая регулярно пополняет токены всех клиентов напрямую из БД.
+// ReplenishAll — фоновая задача, которая регулярно пополняет токены всех клиентов напрямую из БД. В распределённом
+// режиме не нужна: бакет пополняется в БД при каждом получении аренды.
 func (tb *TokenBucket) ReplenishAll(ctx context.Context, interval time.Duration) {
+	if tb.distributed != nil {
+		return
+	}
+
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
@@ -145,7 +286,10 @@ func (tb *TokenBucket) ReplenishAll(ctx context.Context, interval time.Duration)
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			if err := tb.replenishTick(ctx); err != nil {
+			start := time.Now()
+			err := tb.replenishTick(ctx)
+			tb.metrics.ObserveTokenBucketOperation(metrics.OperationReplenish, time.Since(start), err)
+			if err != nil {
 				tb.logger.Errorf("Error during token replenishment: %v", err)
 			}
 		}
@@ -153,25 +297,54 @@ func (tb *TokenBucket) ReplenishAll(ctx context.Context, interval time.Duration)
 }
 
 // replenishTick — выполняет одно пополнение токенов всех клиентов в БД, исходя из времени последнего пополнения.
+// Клиенты читаются пачками, чтобы не держать в памяти всю таблицу.
 func (tb *TokenBucket) replenishTick(ctx context.Context) error {
-	clients, err := tb.repo.GetAllClients(ctx)
+	now := time.Now()
+
+	err := tb.repo.ForEachClientBatch(ctx, replenishBatchSize, func(clients []*models.RateLimitClient) error {
+		for _, client := range clients {
+			rate := models.RefillRate(client.Rate, time.Duration(client.RatePeriod))
+			refill(&client.Tokens, &client.LastRefillAt, client.Capacity, rate, now)
+
+			if err := tb.repo.SaveClientTokens(ctx, client.ClientID, client.Tokens, client.LastRefillAt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return errors.Wrap(err, "failed to get all clients")
+		return errors.Wrap(err, "failed to replenish clients")
 	}
 
-	now := time.Now().Unix()
-
-	for _, client := range clients {
-		intervalSec := now - client.LastRefillAt
-		newTokens := intervalSec * client.RatePerSecond
+	return nil
+}
 
-		client.Tokens = min(client.Tokens+newTokens, client.Capacity)
-		client.LastRefillAt = now
+// refill — начисляет токены за время с последнего пополнения, не превышая ёмкость. Время считается с точностью до
+// наносекунды, а токены дробные, поэтому клиент получает токены равномерно, а не раз в секунду, и скорость может быть
+// меньше токена в секунду. Если часы ушли назад, токены не списываются.
+func refill(tokens *float64, lastRefillAt *time.Time, capacity int64, ratePerSecond float64, now time.Time) {
+	if elapsed := now.Sub(*lastRefillAt); elapsed > 0 {
+		*tokens = min(*tokens+elapsed.Seconds()*ratePerSecond, float64(capacity))
+	}
+	*lastRefillAt = now
+}
 
-		if err := tb.repo.UpdateClient(ctx, *client); err != nil {
-			return err
+// takeTokens — списывает cost токенов, если они есть, и возвращает решение с состоянием бакета после списания.
+// Запрос дороже ёмкости бакета не пройдёт никогда, поэтому время повтора для него не считается.
+func takeTokens(tokens *float64, capacity int64, ratePerSecond float64, cost int64) Decision {
+	decision := Decision{
+		Limit:  capacity,
+		Window: durationFor(float64(capacity), ratePerSecond),
+	}
+	if *tokens < float64(cost) {
+		if cost <= capacity {
+			decision.RetryAfter = durationFor(float64(cost)-*tokens, ratePerSecond)
 		}
+	} else {
+		decision.Allowed = true
+		*tokens -= float64(cost)
 	}
-
-	return nil
+	decision.Remaining = max(int64(*tokens), 0)
+	decision.Reset = durationFor(float64(capacity)-*tokens, ratePerSecond)
+	return decision
 }
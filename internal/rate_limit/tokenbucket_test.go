@@ -0,0 +1,107 @@
+package rate_limit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRefill(t *testing.T) {
+	tests := []struct {
+		name     string
+		tokens   float64
+		capacity int64
+		rate     float64
+		elapsed  time.Duration
+		want     float64
+	}{
+		{name: "no time passed", tokens: 1.5, capacity: 10, rate: 2, elapsed: 0, want: 1.5},
+		{name: "sub-second at 1 rps", tokens: 0, capacity: 10, rate: 1, elapsed: 250 * time.Millisecond, want: 0.25},
+		{name: "sub-second at fractional rate", tokens: 0, capacity: 10, rate: 0.5, elapsed: 500 * time.Millisecond, want: 0.25},
+		{name: "fraction accumulates", tokens: 0.75, capacity: 10, rate: 1, elapsed: 250 * time.Millisecond, want: 1},
+		{name: "high rate in milliseconds", tokens: 0, capacity: 100, rate: 1000, elapsed: 3 * time.Millisecond, want: 3},
+		{name: "clamped to capacity", tokens: 9.5, capacity: 10, rate: 4, elapsed: time.Second, want: 10},
+		{name: "debt is paid off", tokens: -2, capacity: 10, rate: 4, elapsed: 250 * time.Millisecond, want: -1},
+		{name: "clock went back", tokens: 3, capacity: 10, rate: 1, elapsed: -time.Second, want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, last := tt.tokens, t0
+			now := t0.Add(tt.elapsed)
+			refill(&tokens, &last, tt.capacity, tt.rate, now)
+			if tokens != tt.want {
+				t.Errorf("tokens = %v, want %v", tokens, tt.want)
+			}
+			if !last.Equal(now) {
+				t.Errorf("lastRefillAt = %v, want %v", last, now)
+			}
+		})
+	}
+}
+
+// TestRefillSubSecondSteps — частые пополнения долями секунды дают столько же токенов, сколько одно за всё время.
+func TestRefillSubSecondSteps(t *testing.T) {
+	tokens, last := 0.0, t0
+	for i := 1; i <= 8; i++ {
+		refill(&tokens, &last, 10, 2, t0.Add(time.Duration(i)*125*time.Millisecond))
+	}
+	if tokens != 2 {
+		t.Errorf("tokens = %v, want 2", tokens)
+	}
+}
+
+func TestTakeTokens(t *testing.T) {
+	tests := []struct {
+		name       string
+		tokens     float64
+		capacity   int64
+		rate       float64
+		cost       int64
+		want       Decision
+		wantTokens float64
+	}{
+		{
+			name: "enough tokens", tokens: 5, capacity: 10, rate: 2, cost: 1,
+			want:       Decision{Allowed: true, Limit: 10, Remaining: 4, Window: 5 * time.Second, Reset: 3 * time.Second},
+			wantTokens: 4,
+		},
+		{
+			name: "fraction left over", tokens: 1.5, capacity: 10, rate: 2, cost: 1,
+			want:       Decision{Allowed: true, Limit: 10, Remaining: 0, Window: 5 * time.Second, Reset: 4750 * time.Millisecond},
+			wantTokens: 0.5,
+		},
+		{
+			name: "short by a fraction", tokens: 0.75, capacity: 10, rate: 1, cost: 1,
+			want:       Decision{Limit: 10, Remaining: 0, Window: 10 * time.Second, Reset: 9250 * time.Millisecond, RetryAfter: 250 * time.Millisecond},
+			wantTokens: 0.75,
+		},
+		{
+			name: "sub-second retry at high rate", tokens: 0, capacity: 100, rate: 1000, cost: 5,
+			want:       Decision{Limit: 100, Remaining: 0, Window: 100 * time.Millisecond, Reset: 100 * time.Millisecond, RetryAfter: 5 * time.Millisecond},
+			wantTokens: 0,
+		},
+		{
+			name: "in debt after charge", tokens: -1, capacity: 4, rate: 2, cost: 1,
+			want:       Decision{Limit: 4, Remaining: 0, Window: 2 * time.Second, Reset: 2500 * time.Millisecond, RetryAfter: time.Second},
+			wantTokens: -1,
+		},
+		{
+			name: "cost above capacity never passes", tokens: 4, capacity: 4, rate: 2, cost: 5,
+			want:       Decision{Limit: 4, Remaining: 4, Window: 2 * time.Second, Reset: 0},
+			wantTokens: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := tt.tokens
+			got := takeTokens(&tokens, tt.capacity, tt.rate, tt.cost)
+			if got != tt.want {
+				t.Errorf("takeTokens() = %+v, want %+v", got, tt.want)
+			}
+			if tokens != tt.wantTokens {
+				t.Errorf("tokens = %v, want %v", tokens, tt.wantTokens)
+			}
+		})
+	}
+}
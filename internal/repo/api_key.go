@@ -0,0 +1,148 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+
+	m "load-balancer/internal/models"
+)
+
+const (
+	createAPIKeyQuery  = `INSERT INTO api_keys (prefix, client_id, key_hash, created_at, expires_at) VALUES ($1, $2, $3, $4, $5)`
+	getAPIKeyQuery     = `SELECT prefix, client_id, key_hash, created_at, expires_at, revoked_at FROM api_keys WHERE prefix = $1`
+	listAPIKeysQuery   = `SELECT prefix, client_id, key_hash, created_at, expires_at, revoked_at FROM api_keys WHERE client_id = $1 ORDER BY created_at`
+	revokeAPIKeyQuery  = `UPDATE api_keys SET revoked_at = now() WHERE client_id = $1 AND prefix = $2 AND revoked_at IS NULL`
+	expireAPIKeysQuery = `UPDATE api_keys SET expires_at = LEAST(COALESCE(expires_at, $2), $2) WHERE client_id = $1 AND revoked_at IS NULL`
+)
+
+// foreignKeyViolation — код ошибки PostgreSQL при нарушении внешнего ключа.
+const foreignKeyViolation = "23503"
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// CreateClientWithKey — создаёт клиента вместе с его первым API-ключом в одной транзакции.
+func (r *repository) CreateClientWithKey(ctx context.Context, client m.RateLimitClient, key m.APIKey) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, createClientQuery, createClientArgs(client)...); err != nil {
+		return errors.Wrap(err, "failed to create client")
+	}
+	if err := insertAPIKey(ctx, tx, key); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit client creation")
+	}
+	return nil
+}
+
+// CreateAPIKey — сохраняет дополнительный API-ключ клиента. Если клиента нет, возвращает ErrClientNotFound.
+func (r *repository) CreateAPIKey(ctx context.Context, key m.APIKey) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err := insertAPIKey(ctx, tx, key); err != nil {
+		return err
+	}
+	return errors.Wrap(tx.Commit(ctx), "failed to commit api key")
+}
+
+// RotateAPIKey — выдаёт клиенту новый ключ и назначает всем его действующим ключам срок действия graceUntil. Ключи,
+// которые истекают раньше, свой срок сохраняют. Если клиента нет, возвращает ErrClientNotFound.
+func (r *repository) RotateAPIKey(ctx context.Context, key m.APIKey, graceUntil time.Time) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, expireAPIKeysQuery, key.ClientID, graceUntil); err != nil {
+		return errors.Wrap(err, "failed to expire api keys")
+	}
+	if err := insertAPIKey(ctx, tx, key); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit api key rotation")
+	}
+	return nil
+}
+
+// GetAPIKey — возвращает ключ по префиксу или nil, если такого ключа нет.
+func (r *repository) GetAPIKey(ctx context.Context, prefix string) (*m.APIKey, error) {
+	key, err := scanAPIKey(r.pool.QueryRow(ctx, getAPIKeyQuery, prefix))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query api key")
+	}
+	return key, nil
+}
+
+// ListAPIKeys — возвращает все ключи клиента, включая отозванные и истёкшие, от старых к новым.
+func (r *repository) ListAPIKeys(ctx context.Context, clientID string) ([]*m.APIKey, error) {
+	rows, err := r.pool.Query(ctx, listAPIKeysQuery, clientID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query api keys")
+	}
+	defer rows.Close()
+
+	var keys []*m.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows iteration error")
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey — немедленно отзывает ключ клиента. Если действующего ключа с таким префиксом у клиента нет,
+// возвращает ErrAPIKeyNotFound.
+func (r *repository) RevokeAPIKey(ctx context.Context, clientID, prefix string) error {
+	commandTag, err := r.pool.Exec(ctx, revokeAPIKeyQuery, clientID, prefix)
+	if err != nil {
+		return errors.Wrap(err, "failed to revoke api key")
+	}
+	if commandTag.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func insertAPIKey(ctx context.Context, tx pgx.Tx, key m.APIKey) error {
+	if _, err := tx.Exec(ctx, createAPIKeyQuery, key.Prefix, key.ClientID, key.Hash, key.CreatedAt, key.ExpiresAt); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+			return ErrClientNotFound
+		}
+		return errors.Wrap(err, "failed to create api key")
+	}
+	return nil
+}
+
+func scanAPIKey(row pgx.Row) (*m.APIKey, error) {
+	var key m.APIKey
+	if err := row.Scan(&key.Prefix, &key.ClientID, &key.Hash, &key.CreatedAt, &key.ExpiresAt, &key.RevokedAt); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
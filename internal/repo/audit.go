@@ -0,0 +1,105 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	m "load-balancer/internal/models"
+)
+
+const (
+	createAuditRecordQuery = `INSERT INTO audit_log (actor, action, target_type, target, before, after, source_ip) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	listAuditRecordsQuery  = `SELECT id, occurred_at, actor, action, target_type, target, before, after, source_ip FROM audit_log`
+)
+
+// CreateAuditRecord — сохраняет запись журнала изменений. Время записи проставляет БД.
+func (r *repository) CreateAuditRecord(ctx context.Context, record m.AuditRecord) error {
+	_, err := r.pool.Exec(ctx, createAuditRecordQuery, record.Actor, record.Action, record.TargetType, record.Target,
+		nullableJSON(record.Before), nullableJSON(record.After), record.SourceIP)
+	if err != nil {
+		return errors.Wrap(err, "failed to create audit record")
+	}
+	return nil
+}
+
+// ListAuditRecords — возвращает записи журнала, подходящие под фильтр, от новых к старым.
+func (r *repository) ListAuditRecords(ctx context.Context, filter m.AuditFilter) ([]*m.AuditRecord, error) {
+	var (
+		conditions []string
+		args       []any
+	)
+	addCondition := func(expr string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
+
+	if filter.Actor != "" {
+		addCondition("actor = $%d", filter.Actor)
+	}
+	if filter.Action != "" {
+		addCondition("action = $%d", filter.Action)
+	}
+	if filter.TargetType != "" {
+		addCondition("target_type = $%d", filter.TargetType)
+	}
+	if filter.Target != "" {
+		addCondition("target = $%d", filter.Target)
+	}
+	if !filter.From.IsZero() {
+		addCondition("occurred_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("occurred_at < $%d", filter.To)
+	}
+	if filter.BeforeID > 0 {
+		addCondition("id < $%d", filter.BeforeID)
+	}
+
+	query := listAuditRecordsQuery
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query audit records")
+	}
+	defer rows.Close()
+
+	var records []*m.AuditRecord
+	for rows.Next() {
+		var record m.AuditRecord
+		if err := rows.Scan(
+			&record.ID,
+			&record.Time,
+			&record.Actor,
+			&record.Action,
+			&record.TargetType,
+			&record.Target,
+			&record.Before,
+			&record.After,
+			&record.SourceIP,
+		); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		records = append(records, &record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows iteration error")
+	}
+
+	return records, nil
+}
+
+// nullableJSON — превращает пустой JSON в NULL, чтобы отсутствующее состояние «до» или «после» хранилось как NULL.
+func nullableJSON(data []byte) any {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
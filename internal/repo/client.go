@@ -2,6 +2,10 @@ package repo
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/jackc/pgx/v5"
 	"github.com/pkg/errors"
 
@@ -9,37 +13,80 @@ import (
 )
 
 const (
-	createClientQuery  = `INSERT INTO clients (client_id, capacity, rate_per_second, tokens, last_refill_at) VALUES ($1, $2, $3, $4, $5)`
-	getClientQuery     = `SELECT capacity, rate_per_second, tokens, last_refill_at FROM clients WHERE client_id = $1`
-	updateClientQuery  = `UPDATE clients SET capacity = $2, rate_per_second = $3, tokens = $4, last_refill_at = $5 WHERE client_id = $1`
-	deleteClientQuery  = `DELETE FROM clients WHERE client_id = $1`
-	getAllClientsQuery = `SELECT client_id, capacity, rate_per_second, tokens, last_refill_at FROM clients`
+	createClientQuery = `INSERT INTO clients (client_id, capacity, rate, rate_period_ms, tokens, last_refill_at, labels, status, expires_at, algorithm, plan) VALUES ($1, $2, $3, $4, $5, $6, COALESCE($7, '{}'::jsonb), $8, $9, $10, $11)`
+	getClientQuery    = `SELECT client_id, capacity, rate, rate_period_ms, rate_per_second, tokens, last_refill_at, labels, status, expires_at, algorithm, plan, capacity_override, rate_override, rate_period_ms_override, algorithm_override FROM client_limits WHERE client_id = $1`
+	// updateClientQuery — у клиента без плана ($9) пустой алгоритм ($8) оставляет текущий, у клиента плана NULL
+	// в лимитах означает значение плана.
+	updateClientQuery = `UPDATE clients SET capacity = $2, rate = $3, rate_period_ms = $4, tokens = $5, last_refill_at = $6, labels = COALESCE($7, labels), algorithm = CASE WHEN $9::text IS NULL THEN COALESCE($8, algorithm) ELSE $8 END, plan = $9 WHERE client_id = $1`
+	saveTokensQuery   = `UPDATE clients SET tokens = $2, last_refill_at = $3 WHERE client_id = $1`
+	deleteClientQuery = `DELETE FROM clients WHERE client_id = $1`
+	listClientsQuery  = `SELECT client_id, capacity, rate, rate_period_ms, rate_per_second, tokens, last_refill_at, labels, status, expires_at, algorithm, plan, capacity_override, rate_override, rate_period_ms_override, algorithm_override FROM client_limits`
+	lifecycleQuery    = `UPDATE clients SET status = $2, expires_at = $3 WHERE client_id = $1`
+	countClientsQuery = `SELECT count(*) FROM client_limits`
+	// takeTokensQuery — под блокировкой строки начисляет клиенту токены за время с последнего пополнения, добавляет
+	// к ним $4 и, если токенов не меньше $3, выдаёт от $3 до $2 токенов. Лимиты клиента плана берутся из плана,
+	// если клиент их не переопределил.
+	takeTokensQuery = `WITH limits AS (
+	SELECT c.client_id, c.tokens, c.last_refill_at,
+		COALESCE(c.capacity, p.capacity) AS capacity,
+		COALESCE(c.rate, p.rate) AS rate,
+		COALESCE(c.rate_period_ms, p.rate_period_ms) AS rate_period_ms
+	FROM clients c LEFT JOIN plans p ON p.name = c.plan
+	WHERE c.client_id = $1 FOR UPDATE OF c
+), refilled AS (
+	SELECT client_id, capacity, rate, rate_period_ms, now() AS refilled_at,
+		LEAST(capacity::double precision,
+			tokens + GREATEST(EXTRACT(EPOCH FROM now() - last_refill_at)::double precision, 0) * rate * 1000.0 / rate_period_ms + $4::double precision) AS tokens
+	FROM limits
+), granted AS (
+	SELECT client_id, capacity, rate, rate_period_ms, refilled_at, tokens,
+		CASE WHEN tokens >= $3::bigint THEN GREATEST(LEAST(FLOOR(tokens), $2::bigint), $3::bigint) ELSE 0 END AS granted
+	FROM refilled
+)
+UPDATE clients c SET tokens = g.tokens - g.granted, last_refill_at = g.refilled_at
+FROM granted g WHERE c.client_id = g.client_id
+RETURNING g.granted::bigint, c.tokens, g.capacity, g.rate, g.rate_period_ms, c.status, c.expires_at`
 )
 
+var ErrClientNotFound = errors.New("client not found")
+
+// clientSortColumns — поля сортировки и соответствующие им колонки. Колонки подставляются в запрос как есть, поэтому
+// принимаются только поля из этого списка.
+var clientSortColumns = map[string]string{
+	m.ClientSortID:       "client_id",
+	m.ClientSortCapacity: "capacity",
+	m.ClientSortRate:     "rate_per_second",
+	m.ClientSortTokens:   "tokens",
+}
+
 // CreateClient — добавляет нового клиента в БД с заданными лимитами и состоянием токенов.
 func (r *repository) CreateClient(ctx context.Context, client m.RateLimitClient) error {
-	_, err := r.pool.Exec(ctx, createClientQuery, client.ClientID, client.Capacity, client.RatePerSecond, client.Tokens, client.LastRefillAt)
+	_, err := r.pool.Exec(ctx, createClientQuery, createClientArgs(client)...)
 	if err != nil {
 		return errors.Wrap(err, "failed to create client")
 	}
 	return nil
 }
 
-// GetClientByID — получает данные клиента по ID из БД, возвращает ошибку, если клиент не найден.
+// GetClientByID — получает данные клиента по ID из БД. Если клиента нет, возвращает ErrClientNotFound.
 func (r *repository) GetClientByID(ctx context.Context, id string) (*m.RateLimitClient, error) {
-	client := &m.RateLimitClient{ClientID: id}
-	err := r.pool.QueryRow(ctx, getClientQuery, id).Scan(&client.Capacity, &client.RatePerSecond, &client.Tokens, &client.LastRefillAt)
+	client, err := scanClient(r.pool.QueryRow(ctx, getClientQuery, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrClientNotFound
+	}
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, errors.Wrap(err, "failed to query client")
-		}
+		return nil, errors.Wrap(err, "failed to query client")
 	}
 	return client, nil
 }
 
-// UpdateClient — обновляет данные клиента в БД, проверяет, была ли затронута хотя бы одна строка.
+// UpdateClient — обновляет данные клиента в БД, проверяет, была ли затронута хотя бы одна строка. Если Labels равен
+// nil, метки клиента не меняются. У клиента без плана пустой Algorithm не меняет алгоритм; у клиента плана
+// записываются план и переопределения Overrides, а не действующие лимиты.
 func (r *repository) UpdateClient(ctx context.Context, client m.RateLimitClient) error {
-	commandTag, err := r.pool.Exec(ctx, updateClientQuery, client.ClientID, client.Capacity, client.RatePerSecond, client.Tokens, client.LastRefillAt)
+	capacity, rate, period, algorithm := limitArgs(client)
+	commandTag, err := r.pool.Exec(ctx, updateClientQuery, client.ClientID, capacity, rate, period,
+		client.Tokens, client.LastRefillAt, nullableLabels(client.Labels), algorithm, nullableString(client.Plan))
 	if err != nil {
 		return errors.Wrap(err, "failed to update client")
 	}
@@ -51,6 +98,19 @@ func (r *repository) UpdateClient(ctx context.Context, client m.RateLimitClient)
 	return nil
 }
 
+// SaveClientTokens — сохраняет только состояние токенов клиента, не трогая его лимиты и план. Если клиента нет,
+// возвращает ErrClientNotFound.
+func (r *repository) SaveClientTokens(ctx context.Context, id string, tokens float64, lastRefillAt time.Time) error {
+	commandTag, err := r.pool.Exec(ctx, saveTokensQuery, id, tokens, lastRefillAt)
+	if err != nil {
+		return errors.Wrap(err, "failed to save client tokens")
+	}
+	if commandTag.RowsAffected() == 0 {
+		return ErrClientNotFound
+	}
+	return nil
+}
+
 // DeleteClient — удаляет клиента из БД, возвращает ошибку, если запись не найдена.
 func (r *repository) DeleteClient(ctx context.Context, id string) error {
 	commandTag, err := r.pool.Exec(ctx, deleteClientQuery, id)
@@ -65,27 +125,60 @@ func (r *repository) DeleteClient(ctx context.Context, id string) error {
 	return nil
 }
 
-// GetAllClients — возвращает список всех клиентов из БД, используется для фонового пополнения токенов.
-func (r *repository) GetAllClients(ctx context.Context) ([]*m.RateLimitClient, error) {
-	rows, err := r.pool.Query(ctx, getAllClientsQuery)
+// SetClientLifecycle — меняет статус клиента и срок его действия. expiresAt, равный nil, снимает ограничение срока.
+func (r *repository) SetClientLifecycle(ctx context.Context, id, status string, expiresAt *time.Time) error {
+	commandTag, err := r.pool.Exec(ctx, lifecycleQuery, id, status, expiresAt)
+	if err != nil {
+		return errors.Wrap(err, "failed to update client status")
+	}
+	if commandTag.RowsAffected() == 0 {
+		return ErrClientNotFound
+	}
+	return nil
+}
+
+// TakeTokens — атомарно пополняет бакет клиента в БД, добавляет к нему adjust (возврат неизрасходованных токенов
+// или долг за уже выполненные запросы) и, если в бакете не меньше need токенов, забирает из него до want токенов.
+// Так несколько инстансов делят один бакет, не перезаписывая изменения друг друга.
+func (r *repository) TakeTokens(ctx context.Context, id string, want, need int64, adjust float64) (*m.TokenGrant, error) {
+	var (
+		grant    m.TokenGrant
+		periodMs int64
+	)
+	err := r.pool.QueryRow(ctx, takeTokensQuery, id, want, need, adjust).Scan(&grant.Granted, &grant.Tokens, &grant.Capacity,
+		&grant.Rate, &periodMs, &grant.Status, &grant.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrClientNotFound
+	}
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to query all clients")
+		return nil, errors.Wrap(err, "failed to take tokens")
+	}
+	grant.RatePeriod = time.Duration(periodMs) * time.Millisecond
+	return &grant, nil
+}
+
+// ListClients — возвращает страницу клиентов, подходящих под фильтр. Страницы строятся по курсору (значение поля
+// сортировки и ID последнего клиента предыдущей страницы), поэтому выдача не сбивается при вставке и удалении клиентов
+// и не требует OFFSET.
+func (r *repository) ListClients(ctx context.Context, filter m.ClientFilter, page m.ClientPage) ([]*m.RateLimitClient, error) {
+	query, args, err := listClientsSQL(filter, page)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query clients")
 	}
 	defer rows.Close()
 
 	var clients []*m.RateLimitClient
 	for rows.Next() {
-		var client m.RateLimitClient
-		if err := rows.Scan(
-			&client.ClientID,
-			&client.Capacity,
-			&client.RatePerSecond,
-			&client.Tokens,
-			&client.LastRefillAt,
-		); err != nil {
+		client, err := scanClient(rows)
+		if err != nil {
 			return nil, errors.Wrap(err, "failed to scan row")
 		}
-		clients = append(clients, &client)
+		clients = append(clients, client)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, errors.Wrap(err, "rows iteration error")
@@ -93,3 +186,224 @@ func (r *repository) GetAllClients(ctx context.Context) ([]*m.RateLimitClient, e
 
 	return clients, nil
 }
+
+// CountClients — возвращает число клиентов, подходящих под фильтр.
+func (r *repository) CountClients(ctx context.Context, filter m.ClientFilter) (int64, error) {
+	conditions, args := clientFilterConditions(filter)
+
+	var count int64
+	if err := r.pool.QueryRow(ctx, countClientsQuery+whereClause(conditions), args...).Scan(&count); err != nil {
+		return 0, errors.Wrap(err, "failed to count clients")
+	}
+	return count, nil
+}
+
+// ForEachClientBatch — обходит всех клиентов пачками по batchSize в порядке ID и вызывает fn для каждой пачки. В памяти
+// одновременно находится только одна пачка, поэтому фоновые задачи не загружают таблицу целиком.
+func (r *repository) ForEachClientBatch(ctx context.Context, batchSize int, fn func([]*m.RateLimitClient) error) error {
+	page := m.ClientPage{SortBy: m.ClientSortID, Limit: batchSize}
+	for {
+		clients, err := r.ListClients(ctx, m.ClientFilter{}, page)
+		if err != nil {
+			return err
+		}
+		if len(clients) == 0 {
+			return nil
+		}
+		if err := fn(clients); err != nil {
+			return err
+		}
+		if len(clients) < batchSize {
+			return nil
+		}
+		page.HasCursor = true
+		page.AfterID = clients[len(clients)-1].ClientID
+	}
+}
+
+// listClientsSQL — собирает запрос страницы клиентов: фильтр, продолжение после курсора, сортировку и лимит.
+func listClientsSQL(filter m.ClientFilter, page m.ClientPage) (string, []any, error) {
+	column, ok := clientSortColumns[page.SortBy]
+	if !ok {
+		return "", nil, errors.Errorf("unknown sort field %q", page.SortBy)
+	}
+
+	conditions, args := clientFilterConditions(filter)
+
+	direction, comparison := "ASC", ">"
+	if page.Desc {
+		direction, comparison = "DESC", "<"
+	}
+	if page.HasCursor {
+		if column == "client_id" {
+			args = append(args, page.AfterID)
+			conditions = append(conditions, fmt.Sprintf("client_id %s $%d", comparison, len(args)))
+		} else {
+			args = append(args, page.AfterValue, page.AfterID)
+			conditions = append(conditions, fmt.Sprintf("(%s, client_id) %s ($%d, $%d)", column, comparison, len(args)-1, len(args)))
+		}
+	}
+
+	query := listClientsQuery + whereClause(conditions)
+	if column == "client_id" {
+		query += fmt.Sprintf(" ORDER BY client_id %s", direction)
+	} else {
+		query += fmt.Sprintf(" ORDER BY %s %s, client_id %s", column, direction, direction)
+	}
+	args = append(args, page.Limit)
+	query += fmt.Sprintf(" LIMIT $%d", len(args))
+	return query, args, nil
+}
+
+// clientFilterConditions — переводит фильтр в условия WHERE с позиционными параметрами.
+func clientFilterConditions(filter m.ClientFilter) ([]string, []any) {
+	var (
+		conditions []string
+		args       []any
+	)
+	addCondition := func(expr string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
+
+	if filter.IDPrefix != "" {
+		addCondition(`client_id LIKE $%d ESCAPE '\'`, likePrefix(filter.IDPrefix))
+	}
+	if filter.MinCapacity != nil {
+		addCondition("capacity >= $%d", *filter.MinCapacity)
+	}
+	if filter.MaxCapacity != nil {
+		addCondition("capacity <= $%d", *filter.MaxCapacity)
+	}
+	if filter.MinRate != nil {
+		addCondition("rate_per_second >= $%d", *filter.MinRate)
+	}
+	if filter.MaxRate != nil {
+		addCondition("rate_per_second <= $%d", *filter.MaxRate)
+	}
+	if len(filter.Labels) > 0 {
+		addCondition("labels @> $%d", filter.Labels)
+	}
+	if filter.Status != "" {
+		addCondition("status = $%d", filter.Status)
+	}
+	if filter.Plan != "" {
+		addCondition("plan = $%d", filter.Plan)
+	}
+
+	return conditions, args
+}
+
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// likePrefix — экранирует спецсимволы LIKE, чтобы префикс сравнивался буквально.
+func likePrefix(prefix string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return replacer.Replace(prefix) + "%"
+}
+
+// createClientArgs — параметры запроса создания клиента. Клиент без статуса создаётся активным, клиент без плана
+// и алгоритма — с токен-бакетом.
+func createClientArgs(client m.RateLimitClient) []any {
+	status := client.Status
+	if status == "" {
+		status = m.ClientActive
+	}
+	if client.Plan == "" && client.Algorithm == "" {
+		client.Algorithm = m.AlgorithmTokenBucket
+	}
+	capacity, rate, period, algorithm := limitArgs(client)
+	return []any{client.ClientID, capacity, rate, period, client.Tokens, client.LastRefillAt,
+		nullableLabels(client.Labels), status, client.ExpiresAt, algorithm, nullableString(client.Plan)}
+}
+
+// limitArgs — значения колонок лимитов клиента: собственные лимиты клиента без плана или переопределения клиента
+// плана, где NULL означает значение плана.
+func limitArgs(client m.RateLimitClient) (capacity, rate, period, algorithm any) {
+	if client.Plan == "" {
+		return client.Capacity, client.Rate, periodMillis(client.RatePeriod), nullableString(client.Algorithm)
+	}
+	o := client.Overrides
+	if o == nil {
+		return nil, nil, nil, nil
+	}
+	if o.Capacity != nil {
+		capacity = *o.Capacity
+	}
+	if o.Rate != nil && o.RatePeriod != nil {
+		rate, period = *o.Rate, periodMillis(*o.RatePeriod)
+	}
+	if o.Algorithm != nil {
+		algorithm = *o.Algorithm
+	}
+	return capacity, rate, period, algorithm
+}
+
+// scanClient — читает клиента из строки с колонками listClientsQuery.
+func scanClient(row pgx.Row) (*m.RateLimitClient, error) {
+	var (
+		client     m.RateLimitClient
+		periodMs   int64
+		plan       *string
+		overrides  m.LimitOverrides
+		overrideMs *int64
+	)
+	if err := row.Scan(
+		&client.ClientID,
+		&client.Capacity,
+		&client.Rate,
+		&periodMs,
+		&client.RatePerSecond,
+		&client.Tokens,
+		&client.LastRefillAt,
+		&client.Labels,
+		&client.Status,
+		&client.ExpiresAt,
+		&client.Algorithm,
+		&plan,
+		&overrides.Capacity,
+		&overrides.Rate,
+		&overrideMs,
+		&overrides.Algorithm,
+	); err != nil {
+		return nil, err
+	}
+	client.RatePeriod = m.Duration(time.Duration(periodMs) * time.Millisecond)
+	if plan != nil {
+		client.Plan = *plan
+		if overrideMs != nil {
+			period := m.Duration(time.Duration(*overrideMs) * time.Millisecond)
+			overrides.RatePeriod = &period
+		}
+		if !overrides.Empty() {
+			client.Overrides = &overrides
+		}
+	}
+	return &client, nil
+}
+
+// periodMillis — период пополнения в миллисекундах, как он хранится в БД.
+func periodMillis(period m.Duration) int64 {
+	return time.Duration(period).Milliseconds()
+}
+
+// nullableString — передаёт пустую строку как NULL.
+func nullableString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// nullableLabels — передаёт отсутствующие метки как NULL, чтобы запрос оставил текущие метки без изменений.
+func nullableLabels(labels map[string]string) any {
+	if labels == nil {
+		return nil
+	}
+	return labels
+}
@@ -0,0 +1,151 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	m "load-balancer/internal/models"
+)
+
+const (
+	clientsByIDsQuery = listClientsQuery + ` WHERE client_id = ANY($1)`
+	// upsertClientQuery — создаёт клиента или обновляет лимиты и метки существующего. Токены существующего клиента
+	// перезаписываются, только если они заданы в файле ($8), иначе лишь урезаются до новой ёмкости.
+	upsertClientQuery = `INSERT INTO clients (client_id, capacity, rate, rate_period_ms, tokens, last_refill_at, labels, algorithm)
+VALUES ($1, $2, $3, $4, $5, $6, COALESCE($7, '{}'::jsonb), COALESCE(NULLIF($9, ''), 'token_bucket'))
+ON CONFLICT (client_id) DO UPDATE SET
+	capacity = EXCLUDED.capacity,
+	rate = EXCLUDED.rate,
+	rate_period_ms = EXCLUDED.rate_period_ms,
+	tokens = CASE WHEN $8 THEN EXCLUDED.tokens ELSE LEAST(clients.tokens, EXCLUDED.capacity) END,
+	last_refill_at = CASE WHEN $8 THEN EXCLUDED.last_refill_at ELSE clients.last_refill_at END,
+	labels = COALESCE($7, clients.labels),
+	algorithm = COALESCE(NULLIF($9, ''), clients.algorithm)
+RETURNING (xmax = 0)`
+)
+
+// GetClientsByIDs — возвращает тех клиентов из списка ID, которые уже есть в БД.
+func (r *repository) GetClientsByIDs(ctx context.Context, ids []string) ([]*m.RateLimitClient, error) {
+	rows, err := r.pool.Query(ctx, clientsByIDsQuery, ids)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query existing clients")
+	}
+	defer rows.Close()
+
+	var clients []*m.RateLimitClient
+	for rows.Next() {
+		client, err := scanClient(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		clients = append(clients, client)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows iteration error")
+	}
+	return clients, nil
+}
+
+// ImportClients — загружает клиентов в одной транзакции: если хотя бы одна строка не записалась, не записывается
+// ничего. Без upsert клиенты вставляются через COPY, и существующий ID приводит к ошибке. С upsert строки
+// отправляются одним пакетом запросов INSERT ... ON CONFLICT; если клиент с ключом (Key) уже существовал, импорт
+// отменяется, чтобы не выдать ключ чужому клиенту. Ключи записываются через COPY в той же транзакции. Возвращает число
+// созданных и обновлённых клиентов.
+func (r *repository) ImportClients(ctx context.Context, clients []m.ImportClient, upsert bool) (created, updated int64, err error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if upsert {
+		created, updated, err = upsertClients(ctx, tx, clients)
+	} else {
+		created, err = copyClients(ctx, tx, clients)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := copyAPIKeys(ctx, tx, clients); err != nil {
+		return 0, 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, errors.Wrap(err, "failed to commit import")
+	}
+	return created, updated, nil
+}
+
+func copyClients(ctx context.Context, tx pgx.Tx, clients []m.ImportClient) (int64, error) {
+	columns := []string{"client_id", "capacity", "rate", "rate_period_ms", "tokens", "last_refill_at", "labels", "algorithm"}
+	source := pgx.CopyFromSlice(len(clients), func(i int) ([]any, error) {
+		c := clients[i].Client
+		labels := c.Labels
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		algorithm := c.Algorithm
+		if algorithm == "" {
+			algorithm = m.AlgorithmTokenBucket
+		}
+		return []any{c.ClientID, c.Capacity, c.Rate, periodMillis(c.RatePeriod), c.Tokens, c.LastRefillAt, labels, algorithm}, nil
+	})
+
+	created, err := tx.CopyFrom(ctx, pgx.Identifier{"clients"}, columns, source)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to copy clients")
+	}
+	return created, nil
+}
+
+func copyAPIKeys(ctx context.Context, tx pgx.Tx, clients []m.ImportClient) error {
+	var keys [][]any
+	for _, ic := range clients {
+		if key := ic.Key; key != nil {
+			keys = append(keys, []any{key.Prefix, key.ClientID, key.Hash, key.CreatedAt, key.ExpiresAt})
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	columns := []string{"prefix", "client_id", "key_hash", "created_at", "expires_at"}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"api_keys"}, columns, pgx.CopyFromRows(keys)); err != nil {
+		return errors.Wrap(err, "failed to copy api keys")
+	}
+	return nil
+}
+
+func upsertClients(ctx context.Context, tx pgx.Tx, clients []m.ImportClient) (created, updated int64, err error) {
+	batch := &pgx.Batch{}
+	for _, ic := range clients {
+		c := ic.Client
+		batch.Queue(upsertClientQuery, c.ClientID, c.Capacity, c.Rate, periodMillis(c.RatePeriod), c.Tokens, c.LastRefillAt,
+			nullableLabels(c.Labels), ic.TokensSet, c.Algorithm)
+	}
+
+	results := tx.SendBatch(ctx, batch)
+	defer results.Close()
+
+	for _, ic := range clients {
+		var inserted bool
+		if err := results.QueryRow().Scan(&inserted); err != nil {
+			return 0, 0, errors.Wrapf(err, "failed to upsert client %q", ic.Client.ClientID)
+		}
+		switch {
+		case inserted:
+			created++
+		case ic.Key != nil:
+			return 0, 0, errors.Errorf("client %q was created concurrently with the import", ic.Client.ClientID)
+		default:
+			updated++
+		}
+	}
+
+	if err := results.Close(); err != nil {
+		return 0, 0, errors.Wrap(err, "failed to upsert clients")
+	}
+	return created, updated, nil
+}
@@ -0,0 +1,133 @@
+package repo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	m "load-balancer/internal/models"
+)
+
+func TestClientFilterConditions(t *testing.T) {
+	minCapacity, maxCapacity := int64(10), int64(100)
+	minRate, maxRate := 0.5, 2.0
+
+	tests := []struct {
+		name           string
+		filter         m.ClientFilter
+		wantConditions []string
+		wantArgs       []any
+	}{
+		{
+			name: "empty filter",
+		},
+		{
+			name:           "prefix escapes LIKE wildcards",
+			filter:         m.ClientFilter{IDPrefix: `team_a%\`},
+			wantConditions: []string{`client_id LIKE $1 ESCAPE '\'`},
+			wantArgs:       []any{`team\_a\%\\%`},
+		},
+		{
+			name:           "capacity and rate ranges",
+			filter:         m.ClientFilter{MinCapacity: &minCapacity, MaxCapacity: &maxCapacity, MinRate: &minRate, MaxRate: &maxRate},
+			wantConditions: []string{"capacity >= $1", "capacity <= $2", "rate_per_second >= $3", "rate_per_second <= $4"},
+			wantArgs:       []any{minCapacity, maxCapacity, minRate, maxRate},
+		},
+		{
+			name:           "labels, status and plan",
+			filter:         m.ClientFilter{Labels: map[string]string{"team": "a"}, Status: m.ClientActive, Plan: "pro"},
+			wantConditions: []string{"labels @> $1", "status = $2", "plan = $3"},
+			wantArgs:       []any{map[string]string{"team": "a"}, m.ClientActive, "pro"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conditions, args := clientFilterConditions(tt.filter)
+			if !reflect.DeepEqual(conditions, tt.wantConditions) {
+				t.Errorf("conditions = %q, want %q", conditions, tt.wantConditions)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestWhereClause(t *testing.T) {
+	tests := []struct {
+		conditions []string
+		want       string
+	}{
+		{nil, ""},
+		{[]string{"status = $1"}, " WHERE status = $1"},
+		{[]string{"status = $1", "plan = $2"}, " WHERE status = $1 AND plan = $2"},
+	}
+	for _, tt := range tests {
+		if got := whereClause(tt.conditions); got != tt.want {
+			t.Errorf("whereClause(%q) = %q, want %q", tt.conditions, got, tt.want)
+		}
+	}
+}
+
+func TestListClientsSQL(t *testing.T) {
+	tests := []struct {
+		name      string
+		filter    m.ClientFilter
+		page      m.ClientPage
+		wantWhere string
+		wantOrder string
+		wantArgs  []any
+		wantErr   bool
+	}{
+		{
+			name:      "first page by id",
+			page:      m.ClientPage{SortBy: m.ClientSortID, Limit: 50},
+			wantOrder: " ORDER BY client_id ASC LIMIT $1",
+			wantArgs:  []any{50},
+		},
+		{
+			name:      "next page by id descending",
+			page:      m.ClientPage{SortBy: m.ClientSortID, Desc: true, HasCursor: true, AfterID: "c-10", Limit: 50},
+			wantWhere: " WHERE client_id < $1",
+			wantOrder: " ORDER BY client_id DESC LIMIT $2",
+			wantArgs:  []any{"c-10", 50},
+		},
+		{
+			name:      "next page by capacity after filter",
+			filter:    m.ClientFilter{Status: m.ClientActive},
+			page:      m.ClientPage{SortBy: m.ClientSortCapacity, HasCursor: true, AfterID: "c-10", AfterValue: 20, Limit: 10},
+			wantWhere: " WHERE status = $1 AND (capacity, client_id) > ($2, $3)",
+			wantOrder: " ORDER BY capacity ASC, client_id ASC LIMIT $4",
+			wantArgs:  []any{m.ClientActive, 20.0, "c-10", 10},
+		},
+		{
+			name:    "unknown sort field",
+			page:    m.ClientPage{SortBy: "labels", Limit: 10},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args, err := listClientsSQL(tt.filter, tt.page)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := listClientsQuery + tt.wantWhere + tt.wantOrder
+			if query != want {
+				t.Errorf("query = %q, want %q", strings.TrimPrefix(query, listClientsQuery),
+					strings.TrimPrefix(want, listClientsQuery))
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
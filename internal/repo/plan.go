@@ -0,0 +1,137 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+
+	m "load-balancer/internal/models"
+)
+
+const (
+	createPlanQuery = `INSERT INTO plans (name, capacity, rate, rate_period_ms, algorithm) VALUES ($1, $2, $3, $4, $5) RETURNING created_at, updated_at`
+	getPlanQuery    = `SELECT name, capacity, rate, rate_period_ms, algorithm, created_at, updated_at FROM plans WHERE name = $1`
+	listPlansQuery  = `SELECT name, capacity, rate, rate_period_ms, algorithm, created_at, updated_at FROM plans ORDER BY name`
+	updatePlanQuery = `UPDATE plans SET capacity = $2, rate = $3, rate_period_ms = $4, algorithm = $5, updated_at = now() WHERE name = $1 RETURNING created_at, updated_at`
+	deletePlanQuery = `DELETE FROM plans WHERE name = $1`
+	// trimPlanTokensQuery — урезает токены клиентов плана без собственной ёмкости до новой ёмкости плана.
+	trimPlanTokensQuery = `UPDATE clients SET tokens = LEAST(tokens, $2) WHERE plan = $1 AND capacity IS NULL AND tokens > $2`
+)
+
+var (
+	ErrPlanNotFound = errors.New("plan not found")
+	ErrPlanExists   = errors.New("plan with this name already exists")
+	ErrPlanInUse    = errors.New("plan is assigned to clients")
+)
+
+// CreatePlan — сохраняет план и проставляет ему время создания. Если план с таким именем уже есть, возвращает
+// ErrPlanExists.
+func (r *repository) CreatePlan(ctx context.Context, plan *m.Plan) error {
+	err := r.pool.QueryRow(ctx, createPlanQuery, planArgs(plan)...).Scan(&plan.CreatedAt, &plan.UpdatedAt)
+	if isUniqueViolation(err) {
+		return ErrPlanExists
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to create plan")
+	}
+	return nil
+}
+
+// GetPlan — возвращает план по имени или ErrPlanNotFound.
+func (r *repository) GetPlan(ctx context.Context, name string) (*m.Plan, error) {
+	plan, err := scanPlan(r.pool.QueryRow(ctx, getPlanQuery, name))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPlanNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query plan")
+	}
+	return plan, nil
+}
+
+// ListPlans — возвращает все планы в порядке имён.
+func (r *repository) ListPlans(ctx context.Context) ([]*m.Plan, error) {
+	rows, err := r.pool.Query(ctx, listPlansQuery)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query plans")
+	}
+	defer rows.Close()
+
+	var plans []*m.Plan
+	for rows.Next() {
+		plan, err := scanPlan(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		plans = append(plans, plan)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows iteration error")
+	}
+	return plans, nil
+}
+
+// UpdatePlan — заменяет лимиты плана. Токены клиентов, которые берут ёмкость из плана, урезаются до новой ёмкости
+// в той же транзакции. Если плана нет, возвращает ErrPlanNotFound.
+func (r *repository) UpdatePlan(ctx context.Context, plan *m.Plan) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	err = tx.QueryRow(ctx, updatePlanQuery, planArgs(plan)...).Scan(&plan.CreatedAt, &plan.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrPlanNotFound
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to update plan")
+	}
+	if _, err := tx.Exec(ctx, trimPlanTokensQuery, plan.Name, plan.Capacity); err != nil {
+		return errors.Wrap(err, "failed to trim plan clients tokens")
+	}
+
+	return errors.Wrap(tx.Commit(ctx), "failed to commit plan update")
+}
+
+// DeletePlan — удаляет план или возвращает ErrPlanNotFound. План, назначенный клиентам, не удаляется:
+// возвращается ErrPlanInUse.
+func (r *repository) DeletePlan(ctx context.Context, name string) error {
+	commandTag, err := r.pool.Exec(ctx, deletePlanQuery, name)
+	if isForeignKeyViolation(err) {
+		return ErrPlanInUse
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to delete plan")
+	}
+	if commandTag.RowsAffected() == 0 {
+		return ErrPlanNotFound
+	}
+	return nil
+}
+
+func planArgs(plan *m.Plan) []any {
+	return []any{plan.Name, plan.Capacity, plan.Rate, periodMillis(plan.RatePeriod), plan.Algorithm}
+}
+
+func scanPlan(row pgx.Row) (*m.Plan, error) {
+	var (
+		plan     m.Plan
+		periodMs int64
+	)
+	if err := row.Scan(&plan.Name, &plan.Capacity, &plan.Rate, &periodMs, &plan.Algorithm, &plan.CreatedAt,
+		&plan.UpdatedAt); err != nil {
+		return nil, err
+	}
+	plan.RatePeriod = m.Duration(time.Duration(periodMs) * time.Millisecond)
+	plan.RatePerSecond = m.RefillRate(plan.Rate, time.Duration(plan.RatePeriod))
+	return &plan, nil
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation
+}
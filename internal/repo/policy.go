@@ -0,0 +1,126 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+
+	m "load-balancer/internal/models"
+)
+
+const (
+	createPolicyQuery = `INSERT INTO rate_limit_policies (name, method, path_pattern, capacity, rate, rate_period_ms, algorithm) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING created_at, updated_at`
+	getPolicyQuery    = `SELECT name, method, path_pattern, capacity, rate, rate_period_ms, algorithm, created_at, updated_at FROM rate_limit_policies WHERE name = $1`
+	listPoliciesQuery = `SELECT name, method, path_pattern, capacity, rate, rate_period_ms, algorithm, created_at, updated_at FROM rate_limit_policies ORDER BY name`
+	updatePolicyQuery = `UPDATE rate_limit_policies SET method = $2, path_pattern = $3, capacity = $4, rate = $5, rate_period_ms = $6, algorithm = $7, updated_at = now() WHERE name = $1 RETURNING created_at, updated_at`
+	deletePolicyQuery = `DELETE FROM rate_limit_policies WHERE name = $1`
+)
+
+// uniqueViolation — код ошибки PostgreSQL при нарушении уникальности.
+const uniqueViolation = "23505"
+
+var (
+	ErrPolicyNotFound = errors.New("policy not found")
+	ErrPolicyExists   = errors.New("policy with this name or method and path pattern already exists")
+)
+
+// CreatePolicy — сохраняет политику и проставляет ей время создания. Если политика с таким именем или с такими же
+// методом и шаблоном пути уже есть, возвращает ErrPolicyExists.
+func (r *repository) CreatePolicy(ctx context.Context, policy *m.RateLimitPolicy) error {
+	err := r.pool.QueryRow(ctx, createPolicyQuery, policyArgs(policy)...).Scan(&policy.CreatedAt, &policy.UpdatedAt)
+	if isUniqueViolation(err) {
+		return ErrPolicyExists
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to create policy")
+	}
+	return nil
+}
+
+// GetPolicy — возвращает политику по имени или ErrPolicyNotFound.
+func (r *repository) GetPolicy(ctx context.Context, name string) (*m.RateLimitPolicy, error) {
+	policy, err := scanPolicy(r.pool.QueryRow(ctx, getPolicyQuery, name))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPolicyNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query policy")
+	}
+	return policy, nil
+}
+
+// ListPolicies — возвращает все политики в порядке имён.
+func (r *repository) ListPolicies(ctx context.Context) ([]*m.RateLimitPolicy, error) {
+	rows, err := r.pool.Query(ctx, listPoliciesQuery)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query policies")
+	}
+	defer rows.Close()
+
+	var policies []*m.RateLimitPolicy
+	for rows.Next() {
+		policy, err := scanPolicy(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		policies = append(policies, policy)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows iteration error")
+	}
+	return policies, nil
+}
+
+// UpdatePolicy — заменяет условия и лимиты политики. Если политики нет, возвращает ErrPolicyNotFound, если новые
+// метод и шаблон пути заняты другой политикой — ErrPolicyExists.
+func (r *repository) UpdatePolicy(ctx context.Context, policy *m.RateLimitPolicy) error {
+	err := r.pool.QueryRow(ctx, updatePolicyQuery, policyArgs(policy)...).Scan(&policy.CreatedAt, &policy.UpdatedAt)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return ErrPolicyNotFound
+	case isUniqueViolation(err):
+		return ErrPolicyExists
+	case err != nil:
+		return errors.Wrap(err, "failed to update policy")
+	}
+	return nil
+}
+
+// DeletePolicy — удаляет политику или возвращает ErrPolicyNotFound.
+func (r *repository) DeletePolicy(ctx context.Context, name string) error {
+	commandTag, err := r.pool.Exec(ctx, deletePolicyQuery, name)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete policy")
+	}
+	if commandTag.RowsAffected() == 0 {
+		return ErrPolicyNotFound
+	}
+	return nil
+}
+
+func policyArgs(policy *m.RateLimitPolicy) []any {
+	return []any{policy.Name, policy.Method, policy.PathPattern, policy.Capacity, policy.Rate,
+		periodMillis(policy.RatePeriod), policy.Algorithm}
+}
+
+func scanPolicy(row pgx.Row) (*m.RateLimitPolicy, error) {
+	var (
+		policy   m.RateLimitPolicy
+		periodMs int64
+	)
+	if err := row.Scan(&policy.Name, &policy.Method, &policy.PathPattern, &policy.Capacity, &policy.Rate, &periodMs,
+		&policy.Algorithm, &policy.CreatedAt, &policy.UpdatedAt); err != nil {
+		return nil, err
+	}
+	policy.RatePeriod = m.Duration(time.Duration(periodMs) * time.Millisecond)
+	policy.RatePerSecond = m.RefillRate(policy.Rate, time.Duration(policy.RatePeriod))
+	return &policy, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
@@ -0,0 +1,101 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	m "load-balancer/internal/models"
+)
+
+const (
+	listClientQuotasQuery   = `SELECT period, quota_limit, time_zone, used, window_start FROM client_quotas WHERE client_id = $1 ORDER BY array_position(ARRAY['day', 'week', 'month'], period)`
+	deleteClientQuotasQuery = `DELETE FROM client_quotas WHERE client_id = $1 AND NOT (period = ANY($2))`
+	// upsertClientQuotaQuery — задаёт квоту клиента; расход квоты с тем же периодом сохраняется.
+	upsertClientQuotaQuery = `INSERT INTO client_quotas (client_id, period, quota_limit, time_zone) VALUES ($1, $2, $3, $4)
+ON CONFLICT (client_id, period) DO UPDATE SET quota_limit = EXCLUDED.quota_limit, time_zone = EXCLUDED.time_zone`
+	// addQuotaUsageQuery — добавляет расход $4 к счётчику окна $3. Если в БД записано более раннее окно, счётчик
+	// начинается заново; расход уже закончившегося окна отбрасывается.
+	addQuotaUsageQuery = `UPDATE client_quotas SET
+	used = CASE WHEN window_start = $3 THEN used + $4 WHEN window_start < $3 THEN $4 ELSE used END,
+	window_start = GREATEST(window_start, $3)
+WHERE client_id = $1 AND period = $2
+RETURNING used, window_start`
+)
+
+// ListClientQuotas — возвращает квоты клиента с расходом, записанным в БД: день, неделя, месяц.
+func (r *repository) ListClientQuotas(ctx context.Context, clientID string) ([]m.ClientQuota, error) {
+	rows, err := r.pool.Query(ctx, listClientQuotasQuery, clientID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query client quotas")
+	}
+	defer rows.Close()
+
+	var quotas []m.ClientQuota
+	for rows.Next() {
+		var quota m.ClientQuota
+		if err := rows.Scan(&quota.Period, &quota.Limit, &quota.TimeZone, &quota.Used, &quota.WindowStart); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		quotas = append(quotas, quota)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows iteration error")
+	}
+	return quotas, nil
+}
+
+// SetClientQuotas — заменяет квоты клиента в одной транзакции: квоты с периодами не из списка удаляются, расход
+// оставшихся сохраняется. Если клиента нет, возвращает ErrClientNotFound.
+func (r *repository) SetClientQuotas(ctx context.Context, clientID string, quotas []m.ClientQuota) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	periods := make([]string, 0, len(quotas))
+	for _, quota := range quotas {
+		periods = append(periods, quota.Period)
+	}
+	if _, err := tx.Exec(ctx, deleteClientQuotasQuery, clientID, periods); err != nil {
+		return errors.Wrap(err, "failed to delete client quotas")
+	}
+	for _, quota := range quotas {
+		_, err := tx.Exec(ctx, upsertClientQuotaQuery, clientID, quota.Period, quota.Limit, quota.TimeZone)
+		if isForeignKeyViolation(err) {
+			return ErrClientNotFound
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to save client quota")
+		}
+	}
+
+	return errors.Wrap(tx.Commit(ctx), "failed to commit client quotas")
+}
+
+// AddQuotaUsage — одним пакетом добавляет расход квот к счётчикам в БД и записывает в usage общий расход и окно
+// каждого счётчика. У квот, которых уже нет в БД, WindowStart становится нулевым.
+func (r *repository) AddQuotaUsage(ctx context.Context, usage []m.QuotaUsage) error {
+	batch := &pgx.Batch{}
+	for _, u := range usage {
+		batch.Queue(addQuotaUsageQuery, u.ClientID, u.Period, u.WindowStart, u.Delta)
+	}
+
+	results := r.pool.SendBatch(ctx, batch)
+	defer results.Close()
+
+	for i := range usage {
+		err := results.QueryRow().Scan(&usage[i].Used, &usage[i].WindowStart)
+		if errors.Is(err, pgx.ErrNoRows) {
+			usage[i].Used, usage[i].WindowStart = 0, time.Time{}
+			continue
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to add quota usage")
+		}
+	}
+	return errors.Wrap(results.Close(), "failed to add quota usage")
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/pkg/errors"
 	"load-balancer/internal/config"
 	m "load-balancer/internal/models"
+	"time"
 )
 
 type repository struct {
@@ -18,8 +19,38 @@ type Repository interface {
 	CreateClient(ctx context.Context, client m.RateLimitClient) error
 	GetClientByID(ctx context.Context, id string) (*m.RateLimitClient, error)
 	UpdateClient(ctx context.Context, client m.RateLimitClient) error
+	SaveClientTokens(ctx context.Context, id string, tokens float64, lastRefillAt time.Time) error
 	DeleteClient(ctx context.Context, id string) error
-	GetAllClients(ctx context.Context) ([]*m.RateLimitClient, error)
+	ListClients(ctx context.Context, filter m.ClientFilter, page m.ClientPage) ([]*m.RateLimitClient, error)
+	SetClientLifecycle(ctx context.Context, id, status string, expiresAt *time.Time) error
+	CountClients(ctx context.Context, filter m.ClientFilter) (int64, error)
+	TakeTokens(ctx context.Context, id string, want, need int64, adjust float64) (*m.TokenGrant, error)
+	ForEachClientBatch(ctx context.Context, batchSize int, fn func([]*m.RateLimitClient) error) error
+	GetClientsByIDs(ctx context.Context, ids []string) ([]*m.RateLimitClient, error)
+	ImportClients(ctx context.Context, clients []m.ImportClient, upsert bool) (created, updated int64, err error)
+	CreateClientWithKey(ctx context.Context, client m.RateLimitClient, key m.APIKey) error
+	CreateAPIKey(ctx context.Context, key m.APIKey) error
+	RotateAPIKey(ctx context.Context, key m.APIKey, graceUntil time.Time) error
+	GetAPIKey(ctx context.Context, prefix string) (*m.APIKey, error)
+	ListAPIKeys(ctx context.Context, clientID string) ([]*m.APIKey, error)
+	RevokeAPIKey(ctx context.Context, clientID, prefix string) error
+	CreateAuditRecord(ctx context.Context, record m.AuditRecord) error
+	ListAuditRecords(ctx context.Context, filter m.AuditFilter) ([]*m.AuditRecord, error)
+	CreatePolicy(ctx context.Context, policy *m.RateLimitPolicy) error
+	GetPolicy(ctx context.Context, name string) (*m.RateLimitPolicy, error)
+	ListPolicies(ctx context.Context) ([]*m.RateLimitPolicy, error)
+	UpdatePolicy(ctx context.Context, policy *m.RateLimitPolicy) error
+	DeletePolicy(ctx context.Context, name string) error
+	CreatePlan(ctx context.Context, plan *m.Plan) error
+	GetPlan(ctx context.Context, name string) (*m.Plan, error)
+	ListPlans(ctx context.Context) ([]*m.Plan, error)
+	UpdatePlan(ctx context.Context, plan *m.Plan) error
+	DeletePlan(ctx context.Context, name string) error
+	ListClientQuotas(ctx context.Context, clientID string) ([]m.ClientQuota, error)
+	SetClientQuotas(ctx context.Context, clientID string, quotas []m.ClientQuota) error
+	AddQuotaUsage(ctx context.Context, usage []m.QuotaUsage) error
+	Stat() *pgxpool.Stat
+	Ping(ctx context.Context) error
 	Close()
 }
 
@@ -54,6 +85,19 @@ func NewRepository(ctx context.Context, config config.PostgreSQL) (Repository, e
 	return &repository{pool}, nil
 }
 
+// Stat — возвращает текущую статистику пула соединений, используется для экспорта метрик.
+func (r *repository) Stat() *pgxpool.Stat {
+	return r.pool.Stat()
+}
+
+// Ping — проверяет, что база данных доступна. Используется в проверке готовности.
+func (r *repository) Ping(ctx context.Context) error {
+	if err := r.pool.Ping(ctx); err != nil {
+		return errors.Wrap(err, "failed to ping database")
+	}
+	return nil
+}
+
 // Close закрывает соединение с базой данных. Функция была созданна для graceful shutdown.
 func (r *repository) Close() {
 	if r.pool != nil {
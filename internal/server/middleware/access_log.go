@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"load-balancer/internal/accesslog"
+	"load-balancer/internal/identity"
+)
+
+// RequestIDHeader — заголовок с ID запроса. Если клиент его не передал, ID генерируется и пробрасывается на бэкенд.
+const RequestIDHeader = "X-Request-ID"
+
+type AccessLogMiddleware struct {
+	accessLog *accesslog.Logger
+	trusted   identity.TrustedProxies
+	logger    *zap.SugaredLogger
+}
+
+// NewAccessLogMiddleware — создаёт middleware, которое пишет по одной записи access-лога на каждый запрос. Для
+// запросов от trusted адрес клиента берётся из X-Forwarded-For.
+func NewAccessLogMiddleware(accessLog *accesslog.Logger, trusted identity.TrustedProxies,
+	logger *zap.SugaredLogger) *AccessLogMiddleware {
+	return &AccessLogMiddleware{
+		accessLog: accessLog,
+		trusted:   trusted,
+		logger:    logger,
+	}
+}
+
+// Middleware — заводит запись access-лога в контексте запроса, считает байты запроса и ответа, а после обработки
+// записывает итоговую строку лога.
+func (m *AccessLogMiddleware) Middleware(next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" {
+			requestID = uuid.NewString()
+			r.Header.Set(RequestIDHeader, requestID)
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		var remoteIP string
+		if addr, ok := m.trusted.ClientAddr(r); ok {
+			remoteIP = addr.String()
+		} else if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			remoteIP = host
+		} else {
+			remoteIP = r.RemoteAddr
+		}
+
+		entry := &accesslog.Entry{
+			Time:      start,
+			RequestID: requestID,
+			RemoteIP:  remoteIP,
+			Method:    r.Method,
+			Host:      r.Host,
+			Path:      r.URL.Path,
+			Proto:     r.Proto,
+			Referer:   r.Referer(),
+			UserAgent: r.UserAgent(),
+		}
+
+		body := &countingReader{ReadCloser: r.Body}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = body
+		}
+		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rw, r.WithContext(accesslog.WithEntry(r.Context(), entry)))
+
+		entry.Status = rw.status
+		entry.BytesIn = body.n.Load()
+		entry.BytesOut = rw.bytes
+		entry.TotalLatency = time.Since(start)
+
+		if err := m.accessLog.Log(entry); err != nil {
+			m.logger.Errorw("failed to write access log", "error", err)
+		}
+	}
+}
+
+// responseWriter — обёртка над http.ResponseWriter, запоминающая статус и число отправленных байт.
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.status = code
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap — позволяет http.ResponseController добраться до исходного ResponseWriter (Flush и т.п.).
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// countingReader — считает байты, прочитанные из тела запроса. Тело читает транспорт прокси в своей горутине,
+// которая может ещё писать на бэкенд, когда хендлер уже вернулся, поэтому счётчик атомарный.
+type countingReader struct {
+	io.ReadCloser
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+	"load-balancer/internal/auth"
+	"load-balancer/internal/service"
+)
+
+type AdminAuthMiddleware struct {
+	authenticator *auth.Authenticator
+	logger        *zap.SugaredLogger
+}
+
+// NewAdminAuthMiddleware — создаёт middleware, которое проверяет вызывающего админского API и его роль.
+func NewAdminAuthMiddleware(authenticator *auth.Authenticator, logger *zap.SugaredLogger) *AdminAuthMiddleware {
+	return &AdminAuthMiddleware{
+		authenticator: authenticator,
+		logger:        logger,
+	}
+}
+
+// Require — пропускает запрос, только если вызывающий аутентифицирован и его роли хватает для эндпоинта. Без учётных
+// данных или с неверными отвечает 401, при недостаточной роли — 403. Каждый отказ пишется в лог. Вызывающий
+// кладётся в контекст запроса, чтобы обработчики знали, кто выполняет действие.
+func (m *AdminAuthMiddleware) Require(role auth.Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, err := m.authenticator.Authenticate(r)
+		if err != nil {
+			m.logger.Warnw("admin access denied", "reason", err.Error(), "method", r.Method, "path", r.URL.Path,
+				"remote_addr", r.RemoteAddr, "required_role", role.String())
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			service.WriteJSONError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		if !principal.Role.Allows(role) {
+			m.logger.Warnw("admin access denied", "reason", "insufficient role", "actor", principal.Name,
+				"role", principal.Role.String(), "required_role", role.String(), "method", r.Method,
+				"path", r.URL.Path, "remote_addr", r.RemoteAddr)
+			service.WriteJSONError(w, http.StatusForbidden, "forbidden")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	}
+}
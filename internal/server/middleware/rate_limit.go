@@ -1,49 +1,286 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"load-balancer/internal/accesslog"
+	"load-balancer/internal/apikey"
+	"load-balancer/internal/identity"
+	"load-balancer/internal/metrics"
 	"load-balancer/internal/rate_limit"
-	"load-balancer/internal/repo"
 	"load-balancer/internal/service"
+	"math"
 	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Причины ответа 429 в поле error тела ответа.
+const (
+	ReasonRateLimitExceeded = "rate_limit_exceeded"
+	ReasonQuotaExceeded     = "quota_exceeded"
 )
 
+// Стили заголовков с состоянием лимита: IETF RateLimit-Policy и RateLimit, распространённые X-RateLimit-*, оба
+// сразу или никаких.
+const (
+	RateLimitHeadersIETF   = "ietf"
+	RateLimitHeadersLegacy = "legacy"
+	RateLimitHeadersBoth   = "both"
+	RateLimitHeadersNone   = "none"
+)
+
+// RateLimitOptions — настройки middleware рейт-лимита помимо лимитера и определения клиента.
+type RateLimitOptions struct {
+	// Headers — стиль заголовков с состоянием лимита.
+	Headers string
+	// Costs — правила стоимости запросов.
+	Costs *rate_limit.CostRules
+	// ForwardHeader — заголовок, в котором ID клиента передаётся бэкенду; пустой — не передаётся.
+	ForwardHeader string
+	// Anonymous — определение адреса для запросов без данных о клиенте; nil — такие запросы получают 401.
+	Anonymous *identity.Extractor
+	// FailOpen — пропускать запросы без проверки лимита, если лимитер недоступен, вместо ответа 503.
+	FailOpen bool
+}
+
 type RateLimitMiddleware struct {
-	tokenBucket *rate_limit.TokenBucket
-	repo        repo.Repository
+	limiter    rate_limit.Limiter
+	identities *identity.Extractor
+	metrics    metrics.Recorder
+	opts       RateLimitOptions
+	logger     *zap.SugaredLogger
 }
 
-// NewRateLimitMiddleware — создаёт новый экземпляр middleware для рейт-лимита, принимая токен-бакет и репозиторий.
-func NewRateLimitMiddleware(tb *rate_limit.TokenBucket, repo repo.Repository) *RateLimitMiddleware {
+// NewRateLimitMiddleware — создаёт новый экземпляр middleware для рейт-лимита, принимая лимитер, определение клиента
+// запроса, метрики и остальные настройки.
+func NewRateLimitMiddleware(limiter rate_limit.Limiter, identities *identity.Extractor, recorder metrics.Recorder,
+	opts RateLimitOptions, logger *zap.SugaredLogger) *RateLimitMiddleware {
 	return &RateLimitMiddleware{
-		tokenBucket: tb,
-		repo:        repo,
+		limiter:    limiter,
+		identities: identities,
+		metrics:    recorder,
+		opts:       opts,
+		logger:     logger,
 	}
 }
 
-// Middleware — оборачивает хендлер, проверяя через TokenBucket.Allow, разрешено ли выполнение запроса клиенту по API-ключу.
-// Если лимит превышен — возвращает 429 ошибку, иначе пропускает запрос дальше.
+// Middleware — оборачивает хендлер, определяя клиента запроса и проверяя через Limiter.Allow, разрешено ли ему
+// выполнение запроса. Клиент сохраняется в контексте запроса и, если задан ForwardHeader, передаётся бэкенду.
+// Запрос без данных о клиенте ограничивается анонимным лимитом по адресу, если он настроен, иначе получает 401.
+// Неизвестный клиент, отозванный или истёкший ключ, неверный токен и истёкший срок клиента — 401, приостановленный
+// или отключённый клиент — 403, превышение лимита — 429 с Retry-After, исчерпанная квота — 429 с Retry-After до начала
+// следующего окна квоты; причина 429 передаётся в поле error. Если клиента или лимит не удалось проверить
+// из-за ошибки, клиент получает 503, а с FailOpen запрос пропускается без проверки лимита; подробности ошибки пишутся
+// только в лог. И пропущенные, и отклонённые по лимиту ответы получают заголовки с состоянием лимита. Запрос
+// расходует столько единиц лимита, сколько стоит по правилам стоимости; если бэкенд сообщил стоимость в заголовке
+// ответа или тело запроса оказалось больше Content-Length (например, при chunked-загрузке), разница досписывается
+// после ответа.
 func (middleware *RateLimitMiddleware) Middleware(next http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
+		entry := accesslog.FromContext(ctx)
+
+		id, err := middleware.identities.Extract(r)
+		var missing *identity.MissingError
+		anonymous := errors.As(err, &missing) && middleware.opts.Anonymous != nil
+		if anonymous {
+			id, err = middleware.opts.Anonymous.Extract(r)
+			id.Source = rate_limit.AnonymousPolicy
+		}
+		switch {
+		case errors.As(err, &missing):
+			service.WriteJSONError(w, http.StatusUnauthorized, err.Error())
+			return
+		case errors.Is(err, apikey.ErrKeyRevoked), errors.Is(err, apikey.ErrKeyExpired):
+			service.WriteJSONError(w, http.StatusUnauthorized, err.Error())
+			return
+		case errors.Is(err, apikey.ErrInvalidKey), errors.Is(err, apikey.ErrUnknownKey):
+			service.WriteJSONError(w, http.StatusUnauthorized, "invalid api key")
+			return
+		case errors.Is(err, identity.ErrInvalidToken):
+			service.WriteJSONError(w, http.StatusUnauthorized, "invalid token")
+			return
+		case err != nil:
+			middleware.logger.Errorw("failed to identify client", "error", err)
+			entry.RateLimitDecision = metrics.DecisionError
+			unavailable(w, "client identification is temporarily unavailable")
+			return
+		}
 
-		clientID := r.Header.Get("X-API-KEY")
-		if clientID == "" {
-			service.WriteJSONError(w, http.StatusUnauthorized, "missing X-API-KEY header")
+		clientID := id.ClientID
+		metricsID := clientID
+		if anonymous {
+			metricsID = rate_limit.AnonymousPolicy
+		}
+		entry.ClientID = clientID
+		entry.IdentitySource = id.Source
+		if header := middleware.opts.ForwardHeader; header != "" {
+			if anonymous {
+				r.Header.Del(header)
+			} else {
+				r.Header.Set(header, clientID)
+			}
+		}
+		r = r.WithContext(identity.WithIdentity(ctx, id))
+
+		req := rate_limit.Request{ClientID: clientID, Key: id.Key, Anonymous: anonymous, Method: r.Method,
+			Path: r.URL.Path, Cost: middleware.opts.Costs.RequestCost(r)}
+		decision, err := middleware.limiter.Allow(ctx, req)
+		var quotaErr *rate_limit.QuotaExceededError
+		switch {
+		case errors.As(err, &quotaErr):
+			middleware.metrics.ObserveRateLimit(metricsID, metrics.DecisionQuotaExceeded)
+			entry.RateLimitDecision = metrics.DecisionQuotaExceeded
+			w.Header().Set("Retry-After", strconv.FormatInt(max(ceilSeconds(quotaErr.Reset), 1), 10))
+			service.WriteJSONErrorReason(w, http.StatusTooManyRequests, ReasonQuotaExceeded, err.Error())
+			return
+		case errors.Is(err, rate_limit.ErrClientSuspended), errors.Is(err, rate_limit.ErrClientDisabled):
+			middleware.reject(w, entry, metricsID, http.StatusForbidden, err)
+			return
+		case errors.Is(err, rate_limit.ErrClientExpired), errors.Is(err, rate_limit.ErrUnknownClient):
+			middleware.reject(w, entry, metricsID, http.StatusUnauthorized, err)
+			return
+		case err != nil:
+			middleware.logger.Errorw("rate limit check failed", "clientID", clientID, "failOpen", middleware.opts.FailOpen,
+				"error", err)
+			middleware.metrics.ObserveRateLimit(metricsID, metrics.DecisionError)
+			entry.RateLimitDecision = metrics.DecisionError
+			if middleware.opts.FailOpen {
+				next.ServeHTTP(w, r)
+				return
+			}
+			unavailable(w, "rate limiter is temporarily unavailable")
 			return
 		}
 
-		allowed, err := middleware.tokenBucket.Allow(ctx, clientID)
-		if err != nil {
-			service.WriteJSONError(w, http.StatusInternalServerError, fmt.Sprintf("rate limit error: %v", err))
+		middleware.writeHeaders(w.Header(), decision)
+		if !decision.Allowed {
+			middleware.metrics.ObserveRateLimit(metricsID, metrics.DecisionLimited)
+			entry.RateLimitDecision = metrics.DecisionLimited
+			w.Header().Set("Retry-After", strconv.FormatInt(max(ceilSeconds(decision.RetryAfter), 1), 10))
+			service.WriteJSONErrorReason(w, http.StatusTooManyRequests, ReasonRateLimitExceeded, "rate limit exceeded")
 			return
 		}
 
-		if !allowed {
-			service.WriteJSONError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		middleware.metrics.ObserveRateLimit(metricsID, metrics.DecisionAllowed)
+		entry.RateLimitDecision = metrics.DecisionAllowed
+		costs := middleware.opts.Costs
+		var body *countingBody
+		if costs.CountsBody() && r.Body != nil && r.Body != http.NoBody {
+			body = &countingBody{ReadCloser: r.Body}
+			r.Body = body
+		}
+		if !costs.Deferred() && body == nil {
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		var extra int64
+		if costs.Deferred() {
+			cw := &costResponseWriter{ResponseWriter: w, costs: costs}
+			next.ServeHTTP(cw, r)
+			cw.capture()
+			extra = cw.cost
+		} else {
+			next.ServeHTTP(w, r)
+		}
+		if body != nil {
+			extra += max(costs.BodyCost(body.read.Load())-costs.BodyCost(max(r.ContentLength, 0)), 0)
+		}
+		if extra > 0 {
+			if err := middleware.limiter.Charge(context.WithoutCancel(ctx), req, extra); err != nil {
+				middleware.logger.Errorw("failed to charge response cost", "clientID", clientID, "cost", extra, "error", err)
+			}
+		}
+	}
+}
+
+// countingBody — обёртка над телом запроса, считающая прочитанные из него байты. Тело читает транспорт прокси,
+// поэтому счётчик атомарный.
+type countingBody struct {
+	io.ReadCloser
+	read atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read.Add(int64(n))
+	return n, err
+}
+
+// unavailable — отвечает 503, когда запрос нельзя проверить из-за временной ошибки, например недоступности БД.
+func unavailable(w http.ResponseWriter, message string) {
+	w.Header().Set("Retry-After", "1")
+	service.WriteJSONError(w, http.StatusServiceUnavailable, message)
+}
+
+// reject — отклоняет запрос клиента, которому запрещено работать независимо от лимита.
+func (middleware *RateLimitMiddleware) reject(w http.ResponseWriter, entry *accesslog.Entry, clientID string, code int, err error) {
+	middleware.metrics.ObserveRateLimit(clientID, metrics.DecisionRejected)
+	entry.RateLimitDecision = metrics.DecisionRejected
+	service.WriteJSONError(w, code, err.Error())
+}
+
+// writeHeaders — добавляет к ответу заголовки с состоянием лимита клиента в выбранном стиле. Времена передаются
+// в секундах от текущего момента с округлением вверх.
+func (middleware *RateLimitMiddleware) writeHeaders(h http.Header, decision rate_limit.Decision) {
+	headers := middleware.opts.Headers
+	if headers == RateLimitHeadersIETF || headers == RateLimitHeadersBoth {
+		policy := decision.Policy
+		if policy == "" {
+			policy = rate_limit.DefaultPolicy
+		}
+		h.Set("RateLimit-Policy", fmt.Sprintf(`%q;q=%d;w=%d`, policy, decision.Limit, max(ceilSeconds(decision.Window), 1)))
+		h.Set("RateLimit", fmt.Sprintf(`%q;r=%d;t=%d`, policy, decision.Remaining, ceilSeconds(decision.Reset)))
+	}
+	if headers == RateLimitHeadersLegacy || headers == RateLimitHeadersBoth {
+		h.Set("X-RateLimit-Limit", strconv.FormatInt(decision.Limit, 10))
+		h.Set("X-RateLimit-Remaining", strconv.FormatInt(decision.Remaining, 10))
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(ceilSeconds(decision.Reset), 10))
+	}
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(d.Seconds()))
+}
+
+// costResponseWriter — обёртка над http.ResponseWriter, забирающая из ответа бэкенда заголовок со стоимостью запроса,
+// чтобы он не дошёл до клиента.
+type costResponseWriter struct {
+	http.ResponseWriter
+	costs    *rate_limit.CostRules
+	cost     int64
+	captured bool
+}
+
+// capture — читает стоимость из заголовков ответа один раз, до их отправки клиенту.
+func (cw *costResponseWriter) capture() {
+	if !cw.captured {
+		cw.captured = true
+		cw.cost = cw.costs.ResponseCost(cw.Header())
 	}
 }
+
+func (cw *costResponseWriter) WriteHeader(code int) {
+	cw.capture()
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *costResponseWriter) Write(b []byte) (int, error) {
+	cw.capture()
+	return cw.ResponseWriter.Write(b)
+}
+
+// Unwrap — позволяет http.ResponseController добраться до исходного ResponseWriter (Flush и т.п.).
+func (cw *costResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
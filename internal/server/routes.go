@@ -1,17 +1,97 @@
 package server
 
 import (
+	"load-balancer/internal/auth"
 	"load-balancer/internal/server/middleware"
 	"net/http"
+	"net/http/pprof"
 
 	"load-balancer/internal/service"
 )
 
-// RegisterRoutes — регистрирует HTTP-роуты: прокси с рейт-лимитом, а также CRUD-эндпоинты для клиентов.
-func RegisterRoutes(proxySvc *service.ProxyService, clientSvc *service.ClientService, middleware *middleware.RateLimitMiddleware) {
-	http.HandleFunc("/", middleware.Middleware(proxySvc.ProxyHandler()))
-	http.HandleFunc("POST /clients", clientSvc.CreateClientHandler())
-	http.HandleFunc("GET /clients/{id}", clientSvc.GetClientHandler())
-	http.HandleFunc("PATCH /clients/{id}", clientSvc.UpdateClientHandler())
-	http.HandleFunc("DELETE /clients/{id}", clientSvc.DeleteClientHandler())
+// AdminHandlers — сервисы, эндпоинты которых публикуются на админском порту.
+type AdminHandlers struct {
+	Clients     *service.ClientService
+	APIKeys     *service.APIKeyService
+	Policies    *service.PolicyService
+	Plans       *service.PlanService
+	Status      *service.StatusService
+	Backends    *service.BackendService
+	Audit       *service.AuditService
+	Health      *service.HealthService
+	MetricsPath string
+	Metrics     http.Handler
+}
+
+// NewProxyRouter — создаёт роутер публичного порта: на нём только проксирование с рейт-лимитом и access-логом
+// (если он включён).
+func NewProxyRouter(proxySvc *service.ProxyService, rateLimiter *middleware.RateLimitMiddleware,
+	accessLog *middleware.AccessLogMiddleware) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	proxyHandler := rateLimiter.Middleware(proxySvc.ProxyHandler())
+	if accessLog != nil {
+		proxyHandler = accessLog.Middleware(proxyHandler)
+	}
+	mux.HandleFunc("/", proxyHandler)
+
+	return mux
+}
+
+// NewAdminRouter — создаёт роутер админского порта: CRUD-эндпоинты для клиентов, политик и планов рейт-лимита, состояние
+// пулов и управление бэкендами, журнал изменений, проверки живости и готовности, метрики и отладочные эндпоинты pprof. Для каждого
+// эндпоинта задана минимальная роль: viewer только читает, operator меняет лимиты клиентов, политик и планов и выводит
+// бэкенды из ротации, admin заводит и удаляет клиентов, политики, планы и бэкенды и имеет доступ к pprof. Проверки /healthz и /readyz открыты,
+// их вызывает оркестратор.
+func NewAdminRouter(h AdminHandlers, authz *middleware.AdminAuthMiddleware) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /clients", authz.Require(auth.RoleViewer, h.Clients.ListClientsHandler()))
+	mux.HandleFunc("POST /clients", authz.Require(auth.RoleAdmin, h.Clients.CreateClientHandler()))
+	mux.HandleFunc("POST /clients/import", authz.Require(auth.RoleAdmin, h.Clients.ImportClientsHandler()))
+	mux.HandleFunc("GET /clients/export", authz.Require(auth.RoleViewer, h.Clients.ExportClientsHandler()))
+	mux.HandleFunc("GET /clients/{id}", authz.Require(auth.RoleViewer, h.Clients.GetClientHandler()))
+	mux.HandleFunc("PATCH /clients/{id}", authz.Require(auth.RoleOperator, h.Clients.UpdateClientHandler()))
+	mux.HandleFunc("PUT /clients/{id}/status", authz.Require(auth.RoleOperator, h.Clients.SetStatusHandler()))
+	mux.HandleFunc("PUT /clients/{id}/quotas", authz.Require(auth.RoleOperator, h.Clients.SetQuotasHandler()))
+	mux.HandleFunc("DELETE /clients/{id}", authz.Require(auth.RoleAdmin, h.Clients.DeleteClientHandler()))
+	mux.HandleFunc("GET /clients/{id}/keys", authz.Require(auth.RoleViewer, h.APIKeys.ListKeysHandler()))
+	mux.HandleFunc("POST /clients/{id}/keys", authz.Require(auth.RoleAdmin, h.APIKeys.IssueKeyHandler()))
+	mux.HandleFunc("POST /clients/{id}/keys/rotate", authz.Require(auth.RoleAdmin, h.APIKeys.RotateKeyHandler()))
+	mux.HandleFunc("DELETE /clients/{id}/keys/{prefix}", authz.Require(auth.RoleAdmin, h.APIKeys.RevokeKeyHandler()))
+
+	mux.HandleFunc("GET /policies", authz.Require(auth.RoleViewer, h.Policies.ListPoliciesHandler()))
+	mux.HandleFunc("POST /policies", authz.Require(auth.RoleAdmin, h.Policies.CreatePolicyHandler()))
+	mux.HandleFunc("GET /policies/{name}", authz.Require(auth.RoleViewer, h.Policies.GetPolicyHandler()))
+	mux.HandleFunc("PUT /policies/{name}", authz.Require(auth.RoleOperator, h.Policies.UpdatePolicyHandler()))
+	mux.HandleFunc("DELETE /policies/{name}", authz.Require(auth.RoleAdmin, h.Policies.DeletePolicyHandler()))
+
+	mux.HandleFunc("GET /plans", authz.Require(auth.RoleViewer, h.Plans.ListPlansHandler()))
+	mux.HandleFunc("POST /plans", authz.Require(auth.RoleAdmin, h.Plans.CreatePlanHandler()))
+	mux.HandleFunc("GET /plans/{name}", authz.Require(auth.RoleViewer, h.Plans.GetPlanHandler()))
+	mux.HandleFunc("PUT /plans/{name}", authz.Require(auth.RoleOperator, h.Plans.UpdatePlanHandler()))
+	mux.HandleFunc("DELETE /plans/{name}", authz.Require(auth.RoleAdmin, h.Plans.DeletePlanHandler()))
+
+	mux.HandleFunc("GET /pools", authz.Require(auth.RoleViewer, h.Status.PoolsHandler()))
+	mux.HandleFunc("GET /pools/{pool}", authz.Require(auth.RoleViewer, h.Status.PoolHandler()))
+	mux.HandleFunc("GET /pools/{pool}/backends/{backend}", authz.Require(auth.RoleViewer, h.Backends.GetBackendHandler()))
+	mux.HandleFunc("POST /pools/{pool}/backends", authz.Require(auth.RoleAdmin, h.Backends.AddBackendHandler()))
+	mux.HandleFunc("DELETE /pools/{pool}/backends/{backend}", authz.Require(auth.RoleAdmin, h.Backends.RemoveBackendHandler()))
+	mux.HandleFunc("POST /pools/{pool}/backends/{backend}/disable", authz.Require(auth.RoleOperator, h.Backends.DisableBackendHandler()))
+	mux.HandleFunc("POST /pools/{pool}/backends/{backend}/enable", authz.Require(auth.RoleOperator, h.Backends.EnableBackendHandler()))
+	mux.HandleFunc("POST /pools/{pool}/backends/{backend}/drain", authz.Require(auth.RoleOperator, h.Backends.DrainBackendHandler()))
+
+	mux.HandleFunc("GET /audit", authz.Require(auth.RoleViewer, h.Audit.ListAuditHandler()))
+
+	mux.HandleFunc("GET /healthz", h.Health.LivenessHandler())
+	mux.HandleFunc("GET /readyz", h.Health.ReadinessHandler())
+	mux.HandleFunc("GET "+h.MetricsPath, authz.Require(auth.RoleViewer, h.Metrics.ServeHTTP))
+
+	mux.HandleFunc("GET /debug/pprof/", authz.Require(auth.RoleAdmin, pprof.Index))
+	mux.HandleFunc("GET /debug/pprof/cmdline", authz.Require(auth.RoleAdmin, pprof.Cmdline))
+	mux.HandleFunc("GET /debug/pprof/profile", authz.Require(auth.RoleAdmin, pprof.Profile))
+	mux.HandleFunc("GET /debug/pprof/symbol", authz.Require(auth.RoleAdmin, pprof.Symbol))
+	mux.HandleFunc("GET /debug/pprof/trace", authz.Require(auth.RoleAdmin, pprof.Trace))
+
+	return mux
 }
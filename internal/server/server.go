@@ -1,27 +1,128 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"go.uber.org/zap"
 	"net/http"
+	"os"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"load-balancer/internal/config"
 )
 
 type Server struct {
-	logger *zap.SugaredLogger
-	port   *int
+	logger       *zap.SugaredLogger
+	port         *int
+	tls          config.TLS
+	admin        config.Admin
+	httpServer   *http.Server
+	adminServer  *http.Server
+	shuttingDown atomic.Bool
 }
 
-// NewServer — создаёт новый сервер с указанием порта и логгером.
-func NewServer(logger *zap.SugaredLogger, port *int) *Server {
+// NewServer — создаёт сервер из двух слушателей: публичного порта для проксируемого трафика и отдельного админского
+// адреса для управления, метрик и проверок. Если задан client_ca_file, слушатель запрашивает клиентские
+// сертификаты и проверяет их этим CA; клиенты без сертификата могут аутентифицироваться иначе.
+func NewServer(logger *zap.SugaredLogger, port *int, publicTLS config.TLS, admin config.Admin) (*Server, error) {
+	httpServer := &http.Server{Addr: fmt.Sprintf(":%d", *port)}
+	if publicTLS.ClientCAFile != "" {
+		tlsConfig, err := clientCertConfig(publicTLS.ClientCAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to configure client certificates")
+		}
+		httpServer.TLSConfig = tlsConfig
+	}
+
+	adminServer := &http.Server{Addr: admin.Address}
+	if admin.Auth.ClientCAFile != "" {
+		tlsConfig, err := clientCertConfig(admin.Auth.ClientCAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to configure admin client certificates")
+		}
+		adminServer.TLSConfig = tlsConfig
+	}
+
 	return &Server{
-		logger: logger,
-		port:   port,
+		logger:      logger,
+		port:        port,
+		tls:         publicTLS,
+		admin:       admin,
+		httpServer:  httpServer,
+		adminServer: adminServer,
+	}, nil
+}
+
+// clientCertConfig — настройки TLS, при которых клиентские сертификаты необязательны, но переданные проверяются
+// CA из файла.
+func clientCertConfig(caFile string) (*tls.Config, error) {
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read client CA file")
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("client CA file contains no certificates")
 	}
+	return &tls.Config{
+		ClientCAs:  clientCAs,
+		ClientAuth: tls.VerifyClientCertIfGiven,
+	}, nil
+}
+
+// Start — запускает публичный и админский HTTP-серверы с переданными обработчиками и выводит сообщение о старте.
+// Блокируется, пока один из них не остановится; штатная остановка через Shutdown ошибкой не считается.
+func (s *Server) Start(proxyHandler, adminHandler http.Handler) error {
+	s.httpServer.Handler = proxyHandler
+	s.adminServer.Handler = adminHandler
+	errs := make(chan error, 2)
+
+	go func() {
+		s.logger.Infow("Starting server", "port", s.port, "tls", s.tls.CertFile != "")
+		if s.tls.CertFile != "" {
+			errs <- s.httpServer.ListenAndServeTLS(s.tls.CertFile, s.tls.KeyFile)
+			return
+		}
+		errs <- s.httpServer.ListenAndServe()
+	}()
+
+	go func() {
+		s.logger.Infow("Starting admin server", "address", s.admin.Address, "tls", s.admin.TLSCertFile != "")
+		if s.admin.TLSCertFile != "" {
+			errs <- s.adminServer.ListenAndServeTLS(s.admin.TLSCertFile, s.admin.TLSKeyFile)
+			return
+		}
+		errs <- s.adminServer.ListenAndServe()
+	}()
+
+	if err := <-errs; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown — помечает сервер как останавливающийся, перестаёт принимать новые соединения и ждёт завершения текущих
+// запросов, пока не истечёт контекст. Админский сервер останавливается последним, чтобы до конца отдавать метрики
+// и состояние готовности.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shuttingDown.Store(true)
+	err := s.httpServer.Shutdown(ctx)
+	if adminErr := s.adminServer.Shutdown(ctx); adminErr != nil && err == nil {
+		err = adminErr
+	}
+	return err
+}
+
+// MarkShuttingDown — помечает сервер как останавливающийся, не закрывая соединения. Вызывается первым шагом
+// остановки, чтобы проверка готовности успела вывести инстанс из балансировки.
+func (s *Server) MarkShuttingDown() {
+	s.shuttingDown.Store(true)
 }
 
-// Start — запускает HTTP-сервер на указанном порту и выводит сообщение о старте.
-func (s *Server) Start() error {
-	s.logger.Infow("Starting server", "port", s.port)
-	addr := fmt.Sprintf(":%d", *s.port)
-	return http.ListenAndServe(addr, nil)
+// ShuttingDown — true, если сервер начал остановку.
+func (s *Server) ShuttingDown() bool {
+	return s.shuttingDown.Load()
 }
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"load-balancer/internal/apikey"
+	"load-balancer/internal/audit"
+	"load-balancer/internal/models"
+	"load-balancer/internal/repo"
+)
+
+// defaultRotationGrace — сколько по умолчанию продолжают работать старые ключи после ротации.
+const defaultRotationGrace = 24 * time.Hour
+
+type APIKeyService struct {
+	repo    repo.Repository
+	keys    *apikey.Resolver
+	auditor *audit.Auditor
+	logger  *zap.SugaredLogger
+}
+
+type apiKeyView struct {
+	*models.APIKey
+	State string `json:"state"`
+}
+
+type issuedKeyResponse struct {
+	ClientID  string     `json:"client_id"`
+	APIKey    string     `json:"api_key"`
+	Prefix    string     `json:"key_prefix"`
+	OldExpire *time.Time `json:"previous_keys_expire_at,omitempty"`
+}
+
+// NewAPIKeyService — создаёт сервис выдачи, ротации и отзыва API-ключей клиентов.
+func NewAPIKeyService(repo repo.Repository, keys *apikey.Resolver, auditor *audit.Auditor, logger *zap.SugaredLogger) *APIKeyService {
+	return &APIKeyService{
+		repo:    repo,
+		keys:    keys,
+		auditor: auditor,
+		logger:  logger,
+	}
+}
+
+// ListKeysHandler — возвращает ключи клиента с их состоянием. Сами ключи и их хэши не отдаются.
+func (ks *APIKeyService) ListKeysHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientID := r.PathValue("id")
+		keys, err := ks.repo.ListAPIKeys(r.Context(), clientID)
+		if err != nil {
+			WriteJSONError(w, http.StatusInternalServerError, "failed to list api keys")
+			ks.logger.Error(errors.Wrap(err, "failed to list api keys"))
+			return
+		}
+
+		now := time.Now()
+		views := make([]apiKeyView, 0, len(keys))
+		for _, key := range keys {
+			views = append(views, apiKeyView{APIKey: key, State: key.State(now)})
+		}
+		WriteJSONResponse(w, http.StatusOK, views)
+	}
+}
+
+// IssueKeyHandler — выдаёт клиенту дополнительный ключ, не трогая существующие. Ключ возвращается в ответе один раз.
+func (ks *APIKeyService) IssueKeyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientID := r.PathValue("id")
+		rawKey, key, err := apikey.Generate(clientID, time.Now())
+		if err != nil {
+			WriteJSONError(w, http.StatusInternalServerError, "failed to issue api key")
+			ks.logger.Error(errors.Wrap(err, "failed to generate api key"))
+			return
+		}
+
+		if err := ks.repo.CreateAPIKey(r.Context(), key); err != nil {
+			if errors.Is(err, repo.ErrClientNotFound) {
+				WriteJSONError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			WriteJSONError(w, http.StatusInternalServerError, "failed to issue api key")
+			ks.logger.Error(errors.Wrap(err, "failed to issue api key"))
+			return
+		}
+		ks.keys.InvalidateClient(clientID)
+
+		ks.auditor.Record(r.Context(), audit.FromRequest(r), audit.ActionAPIKeyIssue, audit.TargetClient, clientID,
+			nil, map[string]string{"key_prefix": key.Prefix})
+		WriteJSONResponse(w, http.StatusCreated, issuedKeyResponse{ClientID: clientID, APIKey: rawKey, Prefix: key.Prefix})
+		ks.logger.Infow("api key issued", "clientID", clientID, "prefix", key.Prefix)
+	}
+}
+
+// RotateKeyHandler — выдаёт клиенту новый ключ, а все его действующие ключи продолжают работать ещё grace (параметр
+// запроса в формате Go duration, по умолчанию 24h), после чего истекают. grace=0s отключает старые ключи сразу.
+func (ks *APIKeyService) RotateKeyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientID := r.PathValue("id")
+
+		grace := defaultRotationGrace
+		if raw := r.URL.Query().Get("grace"); raw != "" {
+			parsed, err := time.ParseDuration(raw)
+			if err != nil || parsed < 0 {
+				WriteJSONError(w, http.StatusBadRequest, "invalid grace parameter")
+				return
+			}
+			grace = parsed
+		}
+
+		now := time.Now()
+		rawKey, key, err := apikey.Generate(clientID, now)
+		if err != nil {
+			WriteJSONError(w, http.StatusInternalServerError, "failed to rotate api key")
+			ks.logger.Error(errors.Wrap(err, "failed to generate api key"))
+			return
+		}
+
+		graceUntil := now.Add(grace)
+		if err := ks.repo.RotateAPIKey(r.Context(), key, graceUntil); err != nil {
+			if errors.Is(err, repo.ErrClientNotFound) {
+				WriteJSONError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			WriteJSONError(w, http.StatusInternalServerError, "failed to rotate api key")
+			ks.logger.Error(errors.Wrap(err, "failed to rotate api key"))
+			return
+		}
+		ks.keys.InvalidateClient(clientID)
+
+		ks.auditor.Record(r.Context(), audit.FromRequest(r), audit.ActionAPIKeyRotate, audit.TargetClient, clientID,
+			nil, map[string]any{"key_prefix": key.Prefix, "previous_keys_expire_at": graceUntil})
+		WriteJSONResponse(w, http.StatusCreated, issuedKeyResponse{
+			ClientID:  clientID,
+			APIKey:    rawKey,
+			Prefix:    key.Prefix,
+			OldExpire: &graceUntil,
+		})
+		ks.logger.Infow("api key rotated", "clientID", clientID, "prefix", key.Prefix, "grace", grace)
+	}
+}
+
+// RevokeKeyHandler — немедленно отзывает ключ клиента по его префиксу.
+func (ks *APIKeyService) RevokeKeyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientID := r.PathValue("id")
+		prefix := r.PathValue("prefix")
+
+		if err := ks.repo.RevokeAPIKey(r.Context(), clientID, prefix); err != nil {
+			if errors.Is(err, repo.ErrAPIKeyNotFound) {
+				WriteJSONError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			WriteJSONError(w, http.StatusInternalServerError, "failed to revoke api key")
+			ks.logger.Error(errors.Wrap(err, "failed to revoke api key"))
+			return
+		}
+		ks.keys.InvalidateClient(clientID)
+
+		ks.auditor.Record(r.Context(), audit.FromRequest(r), audit.ActionAPIKeyRevoke, audit.TargetClient, clientID,
+			map[string]string{"key_prefix": prefix}, nil)
+		WriteJSONResponse(w, http.StatusOK, map[string]string{"status": "revoked", "key_prefix": prefix})
+		ks.logger.Infow("api key revoked", "clientID", clientID, "prefix", prefix)
+	}
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"load-balancer/internal/models"
+	"load-balancer/internal/repo"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+)
+
+type AuditService struct {
+	repo   repo.Repository
+	logger *zap.SugaredLogger
+}
+
+type auditPage struct {
+	Records    []*models.AuditRecord `json:"records"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+}
+
+// NewAuditService — создаёт сервис чтения журнала административных изменений.
+func NewAuditService(repo repo.Repository, logger *zap.SugaredLogger) *AuditService {
+	return &AuditService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// ListAuditHandler — отдаёт записи журнала от новых к старым постранично. Фильтры передаются параметрами запроса:
+// actor, action, target_type, target, from и to (RFC 3339). Размер страницы задаётся limit, следующая страница
+// запрашивается с cursor из предыдущего ответа.
+func (as *AuditService) ListAuditHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		filter := models.AuditFilter{
+			Actor:      query.Get("actor"),
+			Action:     query.Get("action"),
+			TargetType: query.Get("target_type"),
+			Target:     query.Get("target"),
+			Limit:      defaultAuditPageSize,
+		}
+
+		var err error
+		if filter.From, err = parseTimeParam(query.Get("from")); err != nil {
+			WriteJSONError(w, http.StatusBadRequest, "invalid from parameter")
+			return
+		}
+		if filter.To, err = parseTimeParam(query.Get("to")); err != nil {
+			WriteJSONError(w, http.StatusBadRequest, "invalid to parameter")
+			return
+		}
+		if raw := query.Get("limit"); raw != "" {
+			limit, err := strconv.Atoi(raw)
+			if err != nil || limit <= 0 || limit > maxAuditPageSize {
+				WriteJSONError(w, http.StatusBadRequest, "invalid limit parameter")
+				return
+			}
+			filter.Limit = limit
+		}
+		if raw := query.Get("cursor"); raw != "" {
+			cursor, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || cursor <= 0 {
+				WriteJSONError(w, http.StatusBadRequest, "invalid cursor parameter")
+				return
+			}
+			filter.BeforeID = cursor
+		}
+
+		records, err := as.repo.ListAuditRecords(r.Context(), filter)
+		if err != nil {
+			WriteJSONError(w, http.StatusInternalServerError, "failed to list audit records")
+			as.logger.Error(errors.Wrap(err, "failed to list audit records"))
+			return
+		}
+
+		page := auditPage{Records: records}
+		if page.Records == nil {
+			page.Records = []*models.AuditRecord{}
+		}
+		if len(records) == filter.Limit {
+			page.NextCursor = strconv.FormatInt(records[len(records)-1].ID, 10)
+		}
+		WriteJSONResponse(w, http.StatusOK, page)
+	}
+}
+
+// parseTimeParam — разбирает время в формате RFC 3339; пустая строка означает отсутствие ограничения.
+func parseTimeParam(raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
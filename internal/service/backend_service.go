@@ -0,0 +1,243 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"load-balancer/internal/audit"
+	"load-balancer/internal/models"
+	"load-balancer/internal/upstream"
+	"load-balancer/pkg/balancing_algorithms"
+)
+
+// drainPollInterval — как часто проверяется, завершились ли запросы к бэкенду в состоянии draining.
+const drainPollInterval = 100 * time.Millisecond
+
+// BackendRegistry — пулы, состав которых меняется во время работы. Бэкенды добавляются и убираются через реестр, а не
+// через пул напрямую, чтобы изменение не потерялось при параллельной перезагрузке конфигурации.
+type BackendRegistry interface {
+	PoolRegistry
+	AddBackend(pool string, backend *models.Backend) error
+	RemoveBackend(pool, id string) (*models.Backend, error)
+}
+
+type BackendService struct {
+	pools   BackendRegistry
+	auditor *audit.Auditor
+	logger  *zap.SugaredLogger
+}
+
+// backendAuditState — то, что попадает в журнал изменений о бэкенде: его настройки, без статистики и проверок.
+type backendAuditState struct {
+	URL        string `json:"url"`
+	Weight     int    `json:"weight"`
+	AdminState string `json:"admin_state"`
+}
+
+type addBackendRequest struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// NewBackendService — создаёт сервис управления бэкендами пулов во время работы. Каждое изменение пишется в журнал.
+func NewBackendService(pools BackendRegistry, auditor *audit.Auditor, logger *zap.SugaredLogger) *BackendService {
+	return &BackendService{
+		pools:   pools,
+		auditor: auditor,
+		logger:  logger,
+	}
+}
+
+// GetBackendHandler — возвращает состояние одного бэкенда, в том числе ход вывода его из ротации.
+func (bs *BackendService) GetBackendHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		backend, ok := bs.findBackend(w, r)
+		if !ok {
+			return
+		}
+		WriteJSONResponse(w, http.StatusOK, backend.Status())
+	}
+}
+
+// AddBackendHandler — добавляет бэкенд в пул. Новый бэкенд сразу попадает в ротацию и в проверку доступности и
+// остаётся в пуле после перезагрузки конфигурации, пока пул есть в ней.
+func (bs *BackendService) AddBackendHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pool, ok := bs.findPool(w, r)
+		if !ok {
+			return
+		}
+
+		var req addBackendRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			WriteJSONError(w, http.StatusBadRequest, "invalid request body")
+			bs.logger.Error(errors.Wrap(err, "invalid request body"))
+			return
+		}
+
+		u, err := url.Parse(req.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			WriteJSONError(w, http.StatusBadRequest, "invalid backend url")
+			bs.logger.Errorw("invalid backend url", "url", req.URL)
+			return
+		}
+		if req.Weight < 0 {
+			WriteJSONError(w, http.StatusBadRequest, "invalid backend weight")
+			bs.logger.Errorw("invalid backend weight", "weight", req.Weight)
+			return
+		}
+
+		backend := models.NewBackend(u)
+		if req.Weight > 0 {
+			backend.Weight = req.Weight
+		}
+
+		if err := bs.pools.AddBackend(pool.Name, backend); err != nil {
+			switch {
+			case errors.Is(err, balancing_algorithms.ErrBackendExists):
+				WriteJSONError(w, http.StatusConflict, err.Error())
+			case errors.Is(err, upstream.ErrPoolNotFound):
+				WriteJSONError(w, http.StatusNotFound, "pool not found")
+			default:
+				WriteJSONError(w, http.StatusInternalServerError, "failed to add backend")
+			}
+			bs.logger.Error(errors.Wrap(err, "failed to add backend"))
+			return
+		}
+
+		bs.auditor.Record(r.Context(), audit.FromRequest(r), audit.ActionBackendAdd, audit.TargetBackend,
+			auditTarget(pool.Name, backend), nil, auditState(backend))
+		WriteJSONResponse(w, http.StatusCreated, backend.Status())
+		bs.logger.Infow("backend added", "pool", pool.Name, "url", u.String())
+	}
+}
+
+// RemoveBackendHandler — убирает бэкенд из пула. Запросы, которые он уже обрабатывает, завершатся штатно.
+// Бэкенд из конфигурации вернётся в пул при следующей перезагрузке конфигурации, если его оттуда не убрать.
+func (bs *BackendService) RemoveBackendHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pool, ok := bs.findPool(w, r)
+		if !ok {
+			return
+		}
+
+		id := r.PathValue("backend")
+		backend, err := bs.pools.RemoveBackend(pool.Name, id)
+		if err != nil {
+			WriteJSONError(w, http.StatusNotFound, err.Error())
+			bs.logger.Error(errors.Wrap(err, "failed to remove backend"))
+			return
+		}
+
+		bs.auditor.Record(r.Context(), audit.FromRequest(r), audit.ActionBackendRemove, audit.TargetBackend,
+			auditTarget(pool.Name, backend), auditState(backend), nil)
+		WriteJSONResponse(w, http.StatusOK, map[string]string{"status": "removed", "backend": id})
+		bs.logger.Infow("backend removed", "pool", pool.Name, "url", backend.URL.String(), "in_flight", backend.InFlight())
+	}
+}
+
+// DisableBackendHandler — выводит бэкенд из ротации для обслуживания, не удаляя его из пула.
+func (bs *BackendService) DisableBackendHandler() http.HandlerFunc {
+	return bs.setAdminStateHandler(models.BackendDisabled, audit.ActionBackendDisable)
+}
+
+// EnableBackendHandler — возвращает отключённый или выведенный бэкенд в ротацию.
+func (bs *BackendService) EnableBackendHandler() http.HandlerFunc {
+	return bs.setAdminStateHandler(models.BackendActive, audit.ActionBackendEnable)
+}
+
+func (bs *BackendService) setAdminStateHandler(state, action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		backend, ok := bs.findBackend(w, r)
+		if !ok {
+			return
+		}
+
+		before := auditState(backend)
+		backend.SetAdminState(state)
+		bs.auditor.Record(r.Context(), audit.FromRequest(r), action, audit.TargetBackend,
+			auditTarget(r.PathValue("pool"), backend), before, auditState(backend))
+		WriteJSONResponse(w, http.StatusOK, backend.Status())
+		bs.logger.Infow("backend admin state changed", "pool", r.PathValue("pool"), "url", backend.URL.String(), "state", state)
+	}
+}
+
+// DrainBackendHandler — перестаёт отправлять на бэкенд новые запросы и ждёт в фоне, пока завершатся текущие. Когда
+// запросов не останется, бэкенд переходит в состояние drained, что видно в его статусе и в логе.
+func (bs *BackendService) DrainBackendHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		backend, ok := bs.findBackend(w, r)
+		if !ok {
+			return
+		}
+
+		before := auditState(backend)
+		backend.SetAdminState(models.BackendDraining)
+		bs.auditor.Record(r.Context(), audit.FromRequest(r), audit.ActionBackendDrain, audit.TargetBackend,
+			auditTarget(r.PathValue("pool"), backend), before, auditState(backend))
+		go bs.waitDrained(r.PathValue("pool"), backend)
+
+		WriteJSONResponse(w, http.StatusAccepted, backend.Status())
+		bs.logger.Infow("backend draining started", "pool", r.PathValue("pool"), "url", backend.URL.String(),
+			"in_flight", backend.InFlight())
+	}
+}
+
+// waitDrained — дожидается, пока у бэкенда не останется запросов в работе, и помечает его как drained. Если за это
+// время бэкенд вернули в ротацию или отключили, ожидание прекращается.
+func (bs *BackendService) waitDrained(pool string, backend *models.Backend) {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if backend.AdminState() != models.BackendDraining {
+			return
+		}
+		if backend.InFlight() == 0 {
+			backend.SetAdminState(models.BackendDrained)
+			bs.logger.Infow("backend drained", "pool", pool, "url", backend.URL.String())
+			return
+		}
+	}
+}
+
+// findPool — ищет пул из пути запроса; если его нет, отвечает 404.
+func (bs *BackendService) findPool(w http.ResponseWriter, r *http.Request) (*balancing_algorithms.Pool, bool) {
+	pool := bs.pools.Pool(r.PathValue("pool"))
+	if pool == nil {
+		WriteJSONError(w, http.StatusNotFound, "pool not found")
+		return nil, false
+	}
+	return pool, true
+}
+
+// findBackend — ищет бэкенд из пути запроса; если пула или бэкенда нет, отвечает 404.
+func (bs *BackendService) findBackend(w http.ResponseWriter, r *http.Request) (*models.Backend, bool) {
+	pool, ok := bs.findPool(w, r)
+	if !ok {
+		return nil, false
+	}
+	backend, err := pool.Backend(r.PathValue("backend"))
+	if err != nil {
+		WriteJSONError(w, http.StatusNotFound, err.Error())
+		return nil, false
+	}
+	return backend, true
+}
+
+// auditTarget — идентификатор бэкенда в журнале изменений: пул и хост бэкенда.
+func auditTarget(pool string, backend *models.Backend) string {
+	return pool + "/" + backend.ID()
+}
+
+func auditState(backend *models.Backend) backendAuditState {
+	return backendAuditState{
+		URL:        backend.URL.String(),
+		Weight:     backend.Weight,
+		AdminState: backend.AdminState(),
+	}
+}
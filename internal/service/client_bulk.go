@@ -0,0 +1,105 @@
+package service
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"load-balancer/internal/audit"
+	"load-balancer/internal/clientio"
+)
+
+// maxImportSize — максимальный размер файла импорта, принимаемого через API.
+const maxImportSize = 64 << 20
+
+// ImportClientsHandler — загружает клиентов из тела запроса в формате JSONL или CSV. Формат задаётся параметром format,
+// а если он не указан — по Content-Type. Параметр mode выбирает режим (upsert по умолчанию или create), dry_run=true
+// только проверяет файл. Если хотя бы одна строка содержит ошибку, ничего не записывается и возвращается 422 со
+// списком ошибок по строкам. Созданным клиентам выдаются API-ключи, они возвращаются в ответе один раз.
+func (cs *ClientService) ImportClientsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		format, err := clientio.ParseFormat(requestFormat(r))
+		if err != nil {
+			WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		dryRun := false
+		if raw := query.Get("dry_run"); raw != "" {
+			if dryRun, err = strconv.ParseBool(raw); err != nil {
+				WriteJSONError(w, http.StatusBadRequest, "invalid dry_run parameter")
+				return
+			}
+		}
+
+		report, err := clientio.Import(r.Context(), cs.repo, http.MaxBytesReader(w, r.Body, maxImportSize), clientio.ImportOptions{
+			Format: format,
+			Mode:   query.Get("mode"),
+			DryRun: dryRun,
+		})
+		var inputErr *clientio.InputError
+		if errors.As(err, &inputErr) {
+			WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			WriteJSONError(w, http.StatusInternalServerError, "failed to import clients")
+			cs.logger.Error(errors.Wrap(err, "failed to import clients"))
+			return
+		}
+
+		if len(report.Errors) > 0 {
+			WriteJSONResponse(w, http.StatusUnprocessableEntity, report)
+			return
+		}
+		if !report.DryRun {
+			for _, change := range report.Changes {
+				cs.cache.Invalidate(change.ClientID)
+			}
+			report.RecordAudit(r.Context(), cs.auditor, audit.FromRequest(r))
+			cs.logger.Infow("imported clients", "created", report.Created, "updated", report.Updated)
+		}
+		WriteJSONResponse(w, http.StatusOK, report)
+	}
+}
+
+// ExportClientsHandler — отдаёт всех клиентов в формате JSONL или CSV (параметр format). Данные отправляются по мере
+// чтения из БД, поэтому выгрузка не держит таблицу в памяти.
+func (cs *ClientService) ExportClientsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, err := clientio.ParseFormat(r.URL.Query().Get("format"))
+		if err != nil {
+			WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		contentType := "application/x-ndjson"
+		if format == clientio.FormatCSV {
+			contentType = "text/csv"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="clients.`+format+`"`)
+
+		count, err := clientio.Export(r.Context(), cs.repo, w, format)
+		if err != nil {
+			// Заголовки и часть данных уже отправлены, поэтому об ошибке остаётся только написать в лог.
+			cs.logger.Errorw("failed to export clients", "error", err, "exported", count)
+			return
+		}
+		cs.logger.Infow("exported clients", "count", count, "format", format)
+	}
+}
+
+// requestFormat — формат файла импорта из параметра format или из Content-Type.
+func requestFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "text/csv" {
+		return clientio.FormatCSV
+	}
+	return ""
+}
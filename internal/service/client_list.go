@@ -0,0 +1,153 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"load-balancer/internal/models"
+)
+
+type clientListResponse struct {
+	Clients    []*models.RateLimitClient `json:"clients"`
+	Total      int64                     `json:"total"`
+	NextCursor string                    `json:"next_cursor,omitempty"`
+}
+
+// clientCursor — положение в выдаче: ID последнего клиента страницы и значение поля сортировки у него. Сортировка,
+// её направление и хэш фильтров запоминаются, чтобы курсор нельзя было применить к другой выдаче.
+type clientCursor struct {
+	SortBy string  `json:"s"`
+	Desc   bool    `json:"d,omitempty"`
+	Filter string  `json:"f"`
+	ID     string  `json:"id"`
+	Value  float64 `json:"v,omitempty"`
+}
+
+// parseClientListQuery — разбирает фильтры, сортировку и курсор из параметров запроса списка клиентов.
+func parseClientListQuery(query url.Values) (models.ClientFilter, models.ClientPage, error) {
+	filter := models.ClientFilter{IDPrefix: query.Get("prefix"), Plan: query.Get("plan")}
+	page := models.ClientPage{SortBy: models.ClientSortID, Limit: defaultClientPageSize}
+
+	capacityRanges := []struct {
+		param string
+		dst   **int64
+	}{
+		{"min_capacity", &filter.MinCapacity},
+		{"max_capacity", &filter.MaxCapacity},
+	}
+	for _, rng := range capacityRanges {
+		raw := query.Get(rng.param)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return filter, page, errors.Errorf("invalid %s parameter", rng.param)
+		}
+		*rng.dst = &value
+	}
+
+	rateRanges := []struct {
+		param string
+		dst   **float64
+	}{
+		{"min_rate", &filter.MinRate},
+		{"max_rate", &filter.MaxRate},
+	}
+	for _, rng := range rateRanges {
+		raw := query.Get(rng.param)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return filter, page, errors.Errorf("invalid %s parameter", rng.param)
+		}
+		*rng.dst = &value
+	}
+
+	for _, raw := range query["label"] {
+		key, value, ok := strings.Cut(raw, "=")
+		if !ok || key == "" {
+			return filter, page, errors.New("invalid label parameter, expected key=value")
+		}
+		if filter.Labels == nil {
+			filter.Labels = make(map[string]string)
+		}
+		filter.Labels[key] = value
+	}
+
+	if status := query.Get("status"); status != "" {
+		if !models.ValidClientStatus(status) {
+			return filter, page, errors.New("invalid status parameter")
+		}
+		filter.Status = status
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		page.Desc = strings.HasPrefix(sort, "-")
+		page.SortBy = strings.TrimPrefix(sort, "-")
+		switch page.SortBy {
+		case models.ClientSortID, models.ClientSortCapacity, models.ClientSortRate, models.ClientSortTokens:
+		default:
+			return filter, page, errors.New("invalid sort parameter")
+		}
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > maxClientPageSize {
+			return filter, page, errors.New("invalid limit parameter")
+		}
+		page.Limit = limit
+	}
+
+	if raw := query.Get("cursor"); raw != "" {
+		cursor, err := decodeClientCursor(raw)
+		if err != nil || cursor.SortBy != page.SortBy || cursor.Desc != page.Desc || cursor.Filter != filterHash(filter) {
+			return filter, page, errors.New("invalid cursor parameter")
+		}
+		page.HasCursor = true
+		page.AfterID = cursor.ID
+		page.AfterValue = cursor.Value
+	}
+
+	return filter, page, nil
+}
+
+func encodeClientCursor(filter models.ClientFilter, page models.ClientPage, last *models.RateLimitClient) string {
+	cursor := clientCursor{SortBy: page.SortBy, Desc: page.Desc, Filter: filterHash(filter), ID: last.ClientID}
+	switch page.SortBy {
+	case models.ClientSortCapacity:
+		cursor.Value = float64(last.Capacity)
+	case models.ClientSortRate:
+		cursor.Value = last.RatePerSecond
+	case models.ClientSortTokens:
+		cursor.Value = last.Tokens
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// filterHash — короткий отпечаток фильтров выдачи. JSON подходит для этого, потому что метки в нём упорядочены
+// по ключу.
+func filterHash(filter models.ClientFilter) string {
+	data, _ := json.Marshal(filter)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:8])
+}
+
+func decodeClientCursor(raw string) (clientCursor, error) {
+	var cursor clientCursor
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(data, &cursor)
+	return cursor, err
+}
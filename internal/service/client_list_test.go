@@ -0,0 +1,132 @@
+package service
+
+import (
+	"encoding/base64"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"load-balancer/internal/models"
+)
+
+func TestClientCursorRoundTrip(t *testing.T) {
+	last := &models.RateLimitClient{ClientID: "team-a/42", Capacity: 100, RatePerSecond: 2.5, Tokens: 7.25}
+	filter := models.ClientFilter{IDPrefix: "team-a"}
+	hash := filterHash(filter)
+
+	tests := []struct {
+		sortBy string
+		desc   bool
+		want   clientCursor
+	}{
+		{sortBy: models.ClientSortID, want: clientCursor{SortBy: models.ClientSortID, Filter: hash, ID: "team-a/42"}},
+		{
+			sortBy: models.ClientSortCapacity, desc: true,
+			want: clientCursor{SortBy: models.ClientSortCapacity, Desc: true, Filter: hash, ID: "team-a/42", Value: 100},
+		},
+		{sortBy: models.ClientSortRate, want: clientCursor{SortBy: models.ClientSortRate, Filter: hash, ID: "team-a/42", Value: 2.5}},
+		{sortBy: models.ClientSortTokens, want: clientCursor{SortBy: models.ClientSortTokens, Filter: hash, ID: "team-a/42", Value: 7.25}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sortBy, func(t *testing.T) {
+			raw := encodeClientCursor(filter, models.ClientPage{SortBy: tt.sortBy, Desc: tt.desc}, last)
+			if _, err := url.ParseQuery("cursor=" + raw); err != nil {
+				t.Fatalf("cursor %q is not URL-safe: %v", raw, err)
+			}
+			got, err := decodeClientCursor(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("cursor = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeClientCursorInvalid(t *testing.T) {
+	for _, raw := range []string{"not base64!", base64.RawURLEncoding.EncodeToString([]byte("not json"))} {
+		if _, err := decodeClientCursor(raw); err == nil {
+			t.Errorf("decodeClientCursor(%q) succeeded", raw)
+		}
+	}
+}
+
+func TestParseClientListQuery(t *testing.T) {
+	minCapacity := int64(10)
+	maxRate := 1.5
+	last := &models.RateLimitClient{ClientID: "c", Capacity: 20}
+	capacityCursor := encodeClientCursor(models.ClientFilter{}, models.ClientPage{SortBy: models.ClientSortCapacity, Desc: true}, last)
+	labelCursor := encodeClientCursor(models.ClientFilter{Labels: map[string]string{"env": "prod", "team": "a"}},
+		models.ClientPage{SortBy: models.ClientSortID}, last)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantFilter models.ClientFilter
+		wantPage   models.ClientPage
+		wantErr    bool
+	}{
+		{
+			name:     "defaults",
+			wantPage: models.ClientPage{SortBy: models.ClientSortID, Limit: defaultClientPageSize},
+		},
+		{
+			name:  "filters",
+			query: "prefix=team&min_capacity=10&max_rate=1.5&label=env=prod&status=active&plan=pro",
+			wantFilter: models.ClientFilter{
+				IDPrefix: "team", MinCapacity: &minCapacity, MaxRate: &maxRate,
+				Labels: map[string]string{"env": "prod"}, Status: models.ClientActive, Plan: "pro",
+			},
+			wantPage: models.ClientPage{SortBy: models.ClientSortID, Limit: defaultClientPageSize},
+		},
+		{
+			name:  "sort descending with cursor",
+			query: "sort=-capacity&limit=5&cursor=" + capacityCursor,
+			wantPage: models.ClientPage{
+				SortBy: models.ClientSortCapacity, Desc: true, HasCursor: true, AfterID: "c", AfterValue: 20, Limit: 5,
+			},
+		},
+		{
+			name:       "cursor with the same label filter",
+			query:      "label=team=a&label=env=prod&cursor=" + labelCursor,
+			wantFilter: models.ClientFilter{Labels: map[string]string{"env": "prod", "team": "a"}},
+			wantPage:   models.ClientPage{SortBy: models.ClientSortID, HasCursor: true, AfterID: "c", Limit: defaultClientPageSize},
+		},
+		{name: "cursor from another sort", query: "sort=-tokens&cursor=" + capacityCursor, wantErr: true},
+		{name: "cursor from another direction", query: "sort=capacity&cursor=" + capacityCursor, wantErr: true},
+		{name: "cursor from another filter", query: "sort=-capacity&prefix=team&cursor=" + capacityCursor, wantErr: true},
+		{name: "cursor from another label filter", query: "label=env=prod&cursor=" + labelCursor, wantErr: true},
+		{name: "invalid capacity", query: "min_capacity=ten", wantErr: true},
+		{name: "invalid label", query: "label=env", wantErr: true},
+		{name: "invalid status", query: "status=deleted", wantErr: true},
+		{name: "invalid sort", query: "sort=labels", wantErr: true},
+		{name: "limit too large", query: "limit=100000", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			filter, page, err := parseClientListQuery(values)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(filter, tt.wantFilter) {
+				t.Errorf("filter = %+v, want %+v", filter, tt.wantFilter)
+			}
+			if page != tt.wantPage {
+				t.Errorf("page = %+v, want %+v", page, tt.wantPage)
+			}
+		})
+	}
+}
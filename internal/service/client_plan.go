@@ -0,0 +1,136 @@
+package service
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+	"load-balancer/internal/models"
+	"load-balancer/internal/repo"
+)
+
+// rateFields — поля запроса, которые задают скорость клиента; у клиента плана они переопределяются вместе.
+var rateFields = []string{"rate", "rate_per_second", "rate_period"}
+
+// findPlan — возвращает план по имени. Если плана нет, отвечает 400, если его не удалось получить — 500.
+func (cs *ClientService) findPlan(w http.ResponseWriter, r *http.Request, name string) (*models.Plan, bool) {
+	plan, err := cs.repo.GetPlan(r.Context(), name)
+	if errors.Is(err, repo.ErrPlanNotFound) {
+		WriteJSONError(w, http.StatusBadRequest, "unknown plan")
+		return nil, false
+	}
+	if err != nil {
+		WriteJSONError(w, http.StatusInternalServerError, "failed to get plan")
+		cs.logger.Error(errors.Wrap(err, "failed to get plan"))
+		return nil, false
+	}
+	return plan, true
+}
+
+// createOverrides — переопределения плана из лимитов, указанных при создании клиента плана. Незаданные лимиты
+// берутся из плана.
+func createOverrides(client *models.RateLimitClient) (*models.LimitOverrides, error) {
+	var o models.LimitOverrides
+	if client.Capacity != 0 {
+		capacity := client.Capacity
+		o.Capacity = &capacity
+	}
+	switch {
+	case client.Rate != 0 || client.RatePerSecond != 0:
+		if err := client.NormalizeRate(); err != nil {
+			return nil, err
+		}
+		rate, period := client.Rate, client.RatePeriod
+		o.Rate, o.RatePeriod = &rate, &period
+	case client.RatePeriod != 0:
+		return nil, errors.New("rate_period requires rate")
+	}
+	if client.Algorithm != "" {
+		algorithm := client.Algorithm
+		o.Algorithm = &algorithm
+	}
+	if o.Empty() {
+		return nil, nil
+	}
+	return &o, nil
+}
+
+// applyPlanUpdates — применяет к клиенту поле plan из PATCH-запроса и пересчитывает его переопределения и действующие
+// лимиты. Лимиты в client уже содержат новые значения из запроса. Клиент, отвязанный от плана, сохраняет действующие
+// лимиты как собственные; клиент, впервые получивший план, теряет собственные лимиты, кроме заданных в этом же
+// запросе. Отвечает ошибкой и возвращает false, если запрос применить нельзя.
+func (cs *ClientService) applyPlanUpdates(w http.ResponseWriter, r *http.Request, client *models.RateLimitClient,
+	updates map[string]interface{}) bool {
+	planName := client.Plan
+	if raw, ok := updates["plan"]; ok {
+		name, isString := raw.(string)
+		if raw != nil && !isString {
+			WriteJSONError(w, http.StatusBadRequest, "invalid plan")
+			return false
+		}
+		planName = name
+	}
+
+	if planName == "" {
+		for _, field := range append([]string{"capacity", "algorithm"}, rateFields...) {
+			if value, ok := updates[field]; ok && value == nil {
+				WriteJSONError(w, http.StatusBadRequest, field+" can be reset only for clients with a plan")
+				return false
+			}
+		}
+		client.DetachPlan()
+		return true
+	}
+
+	plan, ok := cs.findPlan(w, r, planName)
+	if !ok {
+		return false
+	}
+	client.Overrides = updateOverrides(client, updates, client.Plan != "")
+	client.ApplyPlan(plan)
+	return true
+}
+
+// updateOverrides — переопределения клиента плана после PATCH-запроса: заданный в запросе лимит переопределяется
+// значением из client, null убирает переопределение. Если keep, остальные переопределения сохраняются.
+func updateOverrides(client *models.RateLimitClient, updates map[string]interface{}, keep bool) *models.LimitOverrides {
+	var o models.LimitOverrides
+	if keep && client.Overrides != nil {
+		o = *client.Overrides
+	}
+
+	if value, ok := updates["capacity"]; ok {
+		o.Capacity = nil
+		if _, isNumber := value.(float64); isNumber {
+			capacity := client.Capacity
+			o.Capacity = &capacity
+		}
+	}
+
+	rateSet, rateReset := false, false
+	for _, field := range rateFields {
+		if value, ok := updates[field]; ok {
+			rateSet = rateSet || value != nil
+			rateReset = rateReset || value == nil
+		}
+	}
+	switch {
+	case rateSet:
+		rate, period := client.Rate, client.RatePeriod
+		o.Rate, o.RatePeriod = &rate, &period
+	case rateReset:
+		o.Rate, o.RatePeriod = nil, nil
+	}
+
+	if value, ok := updates["algorithm"]; ok {
+		o.Algorithm = nil
+		if _, isString := value.(string); isString {
+			algorithm := client.Algorithm
+			o.Algorithm = &algorithm
+		}
+	}
+
+	if o.Empty() {
+		return nil
+	}
+	return &o
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"load-balancer/internal/audit"
+	"load-balancer/internal/models"
+	"load-balancer/internal/repo"
+)
+
+type clientQuotasRequest struct {
+	Quotas []models.ClientQuota `json:"quotas"`
+}
+
+// SetQuotasHandler — заменяет квоты клиента: {"quotas": [{"period": "day", "limit": 100000, "time_zone":
+// "Europe/Moscow"}]}. period — day, week или month, не больше одной квоты на период; time_zone необязателен
+// (по умолчанию UTC). Расход квот с прежними периодами сохраняется, пустой список снимает все квоты. Изменение
+// применяется к запросам клиента сразу.
+func (cs *ClientService) SetQuotasHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+
+		var req clientQuotasRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			WriteJSONError(w, http.StatusBadRequest, "invalid request body")
+			cs.logger.Error(errors.Wrap(err, "invalid request body"))
+			return
+		}
+		periods := make(map[string]bool, len(req.Quotas))
+		for i := range req.Quotas {
+			quota := &req.Quotas[i]
+			if err := quota.Validate(); err != nil {
+				WriteJSONError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if periods[quota.Period] {
+				WriteJSONError(w, http.StatusBadRequest, "duplicate quota period "+quota.Period)
+				return
+			}
+			periods[quota.Period] = true
+		}
+
+		if _, err := cs.repo.GetClientByID(r.Context(), id); err != nil {
+			if errors.Is(err, repo.ErrClientNotFound) {
+				WriteJSONError(w, http.StatusNotFound, "client not found")
+				return
+			}
+			WriteJSONError(w, http.StatusInternalServerError, "failed to get client")
+			cs.logger.Error(errors.Wrap(err, "failed to get client"))
+			return
+		}
+		before, err := cs.quotas(r, id)
+		if err != nil {
+			WriteJSONError(w, http.StatusInternalServerError, "failed to get client quotas")
+			cs.logger.Error(errors.Wrap(err, "failed to get client quotas"))
+			return
+		}
+		if err := cs.repo.SetClientQuotas(r.Context(), id, req.Quotas); err != nil {
+			if errors.Is(err, repo.ErrClientNotFound) {
+				WriteJSONError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			WriteJSONError(w, http.StatusInternalServerError, "failed to update client quotas")
+			cs.logger.Error(errors.Wrap(err, "failed to update client quotas"))
+			return
+		}
+		cs.cache.Invalidate(id)
+
+		after, err := cs.quotas(r, id)
+		if err != nil {
+			WriteJSONError(w, http.StatusInternalServerError, "failed to get client quotas")
+			cs.logger.Error(errors.Wrap(err, "failed to get client quotas"))
+			return
+		}
+		if after == nil {
+			after = []models.ClientQuota{}
+		}
+		cs.auditor.Record(r.Context(), audit.FromRequest(r), audit.ActionClientQuotas, audit.TargetClient, id, before, after)
+		WriteJSONResponse(w, http.StatusOK, map[string]any{"clientID": id, "quotas": after})
+		cs.logger.Infow("client quotas changed", "clientID", id, "quotas", len(req.Quotas))
+	}
+}
+
+// quotas — квоты клиента с расходом, остатком и временем сброса в текущем окне.
+func (cs *ClientService) quotas(r *http.Request, clientID string) ([]models.ClientQuota, error) {
+	quotas, err := cs.repo.ListClientQuotas(r.Context(), clientID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range quotas {
+		quotas[i].Fill(now)
+	}
+	return quotas, nil
+}
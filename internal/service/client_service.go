@@ -4,26 +4,50 @@ import (
 	"encoding/json"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"load-balancer/internal/apikey"
+	"load-balancer/internal/audit"
 	"load-balancer/internal/models"
 	"load-balancer/internal/repo"
 	"net/http"
 	"time"
 )
 
+const (
+	defaultClientPageSize = 50
+	maxClientPageSize     = 1000
+)
+
+// ClientCache — кеш состояния клиентов в памяти, который нужно сбрасывать после изменения клиента.
+type ClientCache interface {
+	Invalidate(clientID string)
+}
+
 type ClientService struct {
-	logger *zap.SugaredLogger
-	repo   repo.Repository
+	logger  *zap.SugaredLogger
+	repo    repo.Repository
+	cache   ClientCache
+	auditor *audit.Auditor
+}
+
+type clientStatusRequest struct {
+	Status    string          `json:"status"`
+	ExpiresAt json.RawMessage `json:"expires_at"`
 }
 
-// NewClientService — создаёт новый сервис для работы с клиентами, принимая репозиторий и логгер.
-func NewClientService(repo repo.Repository, logger *zap.SugaredLogger) *ClientService {
+// NewClientService — создаёт новый сервис для работы с клиентами, принимая репозиторий, кеш клиентов рейт-лимитера,
+// журнал изменений и логгер.
+func NewClientService(repo repo.Repository, cache ClientCache, auditor *audit.Auditor, logger *zap.SugaredLogger) *ClientService {
 	return &ClientService{
-		repo:   repo,
-		logger: logger,
+		repo:    repo,
+		cache:   cache,
+		auditor: auditor,
+		logger:  logger,
 	}
 }
 
-// CreateClientHandler — обрабатывает POST-запросы, создаёт клиента с заданными параметрами и сохраняет в БД.
+// CreateClientHandler — обрабатывает POST-запросы, создаёт клиента с заданными параметрами и сохраняет в БД вместе
+// с первым API-ключом. Ключ возвращается в ответе один раз, в БД хранится только его хэш. Клиент с plan получает
+// лимиты плана; указанные вместе с планом capacity, rate и algorithm переопределяют лимиты плана для этого клиента.
 func (cs *ClientService) CreateClientHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req models.RateLimitClient
@@ -34,39 +58,84 @@ func (cs *ClientService) CreateClientHandler() http.HandlerFunc {
 			return
 		}
 
-		if req.ClientID == "" || req.Capacity <= 0 || req.RatePerSecond <= 0 {
+		if req.Status == "" {
+			req.Status = models.ClientActive
+		}
+		if req.Plan != "" {
+			overrides, err := createOverrides(&req)
+			if err != nil {
+				WriteJSONError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			plan, ok := cs.findPlan(w, r, req.Plan)
+			if !ok {
+				return
+			}
+			req.Overrides = overrides
+			req.ApplyPlan(plan)
+		} else {
+			req.Overrides = nil
+			if req.Algorithm == "" {
+				req.Algorithm = models.AlgorithmTokenBucket
+			}
+			if err := req.NormalizeRate(); err != nil {
+				WriteJSONError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		if req.ClientID == "" || req.Capacity <= 0 || !models.ValidClientStatus(req.Status) || !models.ValidAlgorithm(req.Algorithm) {
 			WriteJSONError(w, http.StatusBadRequest, "invalid client data")
 			cs.logger.Error(errors.Wrap(err, "invalid client data"))
 			return
 		}
 
-		req.Tokens = req.Capacity
-		req.LastRefillAt = time.Now().Unix()
+		now := time.Now()
+		req.Tokens = float64(req.Capacity)
+		req.LastRefillAt = now
 
-		if err := cs.repo.CreateClient(r.Context(), req); err != nil {
+		rawKey, key, err := apikey.Generate(req.ClientID, now)
+		if err != nil {
+			WriteJSONError(w, http.StatusInternalServerError, "failed to create client")
+			cs.logger.Error(errors.Wrap(err, "failed to generate api key"))
+			return
+		}
+
+		if err := cs.repo.CreateClientWithKey(r.Context(), req, key); err != nil {
 			WriteJSONError(w, http.StatusInternalServerError, "failed to create client")
 			cs.logger.Error(errors.Wrap(err, "failed to create client"))
 			return
 		}
 
-		WriteJSONResponse(w, http.StatusCreated, map[string]string{"status": "created", "clientID": req.ClientID})
+		cs.auditor.Record(r.Context(), audit.FromRequest(r), audit.ActionClientCreate, audit.TargetClient, req.ClientID, nil, req)
+		WriteJSONResponse(w, http.StatusCreated, map[string]string{
+			"status":     "created",
+			"clientID":   req.ClientID,
+			"api_key":    rawKey,
+			"key_prefix": key.Prefix,
+		})
 		cs.logger.Infow("created client", "clientID", req.ClientID)
 	}
 }
 
-// GetClientHandler — возвращает данные клиента по ID или 404, если не найден.
+// GetClientHandler — возвращает данные клиента по ID или 404, если не найден. Вместе с клиентом возвращаются его
+// квоты с расходом в текущем окне; расход других инстансов учитывается с задержкой до quota_sync_interval.
 func (cs *ClientService) GetClientHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := r.PathValue("id")
 		client, err := cs.repo.GetClientByID(r.Context(), id)
+		if errors.Is(err, repo.ErrClientNotFound) {
+			WriteJSONError(w, http.StatusNotFound, "client not found")
+			return
+		}
 		if err != nil {
 			WriteJSONError(w, http.StatusInternalServerError, "failed to get client")
 			cs.logger.Error(errors.Wrap(err, "failed to get client"))
 			return
 		}
-		if client == nil {
-			WriteJSONError(w, http.StatusNotFound, "client not found")
-			cs.logger.Error(errors.New("client not found"))
+		client.Quotas, err = cs.quotas(r, id)
+		if err != nil {
+			WriteJSONError(w, http.StatusInternalServerError, "failed to get client quotas")
+			cs.logger.Error(errors.Wrap(err, "failed to get client quotas"))
 			return
 		}
 		WriteJSONResponse(w, http.StatusOK, client)
@@ -74,7 +143,10 @@ func (cs *ClientService) GetClientHandler() http.HandlerFunc {
 	}
 }
 
-// UpdateClientHandler — частично обновляет данные клиента (capacity, rate_per_second и т.д.) на основе JSON-запроса.
+// UpdateClientHandler — частично обновляет данные клиента (capacity, rate и rate_period и т.д.) на основе JSON-запроса.
+// rate_per_second принимается, как раньше, и означает rate за секунду. plan переводит клиента на план, null или пустая
+// строка отвязывают его от плана. У клиента плана заданные лимиты переопределяют лимиты плана, а null возвращает
+// лимит плана.
 func (cs *ClientService) UpdateClientHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := r.PathValue("id")
@@ -93,26 +165,59 @@ func (cs *ClientService) UpdateClientHandler() http.HandlerFunc {
 		}
 
 		existingClient, err := cs.repo.GetClientByID(r.Context(), id)
+		if errors.Is(err, repo.ErrClientNotFound) {
+			WriteJSONError(w, http.StatusNotFound, "client not found")
+			return
+		}
 		if err != nil {
 			WriteJSONError(w, http.StatusInternalServerError, "failed to get client")
 			cs.logger.Error(errors.Wrap(err, "failed to get client"))
 			return
 		}
-		if existingClient == nil {
-			WriteJSONError(w, http.StatusNotFound, "client not found")
-			cs.logger.Error(errors.New("client not found"))
-			return
-		}
 
+		before := *existingClient
 		if cap, ok := updates["capacity"].(float64); ok {
 			existingClient.Capacity = int64(cap)
 		}
 		if rate, ok := updates["rate_per_second"].(float64); ok {
-			existingClient.RatePerSecond = int64(rate)
+			existingClient.Rate, existingClient.RatePeriod, existingClient.RatePerSecond = 0, 0, rate
+		}
+		if rate, ok := updates["rate"].(float64); ok {
+			existingClient.Rate = int64(rate)
+		}
+		if raw, ok := updates["rate_period"].(string); ok {
+			period, err := time.ParseDuration(raw)
+			if err != nil {
+				WriteJSONError(w, http.StatusBadRequest, "invalid rate_period")
+				return
+			}
+			existingClient.RatePeriod = models.Duration(period)
+		}
+		if err := existingClient.NormalizeRate(); err != nil {
+			WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
 		}
 		if tokens, ok := updates["tokens"].(float64); ok {
-			existingClient.Tokens = int64(tokens)
-			existingClient.LastRefillAt = time.Now().Unix()
+			existingClient.Tokens = tokens
+			existingClient.LastRefillAt = time.Now()
+		}
+		if algorithm, ok := updates["algorithm"].(string); ok {
+			if !models.ValidAlgorithm(algorithm) {
+				WriteJSONError(w, http.StatusBadRequest, "unknown rate limit algorithm")
+				return
+			}
+			existingClient.Algorithm = algorithm
+		}
+		if labels, ok := updates["labels"].(map[string]interface{}); ok {
+			existingClient.Labels = make(map[string]string, len(labels))
+			for key, value := range labels {
+				if str, ok := value.(string); ok {
+					existingClient.Labels[key] = str
+				}
+			}
+		}
+		if !cs.applyPlanUpdates(w, r, existingClient, updates) {
+			return
 		}
 
 		if err := cs.repo.UpdateClient(r.Context(), *existingClient); err != nil {
@@ -120,21 +225,132 @@ func (cs *ClientService) UpdateClientHandler() http.HandlerFunc {
 			cs.logger.Error(errors.Wrap(err, "failed to update client"))
 			return
 		}
+		cs.cache.Invalidate(id)
+		cs.auditor.Record(r.Context(), audit.FromRequest(r), audit.ActionClientUpdate, audit.TargetClient, id, before, *existingClient)
 		WriteJSONResponse(w, http.StatusOK, map[string]string{"status": "updated", "clientID": id})
 		cs.logger.Infow("updated client", "clientID", id)
 	}
 }
 
+// SetStatusHandler — меняет статус клиента (active, suspended, disabled) и срок его действия expires_at (RFC 3339,
+// null снимает ограничение). Поля необязательны, но хотя бы одно должно быть задано. Изменение применяется к
+// запросам клиента сразу.
+func (cs *ClientService) SetStatusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+
+		var req clientStatusRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			WriteJSONError(w, http.StatusBadRequest, "invalid request body")
+			cs.logger.Error(errors.Wrap(err, "invalid request body"))
+			return
+		}
+		if req.Status == "" && req.ExpiresAt == nil {
+			WriteJSONError(w, http.StatusBadRequest, "no fields to update")
+			return
+		}
+		if req.Status != "" && !models.ValidClientStatus(req.Status) {
+			WriteJSONError(w, http.StatusBadRequest, "invalid status")
+			return
+		}
+
+		existingClient, err := cs.repo.GetClientByID(r.Context(), id)
+		if errors.Is(err, repo.ErrClientNotFound) {
+			WriteJSONError(w, http.StatusNotFound, "client not found")
+			return
+		}
+		if err != nil {
+			WriteJSONError(w, http.StatusInternalServerError, "failed to get client")
+			cs.logger.Error(errors.Wrap(err, "failed to get client"))
+			return
+		}
+
+		before := map[string]any{"status": existingClient.Status, "expires_at": existingClient.ExpiresAt}
+		status, expiresAt := existingClient.Status, existingClient.ExpiresAt
+		if req.Status != "" {
+			status = req.Status
+		}
+		if req.ExpiresAt != nil {
+			expiresAt = nil
+			if err := json.Unmarshal(req.ExpiresAt, &expiresAt); err != nil {
+				WriteJSONError(w, http.StatusBadRequest, "invalid expires_at")
+				return
+			}
+		}
+
+		if err := cs.repo.SetClientLifecycle(r.Context(), id, status, expiresAt); err != nil {
+			if errors.Is(err, repo.ErrClientNotFound) {
+				WriteJSONError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			WriteJSONError(w, http.StatusInternalServerError, "failed to update client status")
+			cs.logger.Error(errors.Wrap(err, "failed to update client status"))
+			return
+		}
+		cs.cache.Invalidate(id)
+
+		after := map[string]any{"status": status, "expires_at": expiresAt}
+		cs.auditor.Record(r.Context(), audit.FromRequest(r), audit.ActionClientStatus, audit.TargetClient, id, before, after)
+		WriteJSONResponse(w, http.StatusOK, map[string]any{"clientID": id, "status": status, "expires_at": expiresAt})
+		cs.logger.Infow("client status changed", "clientID", id, "status", status, "expires_at", expiresAt)
+	}
+}
+
 // DeleteClientHandler — удаляет клиента из БД по ID.
 func (cs *ClientService) DeleteClientHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := r.PathValue("id")
+
+		var before any
+		if existingClient, err := cs.repo.GetClientByID(r.Context(), id); err == nil {
+			before = *existingClient
+		}
+
 		if err := cs.repo.DeleteClient(r.Context(), id); err != nil {
 			WriteJSONError(w, http.StatusInternalServerError, "failed to delete client")
 			cs.logger.Error(errors.Wrap(err, "failed to delete client"))
 			return
 		}
+		cs.cache.Invalidate(id)
+		cs.auditor.Record(r.Context(), audit.FromRequest(r), audit.ActionClientDelete, audit.TargetClient, id, before, nil)
 		WriteJSONResponse(w, http.StatusOK, map[string]string{"status": "deleted", "clientID": id})
 		cs.logger.Infow("deleted client", "clientID", id)
 	}
 }
+
+// ListClientsHandler — отдаёт список клиентов постранично вместе с общим числом подходящих под фильтр. Фильтры
+// передаются параметрами запроса: prefix (префикс ID), min_capacity, max_capacity, min_rate, max_rate, status, plan
+// и label вида key=value (можно указать несколько). Лимиты фильтруются по действующим значениям с учётом плана. Сортировка задаётся sort — client_id, capacity, rate_per_second или tokens,
+// с минусом впереди для обратного порядка. Следующая страница запрашивается с cursor из предыдущего ответа и теми же
+// фильтрами и сортировкой; курсор от другой выдачи отклоняется.
+func (cs *ClientService) ListClientsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, page, err := parseClientListQuery(r.URL.Query())
+		if err != nil {
+			WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		clients, err := cs.repo.ListClients(r.Context(), filter, page)
+		if err != nil {
+			WriteJSONError(w, http.StatusInternalServerError, "failed to list clients")
+			cs.logger.Error(errors.Wrap(err, "failed to list clients"))
+			return
+		}
+		total, err := cs.repo.CountClients(r.Context(), filter)
+		if err != nil {
+			WriteJSONError(w, http.StatusInternalServerError, "failed to count clients")
+			cs.logger.Error(errors.Wrap(err, "failed to count clients"))
+			return
+		}
+
+		response := clientListResponse{Clients: clients, Total: total}
+		if response.Clients == nil {
+			response.Clients = []*models.RateLimitClient{}
+		}
+		if len(clients) == page.Limit {
+			response.NextCursor = encodeClientCursor(filter, page, clients[len(clients)-1])
+		}
+		WriteJSONResponse(w, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+	"load-balancer/internal/repo"
+)
+
+// readinessTimeout — сколько ждать ответа БД при проверке готовности.
+const readinessTimeout = 2 * time.Second
+
+type HealthService struct {
+	repo         repo.Repository
+	pools        PoolRegistry
+	shuttingDown func() bool
+	logger       *zap.SugaredLogger
+}
+
+type checkResult struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type readinessResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// NewHealthService — создаёт сервис проверок живости и готовности самого балансировщика.
+func NewHealthService(repo repo.Repository, pools PoolRegistry, shuttingDown func() bool, logger *zap.SugaredLogger) *HealthService {
+	return &HealthService{
+		repo:         repo,
+		pools:        pools,
+		shuttingDown: shuttingDown,
+		logger:       logger,
+	}
+}
+
+// LivenessHandler — отвечает 200, пока процесс жив и обрабатывает запросы.
+func (hs *HealthService) LivenessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		WriteJSONResponse(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+// ReadinessHandler — отвечает 200, только если доступна БД, в каждом пуле есть хотя бы один доступный бэкенд и
+// сервис не останавливается. Иначе отвечает 503 с разбивкой по проверкам.
+func (hs *HealthService) ReadinessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := readinessResponse{Status: "ok", Checks: make(map[string]checkResult)}
+
+		if hs.shuttingDown() {
+			resp.Checks["shutdown"] = checkResult{OK: false, Error: "service is shutting down"}
+		} else {
+			resp.Checks["shutdown"] = checkResult{OK: true}
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+		if err := hs.repo.Ping(ctx); err != nil {
+			resp.Checks["postgres"] = checkResult{OK: false, Error: err.Error()}
+		} else {
+			resp.Checks["postgres"] = checkResult{OK: true}
+		}
+
+		for _, pool := range hs.pools.Pools() {
+			result := checkResult{OK: false, Error: "no available backends"}
+			for _, backend := range pool.Backends() {
+				if backend.Routable() {
+					result = checkResult{OK: true}
+					break
+				}
+			}
+			resp.Checks["pool:"+pool.Name] = result
+		}
+
+		code := http.StatusOK
+		for name, check := range resp.Checks {
+			if !check.OK {
+				resp.Status = "fail"
+				code = http.StatusServiceUnavailable
+				hs.logger.Warnw("readiness check failed", "check", name, "error", check.Error)
+			}
+		}
+
+		WriteJSONResponse(w, code, resp)
+	}
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"load-balancer/internal/audit"
+	"load-balancer/internal/models"
+	"load-balancer/internal/repo"
+)
+
+// PlanReloader — отслеживание планов рейт-лимитера, которое нужно обновить после изменения плана, чтобы новые
+// лимиты применились к клиентам в памяти.
+type PlanReloader interface {
+	Reload(ctx context.Context) error
+}
+
+type PlanService struct {
+	repo    repo.Repository
+	plans   PlanReloader
+	auditor *audit.Auditor
+	logger  *zap.SugaredLogger
+}
+
+// NewPlanService — создаёт сервис управления планами рейт-лимита.
+func NewPlanService(repo repo.Repository, plans PlanReloader, auditor *audit.Auditor, logger *zap.SugaredLogger) *PlanService {
+	return &PlanService{
+		repo:    repo,
+		plans:   plans,
+		auditor: auditor,
+		logger:  logger,
+	}
+}
+
+// ListPlansHandler — возвращает все планы в порядке имён.
+func (ps *PlanService) ListPlansHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		plans, err := ps.repo.ListPlans(r.Context())
+		if err != nil {
+			WriteJSONError(w, http.StatusInternalServerError, "failed to list plans")
+			ps.logger.Error(errors.Wrap(err, "failed to list plans"))
+			return
+		}
+		if plans == nil {
+			plans = []*models.Plan{}
+		}
+		WriteJSONResponse(w, http.StatusOK, plans)
+	}
+}
+
+// GetPlanHandler — возвращает план по имени.
+func (ps *PlanService) GetPlanHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		plan, err := ps.repo.GetPlan(r.Context(), r.PathValue("name"))
+		if err != nil {
+			ps.writeRepoError(w, err, "failed to get plan")
+			return
+		}
+		WriteJSONResponse(w, http.StatusOK, plan)
+	}
+}
+
+// CreatePlanHandler — создаёт план: {"name", "capacity", "rate", "rate_period", "algorithm"}. Алгоритм необязателен.
+func (ps *PlanService) CreatePlanHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var plan models.Plan
+		if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+			WriteJSONError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if err := plan.Validate(); err != nil {
+			WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := ps.repo.CreatePlan(r.Context(), &plan); err != nil {
+			ps.writeRepoError(w, err, "failed to create plan")
+			return
+		}
+
+		ps.reload(r.Context())
+		ps.auditor.Record(r.Context(), audit.FromRequest(r), audit.ActionPlanCreate, audit.TargetPlan, plan.Name, nil, plan)
+		WriteJSONResponse(w, http.StatusCreated, plan)
+		ps.logger.Infow("created rate limit plan", "plan", plan.Name)
+	}
+}
+
+// UpdatePlanHandler — заменяет лимиты плана целиком. Новые лимиты сразу действуют для всех клиентов плана, кроме
+// переопределённых у клиента; токены клиентов сохраняются и урезаются до новой ёмкости.
+func (ps *PlanService) UpdatePlanHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+
+		var plan models.Plan
+		if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+			WriteJSONError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		plan.Name = name
+		if err := plan.Validate(); err != nil {
+			WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		before, err := ps.repo.GetPlan(r.Context(), name)
+		if err != nil {
+			ps.writeRepoError(w, err, "failed to get plan")
+			return
+		}
+		if err := ps.repo.UpdatePlan(r.Context(), &plan); err != nil {
+			ps.writeRepoError(w, err, "failed to update plan")
+			return
+		}
+
+		ps.reload(r.Context())
+		ps.auditor.Record(r.Context(), audit.FromRequest(r), audit.ActionPlanUpdate, audit.TargetPlan, name, before, plan)
+		WriteJSONResponse(w, http.StatusOK, plan)
+		ps.logger.Infow("updated rate limit plan", "plan", name)
+	}
+}
+
+// DeletePlanHandler — удаляет план. План, назначенный клиентам, удалить нельзя: сначала клиентов нужно перевести
+// на другой план или отвязать от плана.
+func (ps *PlanService) DeletePlanHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+
+		before, err := ps.repo.GetPlan(r.Context(), name)
+		if err != nil {
+			ps.writeRepoError(w, err, "failed to get plan")
+			return
+		}
+		if err := ps.repo.DeletePlan(r.Context(), name); err != nil {
+			ps.writeRepoError(w, err, "failed to delete plan")
+			return
+		}
+
+		ps.reload(r.Context())
+		ps.auditor.Record(r.Context(), audit.FromRequest(r), audit.ActionPlanDelete, audit.TargetPlan, name, before, nil)
+		WriteJSONResponse(w, http.StatusOK, map[string]string{"status": "deleted", "name": name})
+		ps.logger.Infow("deleted rate limit plan", "plan", name)
+	}
+}
+
+// reload — применяет изменение плана к клиентам на этом инстансе сразу. Если перечитать планы не удалось, изменение
+// применится при следующем фоновом обновлении.
+func (ps *PlanService) reload(ctx context.Context) {
+	if err := ps.plans.Reload(ctx); err != nil {
+		ps.logger.Errorw("failed to reload rate limit plans", "error", err)
+	}
+}
+
+func (ps *PlanService) writeRepoError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, repo.ErrPlanNotFound):
+		WriteJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, repo.ErrPlanExists), errors.Is(err, repo.ErrPlanInUse):
+		WriteJSONError(w, http.StatusConflict, err.Error())
+	default:
+		WriteJSONError(w, http.StatusInternalServerError, message)
+		ps.logger.Error(errors.Wrap(err, message))
+	}
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"load-balancer/internal/audit"
+	"load-balancer/internal/models"
+	"load-balancer/internal/repo"
+)
+
+// PolicyReloader — набор политик рейт-лимитера, который нужно перечитать после изменения политик.
+type PolicyReloader interface {
+	Reload(ctx context.Context) error
+}
+
+type PolicyService struct {
+	repo     repo.Repository
+	policies PolicyReloader
+	auditor  *audit.Auditor
+	logger   *zap.SugaredLogger
+}
+
+// NewPolicyService — создаёт сервис управления политиками рейт-лимита по маршрутам.
+func NewPolicyService(repo repo.Repository, policies PolicyReloader, auditor *audit.Auditor, logger *zap.SugaredLogger) *PolicyService {
+	return &PolicyService{
+		repo:     repo,
+		policies: policies,
+		auditor:  auditor,
+		logger:   logger,
+	}
+}
+
+// ListPoliciesHandler — возвращает все политики в порядке имён.
+func (ps *PolicyService) ListPoliciesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		policies, err := ps.repo.ListPolicies(r.Context())
+		if err != nil {
+			WriteJSONError(w, http.StatusInternalServerError, "failed to list policies")
+			ps.logger.Error(errors.Wrap(err, "failed to list policies"))
+			return
+		}
+		if policies == nil {
+			policies = []*models.RateLimitPolicy{}
+		}
+		WriteJSONResponse(w, http.StatusOK, policies)
+	}
+}
+
+// GetPolicyHandler — возвращает политику по имени.
+func (ps *PolicyService) GetPolicyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		policy, err := ps.repo.GetPolicy(r.Context(), r.PathValue("name"))
+		if errors.Is(err, repo.ErrPolicyNotFound) {
+			WriteJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			WriteJSONError(w, http.StatusInternalServerError, "failed to get policy")
+			ps.logger.Error(errors.Wrap(err, "failed to get policy"))
+			return
+		}
+		WriteJSONResponse(w, http.StatusOK, policy)
+	}
+}
+
+// CreatePolicyHandler — создаёт политику: {"name", "method", "path_pattern", "capacity", "rate", "rate_period",
+// "algorithm"}. Метод и алгоритм необязательны.
+func (ps *PolicyService) CreatePolicyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var policy models.RateLimitPolicy
+		if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+			WriteJSONError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if err := policy.Validate(); err != nil {
+			WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := ps.repo.CreatePolicy(r.Context(), &policy); err != nil {
+			ps.writeRepoError(w, err, "failed to create policy")
+			return
+		}
+
+		ps.reload(r.Context())
+		ps.auditor.Record(r.Context(), audit.FromRequest(r), audit.ActionPolicyCreate, audit.TargetPolicy, policy.Name, nil, policy)
+		WriteJSONResponse(w, http.StatusCreated, policy)
+		ps.logger.Infow("created rate limit policy", "policy", policy.Name)
+	}
+}
+
+// UpdatePolicyHandler — заменяет условия и лимиты политики целиком. Лимиты клиентов по политике начинаются заново.
+func (ps *PolicyService) UpdatePolicyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+
+		var policy models.RateLimitPolicy
+		if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+			WriteJSONError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		policy.Name = name
+		if err := policy.Validate(); err != nil {
+			WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		before, err := ps.repo.GetPolicy(r.Context(), name)
+		if err != nil {
+			ps.writeRepoError(w, err, "failed to get policy")
+			return
+		}
+		if err := ps.repo.UpdatePolicy(r.Context(), &policy); err != nil {
+			ps.writeRepoError(w, err, "failed to update policy")
+			return
+		}
+
+		ps.reload(r.Context())
+		ps.auditor.Record(r.Context(), audit.FromRequest(r), audit.ActionPolicyUpdate, audit.TargetPolicy, name, before, policy)
+		WriteJSONResponse(w, http.StatusOK, policy)
+		ps.logger.Infow("updated rate limit policy", "policy", name)
+	}
+}
+
+// DeletePolicyHandler — удаляет политику; запросы по её маршруту ограничиваются только общим лимитом клиента.
+func (ps *PolicyService) DeletePolicyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+
+		before, err := ps.repo.GetPolicy(r.Context(), name)
+		if err != nil {
+			ps.writeRepoError(w, err, "failed to get policy")
+			return
+		}
+		if err := ps.repo.DeletePolicy(r.Context(), name); err != nil {
+			ps.writeRepoError(w, err, "failed to delete policy")
+			return
+		}
+
+		ps.reload(r.Context())
+		ps.auditor.Record(r.Context(), audit.FromRequest(r), audit.ActionPolicyDelete, audit.TargetPolicy, name, before, nil)
+		WriteJSONResponse(w, http.StatusOK, map[string]string{"status": "deleted", "name": name})
+		ps.logger.Infow("deleted rate limit policy", "policy", name)
+	}
+}
+
+// reload — применяет изменение политик на этом инстансе сразу. Если перечитать не удалось, изменение применится при
+// следующем фоновом обновлении.
+func (ps *PolicyService) reload(ctx context.Context) {
+	if err := ps.policies.Reload(ctx); err != nil {
+		ps.logger.Errorw("failed to reload rate limit policies", "error", err)
+	}
+}
+
+func (ps *PolicyService) writeRepoError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, repo.ErrPolicyNotFound):
+		WriteJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, repo.ErrPolicyExists):
+		WriteJSONError(w, http.StatusConflict, err.Error())
+	default:
+		WriteJSONError(w, http.StatusInternalServerError, message)
+		ps.logger.Error(errors.Wrap(err, message))
+	}
+}
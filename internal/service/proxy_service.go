@@ -2,47 +2,98 @@ package service
 
 import (
 	"go.uber.org/zap"
-	"load-balancer/pkg/balancing_algorithms"
+	"load-balancer/internal/accesslog"
+	"load-balancer/internal/metrics"
+	"load-balancer/internal/upstream"
 	"net/http"
 	"net/http/httputil"
+	"time"
 )
 
 type ProxyService struct {
-	balancer balancing_algorithms.Balancer
-	logger   *zap.SugaredLogger
+	upstreams *upstream.Manager
+	logger    *zap.SugaredLogger
+	metrics   metrics.Recorder
 }
 
-// NewProxyService — создаёт сервис прокси с указанием балансировщика и логгера.
-func NewProxyService(balancer balancing_algorithms.Balancer, logger *zap.SugaredLogger) *ProxyService {
+// NewProxyService — создаёт сервис прокси с указанием менеджера пулов и маршрутов, логгера и метрик.
+func NewProxyService(upstreams *upstream.Manager, logger *zap.SugaredLogger, recorder metrics.Recorder) *ProxyService {
 	return &ProxyService{
-		balancer: balancer,
-		logger:   logger,
+		upstreams: upstreams,
+		logger:    logger,
+		metrics:   recorder,
 	}
 }
 
-// ProxyHandler — основной обработчик запросов: выбирает бэкенд, проксирует запрос, помечает недоступные бэкенды.
+// ProxyHandler — основной обработчик запросов: находит маршрут и пул, выбирает бэкенд, проксирует запрос и размыкает
+// цепь бэкендов, от которых не удалось получить ответ.
 func (ps *ProxyService) ProxyHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		backend := ps.balancer.Next()
+		route := ps.upstreams.Match(r)
+		if route == nil {
+			http.Error(w, "No route for request", http.StatusNotFound)
+			ps.metrics.ObserveRequest("", "", "", r.Method, http.StatusNotFound, 0)
+			return
+		}
+		pool := route.Pool
+
+		backend := pool.Balancer.Next()
 		if backend == nil {
-			ps.logger.Errorw("There is no available service")
+			ps.logger.Errorw("There is no available service", "pool", pool.Name)
 			http.Error(w, "All backends are unavailable", http.StatusServiceUnavailable)
+			ps.metrics.ObserveRequest(route.Name, pool.Name, "", r.Method, http.StatusServiceUnavailable, 0)
 			return
 		}
+		backendName := backend.URL.Host
+		upstreamFailed := false
+
 		proxy := httputil.NewSingleHostReverseProxy(backend.URL)
 		proxy.ErrorHandler = func(rw http.ResponseWriter, r *http.Request, err error) {
 			ps.logger.Errorw("Error while request redirection",
 				"service", backend,
 				"error", err.Error())
 
-			backend.Mu.Lock()
-			backend.Available = false
-			backend.Mu.Unlock()
-			ps.logger.Infow("Backend status switched to unavailable",
-				"service", backend.URL.String())
+			upstreamFailed = true
+			if backend.TripCircuit() {
+				ps.metrics.SetBackendAvailable(pool.Name, backendName, false)
+				ps.logger.Infow("Backend circuit opened",
+					"service", backend.URL.String())
+			}
 
 			http.Error(rw, err.Error(), http.StatusBadGateway)
 		}
-		proxy.ServeHTTP(w, r)
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		// ReverseProxy прерывает ответ паникой http.ErrAbortHandler, например при обрыве соединения клиента,
+		// поэтому слот бэкенда и счётчик освобождаются в defer.
+		backend.Acquire()
+		defer backend.Release()
+		ps.metrics.IncInFlight(pool.Name, backendName)
+		defer ps.metrics.DecInFlight(pool.Name, backendName)
+		start := time.Now()
+		proxy.ServeHTTP(sw, r)
+		upstreamLatency := time.Since(start)
+		backend.RecordResponse(upstreamLatency, upstreamFailed || sw.status >= http.StatusInternalServerError)
+		ps.metrics.ObserveRequest(route.Name, pool.Name, backendName, r.Method, sw.status, upstreamLatency)
+
+		entry := accesslog.FromContext(r.Context())
+		entry.UpstreamBackend = backendName
+		entry.UpstreamLatency = upstreamLatency
 	}
 }
+
+// statusWriter — обёртка над http.ResponseWriter, запоминающая отправленный клиенту статус ответа.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	sw.status = code
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap — позволяет http.ResponseController добраться до исходного ResponseWriter (Flush и т.п.).
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
@@ -19,3 +19,13 @@ func WriteJSONError(w http.ResponseWriter, code int, message string) {
 		"message": message,
 	})
 }
+
+// WriteJSONErrorReason — отправляет JSON-ошибку, как WriteJSONError, с машиночитаемой причиной reason, по которой
+// клиент отличает ответы с одним кодом состояния, например исчерпанную квоту от превышения лимита.
+func WriteJSONErrorReason(w http.ResponseWriter, code int, reason, message string) {
+	WriteJSONResponse(w, code, map[string]interface{}{
+		"code":    code,
+		"error":   reason,
+		"message": message,
+	})
+}
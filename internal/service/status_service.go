@@ -0,0 +1,51 @@
+package service
+
+import (
+	"go.uber.org/zap"
+	"load-balancer/pkg/balancing_algorithms"
+	"net/http"
+)
+
+// PoolRegistry — источник актуального набора пулов. Набор может меняться при перезагрузке конфигурации, поэтому
+// сервисы не хранят пулы у себя, а каждый раз запрашивают их заново.
+type PoolRegistry interface {
+	Pools() []*balancing_algorithms.Pool
+	Pool(name string) *balancing_algorithms.Pool
+}
+
+type StatusService struct {
+	pools  PoolRegistry
+	logger *zap.SugaredLogger
+}
+
+// NewStatusService — создаёт сервис, отдающий состояние пулов и бэкендов в режиме только для чтения.
+func NewStatusService(pools PoolRegistry, logger *zap.SugaredLogger) *StatusService {
+	return &StatusService{
+		pools:  pools,
+		logger: logger,
+	}
+}
+
+// PoolsHandler — возвращает все пулы со списком бэкендов, их доступностью, историей проверок и статистикой запросов.
+func (ss *StatusService) PoolsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pools := ss.pools.Pools()
+		statuses := make([]balancing_algorithms.PoolStatus, 0, len(pools))
+		for _, pool := range pools {
+			statuses = append(statuses, pool.Status())
+		}
+		WriteJSONResponse(w, http.StatusOK, map[string]interface{}{"pools": statuses})
+	}
+}
+
+// PoolHandler — возвращает состояние одного пула по имени или 404, если такого пула нет.
+func (ss *StatusService) PoolHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pool := ss.pools.Pool(r.PathValue("pool"))
+		if pool == nil {
+			WriteJSONError(w, http.StatusNotFound, "pool not found")
+			return
+		}
+		WriteJSONResponse(w, http.StatusOK, pool.Status())
+	}
+}
@@ -0,0 +1,122 @@
+package upstream
+
+import (
+	"sort"
+
+	"load-balancer/internal/models"
+)
+
+// Diff — что изменилось между двумя топологиями. Используется для сводки в логе после перезагрузки конфигурации.
+type Diff struct {
+	AddedPools        []string            `json:"added_pools,omitempty"`
+	RemovedPools      []string            `json:"removed_pools,omitempty"`
+	ChangedStrategies map[string]string   `json:"changed_strategies,omitempty"`
+	AddedBackends     map[string][]string `json:"added_backends,omitempty"`
+	RemovedBackends   map[string][]string `json:"removed_backends,omitempty"`
+	AddedRoutes       []string            `json:"added_routes,omitempty"`
+	RemovedRoutes     []string            `json:"removed_routes,omitempty"`
+	ChangedRoutes     []string            `json:"changed_routes,omitempty"`
+}
+
+// Empty — true, если топологии ничем не отличаются.
+func (d Diff) Empty() bool {
+	return len(d.AddedPools) == 0 && len(d.RemovedPools) == 0 && len(d.ChangedStrategies) == 0 &&
+		len(d.AddedBackends) == 0 && len(d.RemovedBackends) == 0 &&
+		len(d.AddedRoutes) == 0 && len(d.RemovedRoutes) == 0 && len(d.ChangedRoutes) == 0
+}
+
+// diffTopologies — сравнивает пулы, стратегии, бэкенды и маршруты двух топологий.
+func diffTopologies(old, next *Topology) Diff {
+	diff := Diff{
+		ChangedStrategies: make(map[string]string),
+		AddedBackends:     make(map[string][]string),
+		RemovedBackends:   make(map[string][]string),
+	}
+
+	for name, pool := range next.byName {
+		oldPool, ok := old.byName[name]
+		if !ok {
+			diff.AddedPools = append(diff.AddedPools, name)
+			for _, backend := range pool.Backends() {
+				diff.AddedBackends[name] = append(diff.AddedBackends[name], backend.URL.String())
+			}
+			continue
+		}
+
+		if oldPool.Strategy != pool.Strategy {
+			diff.ChangedStrategies[name] = oldPool.Strategy + " -> " + pool.Strategy
+		}
+
+		added, removed := diffURLs(backendURLs(oldPool.Backends()), backendURLs(pool.Backends()))
+		if len(added) > 0 {
+			diff.AddedBackends[name] = added
+		}
+		if len(removed) > 0 {
+			diff.RemovedBackends[name] = removed
+		}
+	}
+
+	for name, pool := range old.byName {
+		if _, ok := next.byName[name]; !ok {
+			diff.RemovedPools = append(diff.RemovedPools, name)
+			diff.RemovedBackends[name] = backendURLs(pool.Backends())
+		}
+	}
+
+	oldRoutes := make(map[string]*Route, len(old.routes))
+	for _, route := range old.routes {
+		oldRoutes[route.Name] = route
+	}
+	nextRoutes := make(map[string]*Route, len(next.routes))
+	for _, route := range next.routes {
+		nextRoutes[route.Name] = route
+		oldRoute, ok := oldRoutes[route.Name]
+		switch {
+		case !ok:
+			diff.AddedRoutes = append(diff.AddedRoutes, route.Name)
+		case oldRoute.Host != route.Host || oldRoute.PathPrefix != route.PathPrefix || oldRoute.Pool.Name != route.Pool.Name:
+			diff.ChangedRoutes = append(diff.ChangedRoutes, route.Name)
+		}
+	}
+	for name := range oldRoutes {
+		if _, ok := nextRoutes[name]; !ok {
+			diff.RemovedRoutes = append(diff.RemovedRoutes, name)
+		}
+	}
+
+	sort.Strings(diff.AddedPools)
+	sort.Strings(diff.RemovedPools)
+	sort.Strings(diff.AddedRoutes)
+	sort.Strings(diff.RemovedRoutes)
+	sort.Strings(diff.ChangedRoutes)
+
+	return diff
+}
+
+func diffURLs(old, next []string) (added, removed []string) {
+	oldSet := make(map[string]bool, len(old))
+	for _, u := range old {
+		oldSet[u] = true
+	}
+	nextSet := make(map[string]bool, len(next))
+	for _, u := range next {
+		nextSet[u] = true
+		if !oldSet[u] {
+			added = append(added, u)
+		}
+	}
+	for _, u := range old {
+		if !nextSet[u] {
+			removed = append(removed, u)
+		}
+	}
+	return added, removed
+}
+
+func backendURLs(backends []*models.Backend) []string {
+	urls := make([]string, 0, len(backends))
+	for _, backend := range backends {
+		urls = append(urls, backend.URL.String())
+	}
+	return urls
+}
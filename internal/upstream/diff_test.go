@@ -0,0 +1,113 @@
+package upstream
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"load-balancer/internal/models"
+	"load-balancer/pkg/balancing_algorithms"
+)
+
+// nopFactory — фабрика без балансировщиков: тестам нужны только пулы и маршруты.
+type nopFactory struct{}
+
+func (nopFactory) Create(*balancing_algorithms.Pool, string) balancing_algorithms.Balancer {
+	return nil
+}
+
+func testTopology(pools map[string][]string, strategies map[string]string, routes ...*Route) *Topology {
+	var list []*balancing_algorithms.Pool
+	byName := make(map[string]*balancing_algorithms.Pool)
+	for name, urls := range pools {
+		var backends []*models.Backend
+		for _, raw := range urls {
+			u, _ := url.Parse(raw)
+			backends = append(backends, models.NewBackend(u))
+		}
+		pool := balancing_algorithms.NewPool(name, strategies[name], backends, nopFactory{})
+		list = append(list, pool)
+		byName[name] = pool
+	}
+	for _, route := range routes {
+		route.Pool = byName[route.Pool.Name]
+	}
+	return newTopology(list, routes)
+}
+
+func route(name, host, prefix, pool string) *Route {
+	return &Route{Name: name, Host: host, PathPrefix: prefix, Pool: &balancing_algorithms.Pool{Name: pool}}
+}
+
+func TestDiffTopologies(t *testing.T) {
+	tests := []struct {
+		name string
+		old  *Topology
+		next *Topology
+		want Diff
+	}{
+		{
+			name: "no changes",
+			old:  testTopology(map[string][]string{"a": {"http://a:1"}}, nil, route("/", "", "/", "a")),
+			next: testTopology(map[string][]string{"a": {"http://a:1"}}, nil, route("/", "", "/", "a")),
+			want: Diff{},
+		},
+		{
+			name: "pool added and removed",
+			old:  testTopology(map[string][]string{"a": {"http://a:1"}}, nil),
+			next: testTopology(map[string][]string{"b": {"http://b:1", "http://b:2"}}, nil),
+			want: Diff{
+				AddedPools:      []string{"b"},
+				RemovedPools:    []string{"a"},
+				AddedBackends:   map[string][]string{"b": {"http://b:1", "http://b:2"}},
+				RemovedBackends: map[string][]string{"a": {"http://a:1"}},
+			},
+		},
+		{
+			name: "backends and strategy changed",
+			old:  testTopology(map[string][]string{"a": {"http://a:1", "http://a:2"}}, map[string]string{"a": "round_robin"}),
+			next: testTopology(map[string][]string{"a": {"http://a:2", "http://a:3"}}, map[string]string{"a": "random"}),
+			want: Diff{
+				ChangedStrategies: map[string]string{"a": "round_robin -> random"},
+				AddedBackends:     map[string][]string{"a": {"http://a:3"}},
+				RemovedBackends:   map[string][]string{"a": {"http://a:1"}},
+			},
+		},
+		{
+			name: "routes added, removed and changed",
+			old: testTopology(map[string][]string{"a": {"http://a:1"}, "b": {"http://b:1"}}, nil,
+				route("api", "", "/api", "a"), route("old", "", "/old", "a"), route("web", "", "/", "a")),
+			next: testTopology(map[string][]string{"a": {"http://a:1"}, "b": {"http://b:1"}}, nil,
+				route("api", "", "/api", "a"), route("new", "", "/new", "a"), route("web", "", "/", "b")),
+			want: Diff{
+				AddedRoutes:   []string{"new"},
+				RemovedRoutes: []string{"old"},
+				ChangedRoutes: []string{"web"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffTopologies(tt.old, tt.next)
+			if got.Empty() != tt.want.Empty() {
+				t.Fatalf("Empty() = %v, want %v", got.Empty(), tt.want.Empty())
+			}
+			normalize := func(d *Diff) {
+				if len(d.ChangedStrategies) == 0 {
+					d.ChangedStrategies = nil
+				}
+				if len(d.AddedBackends) == 0 {
+					d.AddedBackends = nil
+				}
+				if len(d.RemovedBackends) == 0 {
+					d.RemovedBackends = nil
+				}
+			}
+			normalize(&got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diff = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
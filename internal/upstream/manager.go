@@ -0,0 +1,157 @@
+package upstream
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"load-balancer/internal/config"
+	"load-balancer/internal/models"
+	"load-balancer/pkg/balancing_algorithms"
+)
+
+// ErrPoolNotFound — пула с таким именем нет в актуальной топологии.
+var ErrPoolNotFound = errors.New("pool not found")
+
+type Manager struct {
+	factory balancing_algorithms.BalancerFactory
+
+	mu      sync.Mutex
+	current atomic.Pointer[Topology]
+	// declared — URL бэкендов каждого пула из последней применённой конфигурации. Остальные бэкенды пула добавлены
+	// через админский API.
+	declared map[string]map[string]bool
+}
+
+// NewManager — создаёт менеджер пулов и маршрутов и собирает начальную топологию из конфигурации.
+func NewManager(cfg *config.Config, factory balancing_algorithms.BalancerFactory) (*Manager, error) {
+	m := &Manager{factory: factory}
+	m.current.Store(newTopology(nil, nil))
+	if _, err := m.Apply(cfg); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Current — возвращает актуальный снимок топологии.
+func (m *Manager) Current() *Topology {
+	return m.current.Load()
+}
+
+// Match — находит маршрут для запроса в актуальной топологии.
+func (m *Manager) Match(r *http.Request) *Route {
+	return m.Current().Match(r)
+}
+
+// Pools — возвращает все пулы актуальной топологии.
+func (m *Manager) Pools() []*balancing_algorithms.Pool {
+	return m.Current().pools
+}
+
+// Pool — возвращает пул по имени или nil, если такого пула нет.
+func (m *Manager) Pool(name string) *balancing_algorithms.Pool {
+	return m.Current().byName[name]
+}
+
+// AddBackend — добавляет бэкенд в пул актуальной топологии. Изменение идёт под той же блокировкой, что и Apply, поэтому
+// перезагрузка конфигурации, идущая параллельно, не потеряет добавленный бэкенд.
+func (m *Manager) AddBackend(pool string, backend *models.Backend) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.Current().byName[pool]
+	if !ok {
+		return ErrPoolNotFound
+	}
+	return p.Add(backend)
+}
+
+// RemoveBackend — убирает бэкенд из пула актуальной топологии под той же блокировкой, что и Apply.
+func (m *Manager) RemoveBackend(pool, id string) (*models.Backend, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.Current().byName[pool]
+	if !ok {
+		return nil, ErrPoolNotFound
+	}
+	return p.Remove(id)
+}
+
+// Apply — собирает новую топологию из конфигурации и атомарно подменяет ею текущую. Бэкенды, которые остались в том же
+// пуле, переносятся как есть, вместе с состоянием проверок, статистикой и запросами в работе. Бэкенды, добавленные
+// через админский API, остаются в своём пуле, пока пул есть в конфигурации. Для каждого пула создаётся новый
+// балансировщик, поэтому смена стратегии тоже применяется сразу.
+func (m *Manager) Apply(cfg *config.Config) (Diff, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old := m.Current()
+
+	pools := make([]*balancing_algorithms.Pool, 0, len(cfg.Pools))
+	byName := make(map[string]*balancing_algorithms.Pool, len(cfg.Pools))
+	declared := make(map[string]map[string]bool, len(cfg.Pools))
+	for _, poolCfg := range cfg.Pools {
+		var existing []*models.Backend
+		if oldPool, ok := old.byName[poolCfg.Name]; ok {
+			existing = oldPool.Backends()
+		}
+
+		backends := make([]*models.Backend, 0, len(poolCfg.Backends))
+		declared[poolCfg.Name] = make(map[string]bool, len(poolCfg.Backends))
+		for _, rawURL := range poolCfg.Backends {
+			u, err := url.Parse(rawURL)
+			if err != nil {
+				return Diff{}, errors.Wrapf(err, "failed to parse backend url %q", rawURL)
+			}
+			if declared[poolCfg.Name][u.String()] {
+				continue
+			}
+			declared[poolCfg.Name][u.String()] = true
+			backends = append(backends, reuseBackend(existing, u))
+		}
+		for _, backend := range existing {
+			if m.declared[poolCfg.Name][backend.URL.String()] || declared[poolCfg.Name][backend.URL.String()] {
+				continue
+			}
+			backends = append(backends, backend)
+		}
+
+		pool := balancing_algorithms.NewPool(poolCfg.Name, poolCfg.BalanceStrategy, backends, m.factory)
+		pools = append(pools, pool)
+		byName[pool.Name] = pool
+	}
+
+	routes := make([]*Route, 0, len(cfg.Routes))
+	for _, routeCfg := range cfg.Routes {
+		pool, ok := byName[routeCfg.Pool]
+		if !ok {
+			return Diff{}, errors.Errorf("route %q refers to unknown pool %q", routeCfg.Name, routeCfg.Pool)
+		}
+		routes = append(routes, &Route{
+			Name:       routeCfg.Name,
+			Host:       routeCfg.Host,
+			PathPrefix: routeCfg.PathPrefix,
+			Pool:       pool,
+		})
+	}
+
+	next := newTopology(pools, routes)
+	diff := diffTopologies(old, next)
+	m.current.Store(next)
+	m.declared = declared
+
+	return diff, nil
+}
+
+// reuseBackend — возвращает уже существующий бэкенд с тем же URL или создаёт новый.
+func reuseBackend(existing []*models.Backend, u *url.URL) *models.Backend {
+	for _, backend := range existing {
+		if backend.URL.String() == u.String() {
+			return backend
+		}
+	}
+	return models.NewBackend(u)
+}
@@ -0,0 +1,90 @@
+package upstream
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+
+	"load-balancer/internal/config"
+	"load-balancer/internal/models"
+)
+
+func TestApplyKeepsRuntimeBackends(t *testing.T) {
+	cfg := func(backends ...string) *config.Config {
+		return &config.Config{
+			Pools:  []config.Pool{{Name: "a", BalanceStrategy: "round_robin", Backends: backends}},
+			Routes: []config.Route{{Name: "/", PathPrefix: "/", Pool: "a"}},
+		}
+	}
+
+	m, err := NewManager(cfg("http://a:1", "http://a:2"), nopFactory{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, _ := m.Pool("a").Backend("a:1")
+	u, _ := url.Parse("http://runtime:1")
+	if err := m.AddBackend("a", models.NewBackend(u)); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := m.Apply(cfg("http://a:1", "http://a:3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := backendURLs(m.Pool("a").Backends())
+	want := []string{"http://a:1", "http://a:3", "http://runtime:1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("backends = %v, want %v", got, want)
+	}
+	if reused, _ := m.Pool("a").Backend("a:1"); reused != kept {
+		t.Error("backend from config was not carried over")
+	}
+	if !reflect.DeepEqual(diff.RemovedBackends, map[string][]string{"a": {"http://a:2"}}) {
+		t.Errorf("removed backends = %v", diff.RemovedBackends)
+	}
+}
+
+func TestRuntimeBackendsSurviveConcurrentApply(t *testing.T) {
+	cfg := &config.Config{
+		Pools:  []config.Pool{{Name: "a", BalanceStrategy: "round_robin", Backends: []string{"http://a:1"}}},
+		Routes: []config.Route{{Name: "/", PathPrefix: "/", Pool: "a"}},
+	}
+	m, err := NewManager(cfg, nopFactory{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const added = 50
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < added; i++ {
+			if _, err := m.Apply(cfg); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < added; i++ {
+			u, _ := url.Parse(fmt.Sprintf("http://runtime:%d", i))
+			if err := m.AddBackend("a", models.NewBackend(u)); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	if got := len(m.Pool("a").Backends()); got != added+1 {
+		t.Errorf("pool has %d backends, want %d", got, added+1)
+	}
+	if _, err := m.RemoveBackend("missing", "a:1"); err != ErrPoolNotFound {
+		t.Errorf("RemoveBackend() error = %v, want ErrPoolNotFound", err)
+	}
+}
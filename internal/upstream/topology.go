@@ -0,0 +1,75 @@
+package upstream
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"load-balancer/pkg/balancing_algorithms"
+)
+
+// Route — правило, по которому запрос направляется в пул: по хосту (если задан) и префиксу пути.
+type Route struct {
+	Name       string
+	Host       string
+	PathPrefix string
+	Pool       *balancing_algorithms.Pool
+}
+
+// Topology — неизменяемый снимок пулов и маршрутов. При перезагрузке конфигурации собирается новый снимок и
+// подменяется целиком, поэтому обработчики запросов всегда видят согласованное состояние.
+type Topology struct {
+	pools  []*balancing_algorithms.Pool
+	byName map[string]*balancing_algorithms.Pool
+	routes []*Route
+}
+
+// newTopology — собирает снимок и упорядочивает маршруты так, чтобы сначала проверялись маршруты с хостом, а среди
+// них — с более длинным префиксом.
+func newTopology(pools []*balancing_algorithms.Pool, routes []*Route) *Topology {
+	byName := make(map[string]*balancing_algorithms.Pool, len(pools))
+	for _, pool := range pools {
+		byName[pool.Name] = pool
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		if (routes[i].Host != "") != (routes[j].Host != "") {
+			return routes[i].Host != ""
+		}
+		return len(routes[i].PathPrefix) > len(routes[j].PathPrefix)
+	})
+
+	return &Topology{
+		pools:  pools,
+		byName: byName,
+		routes: routes,
+	}
+}
+
+// Match — находит маршрут для запроса или возвращает nil, если ни один не подошёл.
+func (t *Topology) Match(r *http.Request) *Route {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	for _, route := range t.routes {
+		if route.Host != "" && !strings.EqualFold(route.Host, host) {
+			continue
+		}
+		if matchPrefix(r.URL.Path, route.PathPrefix) {
+			return route
+		}
+	}
+	return nil
+}
+
+// matchPrefix — проверяет, что путь совпадает с префиксом целиком или продолжается после него новым сегментом,
+// чтобы префикс /api не захватывал /apix.
+func matchPrefix(path, prefix string) bool {
+	if strings.HasSuffix(prefix, "/") {
+		return strings.HasPrefix(path, prefix)
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
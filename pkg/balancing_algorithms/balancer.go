@@ -1,7 +1,11 @@
 package balancing_algorithms
 
 import (
+	"context"
+
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"load-balancer/internal/metrics"
 	m "load-balancer/internal/models"
 	"net/http"
 	"time"
@@ -11,27 +15,42 @@ type Balancer interface {
 	Next() *m.Backend
 }
 
-// StartHealthCheck — запускает фоновую проверку доступности бэкендов через периодические HTTP-запросы.
-func StartHealthCheck(backends []*m.Backend, interval time.Duration, logger *zap.SugaredLogger) {
+// StartHealthCheck — запускает фоновую проверку доступности бэкендов через периодические HTTP-запросы. На каждом тике
+// берётся актуальный список пулов и бэкендов, поэтому добавленные на лету бэкенды и пулы из перезагруженной
+// конфигурации проверяются без перезапуска. Проверка останавливается при отмене контекста.
+func StartHealthCheck(ctx context.Context, pools func() []*Pool, interval time.Duration, logger *zap.SugaredLogger, recorder metrics.Recorder) {
 	go func() {
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
 		for {
 			select {
+			case <-ctx.Done():
+				return
 			case <-ticker.C:
-				for _, backend := range backends {
-					ok := isBackendAlive(backend.URL.String())
-					backend.Mu.Lock()
-					prev := backend.Available
-					backend.Available = ok
-					backend.Mu.Unlock()
-
-					if prev != ok {
-						logger.Infow("Backend status changed",
-							"url", backend.URL.String(),
-							"available", backend.Available,
-						)
+				for _, pool := range pools() {
+					for _, backend := range pool.Backends() {
+						start := time.Now()
+						err := checkBackend(backend.URL.String())
+						duration := time.Since(start)
+						ok := err == nil
+						recorder.ObserveHealthCheck(pool.Name, backend.URL.Host, ok, duration)
+
+						result := m.HealthCheckResult{Time: start, OK: ok, DurationMs: float64(duration) / float64(time.Millisecond)}
+						if err != nil {
+							result.Error = err.Error()
+						}
+						backend.RecordHealthCheck(result)
+
+						changed := backend.SetAvailable(ok)
+						recorder.SetBackendAvailable(pool.Name, backend.URL.Host, ok)
+
+						if changed {
+							logger.Infow("Backend status changed",
+								"url", backend.URL.String(),
+								"available", ok,
+							)
+						}
 					}
 				}
 			}
@@ -39,9 +58,18 @@ func StartHealthCheck(backends []*m.Backend, interval time.Duration, logger *zap
 	}()
 }
 
-// isBackendAlive — проверяет, доступен ли бэкенд, отправляя GET-запрос с таймаутом 3 секунды.
-func isBackendAlive(url string) bool {
+// checkBackend — проверяет, доступен ли бэкенд, отправляя GET-запрос с таймаутом 3 секунды. Возвращает причину,
+// если бэкенд недоступен.
+func checkBackend(url string) error {
 	client := &http.Client{Timeout: 3 * time.Second}
 	resp, err := client.Get(url)
-	return err == nil && resp.StatusCode == http.StatusOK
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
 }
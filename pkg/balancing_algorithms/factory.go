@@ -2,32 +2,33 @@ package balancing_algorithms
 
 import (
 	"go.uber.org/zap"
-	"load-balancer/internal/models"
+	"load-balancer/internal/metrics"
 )
 
 type BalancerFactory interface {
-	Create(backends []*models.Backend, strategy string) Balancer
+	Create(pool *Pool, strategy string) Balancer
 }
 
 type balancerFactory struct {
-	logger *zap.SugaredLogger
+	logger  *zap.SugaredLogger
+	metrics metrics.Recorder
 }
 
 // NewBalancerFactory — создаёт фабрику балансировщиков, которая возвращает нужный тип стратегии по названию.
-func NewBalancerFactory(logger *zap.SugaredLogger) BalancerFactory {
-	return &balancerFactory{logger: logger}
+func NewBalancerFactory(logger *zap.SugaredLogger, recorder metrics.Recorder) BalancerFactory {
+	return &balancerFactory{logger: logger, metrics: recorder}
 }
 
 // Create — метод фабрики, выбирающий конкретную реализацию балансировщика (Round Robin, Least Connections, Random).
-func (f *balancerFactory) Create(backends []*models.Backend, strategy string) Balancer {
+func (f *balancerFactory) Create(pool *Pool, strategy string) Balancer {
 	switch strategy {
 	case "round_robin":
-		return NewRoundRobinBalancer(backends, f.logger)
+		return NewRoundRobinBalancer(pool, f.logger, f.metrics)
 	case "least_connections":
-		return NewLeastConnectionsBalancer(backends, f.logger)
+		return NewLeastConnectionsBalancer(pool, f.logger, f.metrics)
 	case "random":
-		return NewRandomBalancer(backends, f.logger)
+		return NewRandomBalancer(pool, f.logger, f.metrics)
 	default:
-		return NewRoundRobinBalancer(backends, f.logger)
+		return NewRoundRobinBalancer(pool, f.logger, f.metrics)
 	}
 }
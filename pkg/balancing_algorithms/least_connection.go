@@ -2,58 +2,50 @@ package balancing_algorithms
 
 import (
 	"go.uber.org/zap"
+	"load-balancer/internal/metrics"
 	"load-balancer/internal/models"
 	"sync"
 )
 
 type LeastConnectionsBalancer struct {
-	backends []*leastConnsBackend
-	mu       sync.Mutex
-	log      *zap.SugaredLogger
+	pool    *Pool
+	mu      sync.Mutex
+	log     *zap.SugaredLogger
+	metrics metrics.Recorder
 }
 
-type leastConnsBackend struct {
-	*models.Backend
-	activeConnections int64
-}
-
-// NewLeastConnectionsBalancer — создаёт новый экземпляр балансировщика, который выбирает бэкенд с наименьшим числом соединений.
-func NewLeastConnectionsBalancer(backends []*models.Backend, logger *zap.SugaredLogger) *LeastConnectionsBalancer {
-	wrapped := make([]*leastConnsBackend, len(backends))
-	for i, b := range backends {
-		wrapped[i] = &leastConnsBackend{
-			Backend:           b,
-			activeConnections: 0,
-		}
-	}
+// NewLeastConnectionsBalancer — создаёт новый экземпляр балансировщика, который выбирает бэкенд с наименьшим числом
+// соединений на единицу веса. Число соединений берётся из счётчика запросов в работе, который ведёт прокси.
+func NewLeastConnectionsBalancer(pool *Pool, logger *zap.SugaredLogger, recorder metrics.Recorder) *LeastConnectionsBalancer {
 	return &LeastConnectionsBalancer{
-		backends: wrapped,
-		log:      logger,
+		pool:    pool,
+		log:     logger,
+		metrics: recorder,
 	}
 }
 
-// Next — выбирает доступный бэкенд c наименьшим числом соединений.
+// Next — выбирает доступный бэкенд c наименьшим числом соединений относительно веса.
 func (b *LeastConnectionsBalancer) Next() *models.Backend {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	var selected *leastConnsBackend
-	for _, backend := range b.backends {
-		if !backend.Available {
+	var selected *models.Backend
+	for _, backend := range b.pool.Backends() {
+		if !backend.Routable() {
 			continue
 		}
-		if selected == nil || backend.activeConnections < selected.activeConnections {
+		if selected == nil || backend.InFlight()*int64(selected.Weight) < selected.InFlight()*int64(backend.Weight) {
 			selected = backend
 		}
 	}
 
 	if selected == nil {
 		b.log.Errorw("There are no available backends")
+		b.metrics.ObserveBalancerPick(b.pool.Name, "least_connections", "")
 		return nil
 	}
 
-	selected.activeConnections++
-
 	b.log.Infow("Backend is chosen", "url", selected.URL.String())
-	return selected.Backend
+	b.metrics.ObserveBalancerPick(b.pool.Name, "least_connections", selected.URL.Host)
+	return selected
 }
@@ -0,0 +1,103 @@
+package balancing_algorithms
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	"load-balancer/internal/models"
+)
+
+var (
+	ErrBackendExists   = errors.New("backend already exists in pool")
+	ErrBackendNotFound = errors.New("backend not found in pool")
+)
+
+// Pool — именованная группа бэкендов со своей стратегией балансировки. Набор бэкендов можно менять на лету:
+// балансировщик и проверка доступности каждый раз берут актуальный снимок через Backends.
+type Pool struct {
+	Name     string
+	Strategy string
+	Balancer Balancer
+
+	mu       sync.RWMutex
+	backends []*models.Backend
+}
+
+type PoolStatus struct {
+	Name     string                 `json:"name"`
+	Strategy string                 `json:"strategy"`
+	Backends []models.BackendStatus `json:"backends"`
+}
+
+// NewPool — создаёт пул и балансировщик для него через фабрику.
+func NewPool(name, strategy string, backends []*models.Backend, factory BalancerFactory) *Pool {
+	p := &Pool{
+		Name:     name,
+		Strategy: strategy,
+		backends: backends,
+	}
+	p.Balancer = factory.Create(p, strategy)
+	return p
+}
+
+// Backends — возвращает копию текущего списка бэкендов, которую можно безопасно обходить без блокировки.
+func (p *Pool) Backends() []*models.Backend {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]*models.Backend(nil), p.backends...)
+}
+
+// Backend — ищет бэкенд пула по ID.
+func (p *Pool) Backend(id string) (*models.Backend, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, backend := range p.backends {
+		if backend.ID() == id {
+			return backend, nil
+		}
+	}
+	return nil, ErrBackendNotFound
+}
+
+// Add — добавляет бэкенд в пул, если бэкенда с таким же ID там ещё нет.
+func (p *Pool) Add(backend *models.Backend) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, existing := range p.backends {
+		if existing.ID() == backend.ID() {
+			return ErrBackendExists
+		}
+	}
+	p.backends = append(p.backends, backend)
+	return nil
+}
+
+// Remove — убирает бэкенд из пула. Уже начатые запросы к нему спокойно завершатся, новые он не получит.
+func (p *Pool) Remove(id string) (*models.Backend, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, backend := range p.backends {
+		if backend.ID() == id {
+			p.backends = append(p.backends[:i:i], p.backends[i+1:]...)
+			return backend, nil
+		}
+	}
+	return nil, ErrBackendNotFound
+}
+
+// Status — возвращает снимок состояния пула и всех его бэкендов.
+func (p *Pool) Status() PoolStatus {
+	backends := p.Backends()
+	status := PoolStatus{
+		Name:     p.Name,
+		Strategy: p.Strategy,
+		Backends: make([]models.BackendStatus, 0, len(backends)),
+	}
+	for _, backend := range backends {
+		status.Backends = append(status.Backends, backend.Status())
+	}
+	return status
+}
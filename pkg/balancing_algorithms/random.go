@@ -2,6 +2,7 @@ package balancing_algorithms
 
 import (
 	"go.uber.org/zap"
+	"load-balancer/internal/metrics"
 	"load-balancer/internal/models"
 	"math/rand"
 	"sync"
@@ -9,39 +10,54 @@ import (
 )
 
 type RandomBalancer struct {
-	backends []*models.Backend
-	mu       sync.Mutex
-	log      *zap.SugaredLogger
-	rand     *rand.Rand
+	pool    *Pool
+	mu      sync.Mutex
+	log     *zap.SugaredLogger
+	metrics metrics.Recorder
+	rand    *rand.Rand
 }
 
-// NewRandomBalancer — создаёт новый экземпляр балансировщика, который случайным образом выбирает из доступных бэкендов.
-func NewRandomBalancer(backends []*models.Backend, logger *zap.SugaredLogger) *RandomBalancer {
+// NewRandomBalancer — создаёт новый экземпляр балансировщика, который случайным образом выбирает из доступных бэкендов
+// с вероятностью, пропорциональной весу.
+func NewRandomBalancer(pool *Pool, logger *zap.SugaredLogger, recorder metrics.Recorder) *RandomBalancer {
 	return &RandomBalancer{
-		backends: backends,
-		log:      logger,
-		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		pool:    pool,
+		log:     logger,
+		metrics: recorder,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 }
 
-// Next — выбирает случайный доступный бэкенд и логирует выбор.
+// Next — выбирает случайный доступный бэкенд с учётом весов и логирует выбор.
 func (b *RandomBalancer) Next() *models.Backend {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
 	available := make([]*models.Backend, 0)
-	for _, be := range b.backends {
-		if be.Available {
+	total := 0
+	for _, be := range b.pool.Backends() {
+		if be.Routable() {
 			available = append(available, be)
+			total += be.Weight
 		}
 	}
 
 	if len(available) == 0 {
 		b.log.Errorw("There are no available backends")
+		b.metrics.ObserveBalancerPick(b.pool.Name, "random", "")
 		return nil
 	}
 
-	selected := available[b.rand.Intn(len(available))]
+	selected := available[len(available)-1]
+	n := b.rand.Intn(total)
+	for _, be := range available {
+		if n < be.Weight {
+			selected = be
+			break
+		}
+		n -= be.Weight
+	}
 	b.log.Infow("Backend is chosen", "url", selected.URL.String())
+	b.metrics.ObserveBalancerPick(b.pool.Name, "random", selected.URL.Host)
 	return selected
 }
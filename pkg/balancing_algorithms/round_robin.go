@@ -2,42 +2,63 @@ package balancing_algorithms
 
 import (
 	"go.uber.org/zap"
+	"load-balancer/internal/metrics"
 	m "load-balancer/internal/models"
 	"sync"
 )
 
 type RoundRobinBalancer struct {
-	backends []*m.Backend
-	mu       sync.Mutex
-	curIndex int
-	log      *zap.SugaredLogger
+	pool    *Pool
+	mu      sync.Mutex
+	current map[*m.Backend]int
+	log     *zap.SugaredLogger
+	metrics metrics.Recorder
 }
 
-// NewRoundRobinBalancer — создаёт балансировщик с алгоритмом Round Robin и начальным индексом.
-func NewRoundRobinBalancer(backends []*m.Backend, logger *zap.SugaredLogger) *RoundRobinBalancer {
+// NewRoundRobinBalancer — создаёт балансировщик с алгоритмом Round Robin с учётом весов бэкендов.
+func NewRoundRobinBalancer(pool *Pool, logger *zap.SugaredLogger, recorder metrics.Recorder) *RoundRobinBalancer {
 	return &RoundRobinBalancer{
-		backends: backends,
-		curIndex: 0,
-		log:      logger,
+		pool:    pool,
+		current: make(map[*m.Backend]int),
+		log:     logger,
+		metrics: recorder,
 	}
 }
 
-// Next — выбирает следующий доступный бэкенд по кругу, пропуская недоступные, и обновляет текущий индекс.
+// Next — выбирает следующий доступный бэкенд по кругу, пропуская недоступные. Бэкенды получают запросы
+// пропорционально весу и вперемешку (smooth weighted round robin, как в nginx): при равных весах это обычный круг.
 func (b *RoundRobinBalancer) Next() *m.Backend {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	for i := 0; i < len(b.backends); i++ {
-		idx := (b.curIndex + i) % len(b.backends)
-		be := b.backends[idx]
+	backends := b.pool.Backends()
+	if len(b.current) > len(backends) {
+		b.current = make(map[*m.Backend]int, len(backends))
+	}
 
-		if be.Available {
-			b.log.Infow("Backend is chosen", "url", be.URL.String())
-			b.curIndex = (idx + 1) % len(b.backends)
-			return be
+	var (
+		selected *m.Backend
+		total    int
+	)
+	for _, be := range backends {
+		if !be.Routable() {
+			continue
+		}
+		b.current[be] += be.Weight
+		total += be.Weight
+		if selected == nil || b.current[be] > b.current[selected] {
+			selected = be
 		}
 	}
 
-	b.log.Errorw("There are no available backends")
-	return nil
+	if selected == nil {
+		b.log.Errorw("There are no available backends")
+		b.metrics.ObserveBalancerPick(b.pool.Name, "round_robin", "")
+		return nil
+	}
+
+	b.current[selected] -= total
+	b.log.Infow("Backend is chosen", "url", selected.URL.String())
+	b.metrics.ObserveBalancerPick(b.pool.Name, "round_robin", selected.URL.Host)
+	return selected
 }